@@ -7,6 +7,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/mattn/go-sqlite3 v1.14.34
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/hashicorp/yamux v0.1.2
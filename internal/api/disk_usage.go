@@ -0,0 +1,285 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peterje/superposition/internal/db"
+	"github.com/peterje/superposition/internal/git"
+)
+
+// UsageHandler reports disk usage of the data directory and runs repository
+// maintenance.
+type UsageHandler struct {
+	db *sql.DB
+}
+
+func NewUsageHandler(db *sql.DB) *UsageHandler {
+	return &UsageHandler{db: db}
+}
+
+// diskUsage is the space used under the data directory, in bytes. Files
+// uploaded into a session count towards its worktree.
+type diskUsage struct {
+	Total     int64 `json:"total"`
+	Quota     int64 `json:"quota"`
+	OverQuota bool  `json:"over_quota"`
+
+	// Dirs maps each top-level entry of the data directory (repos,
+	// worktrees, archives, ...) to its size; the database and its WAL
+	// files are grouped as "database".
+	Dirs       map[string]int64 `json:"dirs"`
+	Repos      []repoUsage      `json:"repos"`
+	Sessions   []sessionUsage   `json:"sessions"`
+	ComputedAt time.Time        `json:"computed_at"`
+}
+
+type repoUsage struct {
+	ID        int64  `json:"id"`
+	Owner     string `json:"owner"`
+	Name      string `json:"name"`
+	LocalPath string `json:"local_path"`
+	Size      int64  `json:"size"`
+}
+
+type sessionUsage struct {
+	ID           string `json:"id"`
+	RepoID       int64  `json:"repo_id"`
+	Branch       string `json:"branch"`
+	Status       string `json:"status"`
+	WorktreePath string `json:"worktree_path"`
+	Size         int64  `json:"size"`
+}
+
+// dirSize returns the total size of the regular files under path, which
+// may also be a single file. Symlinks aren't followed.
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// diskQuota returns the disk_quota_gb setting in bytes, or 0 for no quota.
+func diskQuota(db *sql.DB) int64 {
+	gb, err := strconv.ParseFloat(settingValue(db, "disk_quota_gb"), 64)
+	if err != nil || gb <= 0 {
+		return 0
+	}
+	return int64(gb * (1 << 30))
+}
+
+func computeDiskUsage(database *sql.DB) (diskUsage, error) {
+	u := diskUsage{Dirs: map[string]int64{}, Repos: []repoUsage{}, Sessions: []sessionUsage{}, ComputedAt: time.Now().UTC()}
+	dataDir, err := db.DataDir()
+	if err != nil {
+		return u, err
+	}
+	entries, err := os.ReadDir(dataDir)
+	if err != nil && !os.IsNotExist(err) {
+		return u, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, "superposition.db") {
+			name = "database"
+		}
+		size := dirSize(filepath.Join(dataDir, e.Name()))
+		u.Dirs[name] += size
+		u.Total += size
+	}
+
+	rows, err := database.Query(`SELECT id, owner, name, local_path FROM repositories WHERE local_path != '' ORDER BY id`)
+	if err != nil {
+		return u, err
+	}
+	for rows.Next() {
+		var r repoUsage
+		if rows.Scan(&r.ID, &r.Owner, &r.Name, &r.LocalPath) == nil {
+			u.Repos = append(u.Repos, r)
+		}
+	}
+	rows.Close()
+	for i := range u.Repos {
+		u.Repos[i].Size = dirSize(u.Repos[i].LocalPath)
+	}
+
+	rows, err = database.Query(`SELECT id, repo_id, branch, status, worktree_path FROM sessions WHERE worktree_path != '' ORDER BY created_at`)
+	if err != nil {
+		return u, err
+	}
+	for rows.Next() {
+		var s sessionUsage
+		if rows.Scan(&s.ID, &s.RepoID, &s.Branch, &s.Status, &s.WorktreePath) == nil {
+			u.Sessions = append(u.Sessions, s)
+		}
+	}
+	rows.Close()
+	for i := range u.Sessions {
+		u.Sessions[i].Size = dirSize(u.Sessions[i].WorktreePath)
+	}
+
+	u.Quota = diskQuota(database)
+	u.OverQuota = u.Quota > 0 && u.Total >= u.Quota
+	return u, nil
+}
+
+// usageCacheAge is how long a computed diskUsage is reused, since walking
+// every worktree is slow.
+const usageCacheAge = time.Minute
+
+var (
+	usageMu    sync.Mutex
+	usageCache *diskUsage
+)
+
+// cachedDiskUsage returns the disk usage, recomputing it if the last result
+// is older than usageCacheAge or refresh is set.
+func cachedDiskUsage(db *sql.DB, refresh bool) (diskUsage, error) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	if !refresh && usageCache != nil && time.Since(usageCache.ComputedAt) < usageCacheAge {
+		u := *usageCache
+		u.Quota = diskQuota(db)
+		u.OverQuota = u.Quota > 0 && u.Total >= u.Quota
+		return u, nil
+	}
+	u, err := computeDiskUsage(db)
+	if err != nil {
+		return u, err
+	}
+	usageCache = &u
+	return u, nil
+}
+
+// checkDiskQuota returns a 507 error if the data directory has reached the
+// disk_quota_gb setting. It guards operations that take new space: creating
+// sessions and adding repositories.
+func checkDiskQuota(db *sql.DB) error {
+	if diskQuota(db) == 0 {
+		return nil
+	}
+	u, err := cachedDiskUsage(db, false)
+	if err != nil {
+		log.Printf("disk quota: %v", err)
+		return nil
+	}
+	if u.OverQuota {
+		return &sessionError{http.StatusInsufficientStorage, fmt.Sprintf(
+			"disk quota exceeded (%s used of %s); archive or delete sessions to free space",
+			formatBytes(u.Total), formatBytes(u.Quota))}
+	}
+	return nil
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+}
+
+// HandleGet returns the disk usage. ?refresh=true recomputes it instead of
+// returning a result up to a minute old.
+func (h *UsageHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	u, err := cachedDiskUsage(h.db, refresh)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, u)
+}
+
+// maintenanceResult is the outcome of maintaining one repository.
+type maintenanceResult struct {
+	RepoID     int64  `json:"repo_id"`
+	Owner      string `json:"owner"`
+	Name       string `json:"name"`
+	SizeBefore int64  `json:"size_before"`
+	SizeAfter  int64  `json:"size_after"`
+	Error      string `json:"error,omitempty"`
+}
+
+// maintainRepos prunes stale worktree records and runs git gc in every ready
+// repository, one at a time.
+func maintainRepos(db *sql.DB) []maintenanceResult {
+	rows, err := db.Query(`SELECT id, owner, name, local_path FROM repositories WHERE clone_status = 'ready' AND local_path != '' ORDER BY id`)
+	if err != nil {
+		log.Printf("repo maintenance: %v", err)
+		return nil
+	}
+	var repos []repoUsage
+	for rows.Next() {
+		var r repoUsage
+		if rows.Scan(&r.ID, &r.Owner, &r.Name, &r.LocalPath) == nil {
+			repos = append(repos, r)
+		}
+	}
+	rows.Close()
+
+	results := []maintenanceResult{}
+	for _, r := range repos {
+		res := maintenanceResult{RepoID: r.ID, Owner: r.Owner, Name: r.Name, SizeBefore: dirSize(r.LocalPath)}
+		err := git.PruneWorktrees(r.LocalPath)
+		if err == nil {
+			err = git.GC(r.LocalPath)
+		}
+		if err != nil {
+			res.Error = err.Error()
+			log.Printf("repo maintenance: %s/%s: %v", r.Owner, r.Name, err)
+		}
+		res.SizeAfter = dirSize(r.LocalPath)
+		results = append(results, res)
+	}
+	return results
+}
+
+// HandleMaintenance runs repository maintenance now and returns the results.
+func (h *UsageHandler) HandleMaintenance(w http.ResponseWriter, r *http.Request) {
+	results := maintainRepos(h.db)
+	cachedDiskUsage(h.db, true)
+	WriteJSON(w, http.StatusOK, results)
+}
+
+// RunRepoMaintenance runs maintainRepos every maintenance_interval_hours
+// (default 24; 0 disables it), starting one interval after the server
+// starts. The setting is re-read hourly. It never returns.
+func RunRepoMaintenance(db *sql.DB) {
+	last := time.Now()
+	for {
+		time.Sleep(time.Hour)
+		hours := 24
+		if v := settingValue(db, "maintenance_interval_hours"); v != "" {
+			hours, _ = strconv.Atoi(v)
+		}
+		if hours <= 0 || time.Since(last) < time.Duration(hours)*time.Hour {
+			continue
+		}
+		results := maintainRepos(db)
+		log.Printf("repo maintenance: maintained %d repositories", len(results))
+		last = time.Now()
+	}
+}
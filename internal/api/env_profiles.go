@@ -0,0 +1,355 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peterje/superposition/internal/secrets"
+)
+
+// EnvProfilesHandler manages env profiles: named sets of env vars applied to
+// every session, or to every session of one repository, when its CLI starts.
+type EnvProfilesHandler struct {
+	db *sql.DB
+}
+
+func NewEnvProfilesHandler(db *sql.DB) *EnvProfilesHandler {
+	return &EnvProfilesHandler{db: db}
+}
+
+// envProfile is a named set of env vars. Profiles without a RepoID are
+// global. Values may reference secrets as ${secret:NAME}.
+type envProfile struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	RepoID    *int64            `json:"repo_id"`
+	Env       map[string]string `json:"env"`
+	CreatedAt string            `json:"created_at"`
+	UpdatedAt string            `json:"updated_at"`
+}
+
+const envProfileColumns = `id, name, repo_id, env, created_at, updated_at`
+
+// redactedEnvValue stands in for env profile values in API responses, other
+// than values that are just a ${secret:NAME} reference. Saving a profile
+// with it keeps the value already stored for that variable.
+const redactedEnvValue = "<redacted>"
+
+// redacted returns a copy with its values hidden for API responses.
+func (p envProfile) redacted() envProfile {
+	env := make(map[string]string, len(p.Env))
+	for k, v := range p.Env {
+		if secretRefRe.FindString(v) != v {
+			v = redactedEnvValue
+		}
+		env[k] = v
+	}
+	p.Env = env
+	return p
+}
+
+func scanEnvProfile(row interface {
+	Scan(...any) error
+}) (envProfile, error) {
+	var p envProfile
+	var repoID sql.NullInt64
+	var envData string
+	if err := row.Scan(&p.ID, &p.Name, &repoID, &envData, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return p, err
+	}
+	if repoID.Valid {
+		p.RepoID = &repoID.Int64
+	}
+	envJSON, err := secrets.Decrypt(envData)
+	if err != nil {
+		return p, fmt.Errorf("env profile %s: %w", p.Name, err)
+	}
+	if err := json.Unmarshal([]byte(envJSON), &p.Env); err != nil || p.Env == nil {
+		p.Env = map[string]string{}
+	}
+	return p, nil
+}
+
+// loadEnvProfiles returns the profiles that apply to sessions of repoID:
+// the global ones if global is true, otherwise the repository's own, in name
+// order.
+func loadEnvProfiles(db *sql.DB, repoID int64, global bool) ([]envProfile, error) {
+	query := `SELECT ` + envProfileColumns + ` FROM env_profiles WHERE repo_id = ? ORDER BY name`
+	args := []any{repoID}
+	if global {
+		query = `SELECT ` + envProfileColumns + ` FROM env_profiles WHERE repo_id IS NULL ORDER BY name`
+		args = nil
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []envProfile
+	for rows.Next() {
+		p, err := scanEnvProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// sessionBaseEnv returns the env a session of repoID starts with before its
+// own env vars are applied. Later layers override earlier ones:
+//
+//  1. global env profiles, in name order
+//  2. the repository config's env (repoEnv)
+//  3. the repository's env profiles, in name order
+//
+// The session's own env vars (from its template or PUT /api/sessions/{id}/env)
+// are applied on top by startSessionProcess. Secret references are left
+// unresolved.
+func sessionBaseEnv(db *sql.DB, repoID int64, repoEnv map[string]string) (map[string]string, error) {
+	global, err := loadEnvProfiles(db, repoID, true)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := loadEnvProfiles(db, repoID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+	for _, p := range global {
+		for k, v := range p.Env {
+			env[k] = v
+		}
+	}
+	for k, v := range repoEnv {
+		env[k] = v
+	}
+	for _, p := range repo {
+		for k, v := range p.Env {
+			env[k] = v
+		}
+	}
+	return env, nil
+}
+
+// sessionEnv returns the env a session's CLI runs with: sessionBaseEnv for
+// its repository and source branch, with the session's own env vars on top
+// and secret references resolved.
+func sessionEnv(db *sql.DB, sessionID string) (map[string]string, error) {
+	var repoID int64
+	var sourceBranch, localPath, defaultBranch string
+	err := db.QueryRow(`SELECT s.repo_id, s.source_branch, r.local_path, r.default_branch
+		FROM sessions s JOIN repositories r ON r.id = s.repo_id WHERE s.id = ?`, sessionID).
+		Scan(&repoID, &sourceBranch, &localPath, &defaultBranch)
+	if err != nil {
+		return nil, fmt.Errorf("session %s: %w", sessionID, err)
+	}
+	if sourceBranch == "" {
+		sourceBranch = defaultBranch
+	}
+	cfg, err := loadRepoConfig(db, repoID, localPath, sourceBranch)
+	if err != nil {
+		return nil, fmt.Errorf("repository config: %w", err)
+	}
+	env, err := sessionBaseEnv(db, repoID, cfg.Env)
+	if err != nil {
+		return nil, fmt.Errorf("load env profiles: %w", err)
+	}
+	for k, v := range loadSessionEnv(db, sessionID) {
+		env[k] = v
+	}
+	return resolveEnvSecrets(db, env)
+}
+
+func (p envProfile) validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	for k := range p.Env {
+		if !paramNameRe.MatchString(k) {
+			return fmt.Errorf("env: invalid variable name %q", k)
+		}
+	}
+	return nil
+}
+
+// HandleList returns env profiles, global ones first. With ?repo_id=N only
+// the profiles that apply to that repository's sessions are returned.
+func (h *EnvProfilesHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT ` + envProfileColumns + ` FROM env_profiles ORDER BY repo_id IS NOT NULL, repo_id, name`
+	var args []any
+	if raw := r.URL.Query().Get("repo_id"); raw != "" {
+		repoID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid repo_id")
+			return
+		}
+		query = `SELECT ` + envProfileColumns + ` FROM env_profiles WHERE repo_id IS NULL OR repo_id = ?
+			ORDER BY repo_id IS NOT NULL, name`
+		args = append(args, repoID)
+	}
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	result := []envProfile{}
+	for rows.Next() {
+		p, err := scanEnvProfile(rows)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		result = append(result, p.redacted())
+	}
+	WriteJSON(w, http.StatusOK, result)
+}
+
+// HandleGet returns a single env profile.
+func (h *EnvProfilesHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	p, err := scanEnvProfile(h.db.QueryRow(`SELECT `+envProfileColumns+` FROM env_profiles WHERE id = ?`, r.PathValue("id")))
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "env profile not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, p.redacted())
+}
+
+// HandleCreate creates an env profile.
+func (h *EnvProfilesHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	h.save(w, r, 0)
+}
+
+// HandleUpdate replaces an env profile. Running sessions keep their env
+// until their CLI is restarted.
+func (h *EnvProfilesHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	h.save(w, r, id)
+}
+
+func (h *EnvProfilesHandler) save(w http.ResponseWriter, r *http.Request, id int64) {
+	var body envProfile
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if err := body.validate(); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.RepoID != nil {
+		var exists int
+		if err := h.db.QueryRow(`SELECT 1 FROM repositories WHERE id = ?`, *body.RepoID).Scan(&exists); err != nil {
+			WriteError(w, http.StatusBadRequest, "repository not found")
+			return
+		}
+	}
+	if body.Env == nil {
+		body.Env = map[string]string{}
+	}
+	if err := h.keepRedactedValues(id, body.Env); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	envJSON, _ := json.Marshal(body.Env)
+	envData, err := secrets.Encrypt(string(envJSON))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	status := http.StatusOK
+	if id == 0 {
+		res, err := h.db.Exec(`INSERT INTO env_profiles (name, repo_id, env, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			body.Name, body.RepoID, envData, now, now)
+		if err != nil {
+			writeEnvProfileError(w, err)
+			return
+		}
+		id, _ = res.LastInsertId()
+		status = http.StatusCreated
+	} else {
+		res, err := h.db.Exec(`UPDATE env_profiles SET name = ?, repo_id = ?, env = ?, updated_at = ? WHERE id = ?`,
+			body.Name, body.RepoID, envData, now, id)
+		if err != nil {
+			writeEnvProfileError(w, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			WriteError(w, http.StatusNotFound, "env profile not found")
+			return
+		}
+	}
+
+	p, err := scanEnvProfile(h.db.QueryRow(`SELECT `+envProfileColumns+` FROM env_profiles WHERE id = ?`, id))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, status, p.redacted())
+}
+
+// keepRedactedValues replaces redactedEnvValue in env with the values stored
+// in profile id, as sent back by a client that edited a redacted profile.
+func (h *EnvProfilesHandler) keepRedactedValues(id int64, env map[string]string) error {
+	stored := map[string]string{}
+	for k, v := range env {
+		if v != redactedEnvValue {
+			continue
+		}
+		if id != 0 && len(stored) == 0 {
+			p, err := scanEnvProfile(h.db.QueryRow(`SELECT `+envProfileColumns+` FROM env_profiles WHERE id = ?`, id))
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			stored = p.Env
+		}
+		old, ok := stored[k]
+		if !ok {
+			return fmt.Errorf("env: %s has no stored value to keep", k)
+		}
+		env[k] = old
+	}
+	return nil
+}
+
+func writeEnvProfileError(w http.ResponseWriter, err error) {
+	if strings.Contains(err.Error(), "UNIQUE") {
+		WriteError(w, http.StatusConflict, "an env profile with this name already exists")
+		return
+	}
+	WriteError(w, http.StatusInternalServerError, err.Error())
+}
+
+// HandleDelete deletes an env profile and returns 204.
+func (h *EnvProfilesHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	res, err := h.db.Exec(`DELETE FROM env_profiles WHERE id = ?`, r.PathValue("id"))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		WriteError(w, http.StatusNotFound, "env profile not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,18 +4,25 @@ import (
 	"database/sql"
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
+
+	ptymgr "github.com/peterje/superposition/internal/pty"
+	"github.com/peterje/superposition/internal/secrets"
 )
 
 type EnvVarsHandler struct {
-	db *sql.DB
+	db       *sql.DB
+	manager  ptymgr.SessionManager
+	webhooks *WebhooksHandler
 }
 
-func NewEnvVarsHandler(db *sql.DB) *EnvVarsHandler {
-	return &EnvVarsHandler{db: db}
+func NewEnvVarsHandler(db *sql.DB, manager ptymgr.SessionManager, webhooks *WebhooksHandler) *EnvVarsHandler {
+	return &EnvVarsHandler{db: db, manager: manager, webhooks: webhooks}
 }
 
-// HandleGet returns all env vars for a session.
+// HandleGet returns all env vars for a session. Values are stored encrypted;
+// ${secret:NAME} references are returned as written, not resolved.
 func (h *EnvVarsHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.PathValue("id")
 
@@ -32,15 +39,27 @@ func (h *EnvVarsHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
 		if err := rows.Scan(&k, &v); err != nil {
 			continue
 		}
-		result[k] = v
+		plain, err := secrets.Decrypt(v)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "env var "+k+": "+err.Error())
+			return
+		}
+		result[k] = plain
 	}
 
 	WriteJSON(w, http.StatusOK, result)
 }
 
-// HandlePut replaces all env vars for a session.
+// HandlePut replaces all env vars for a session. The running CLI keeps its
+// old environment unless ?restart=true is given, which restarts it in place
+// with the new one.
 func (h *EnvVarsHandler) HandlePut(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.PathValue("id")
+	restart := r.URL.Query().Get("restart") == "true"
+	if restart && h.manager.Get(sessionID) == nil {
+		WriteError(w, http.StatusConflict, "session is not running")
+		return
+	}
 
 	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
 	if err != nil {
@@ -69,7 +88,12 @@ func (h *EnvVarsHandler) HandlePut(w http.ResponseWriter, r *http.Request) {
 
 	// Insert new
 	for k, v := range envVars {
-		if _, err := tx.Exec(`INSERT INTO session_env (session_id, key, value) VALUES (?, ?, ?)`, sessionID, k, v); err != nil {
+		enc, err := secrets.Encrypt(v)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "failed to encrypt env var")
+			return
+		}
+		if _, err := tx.Exec(`INSERT INTO session_env (session_id, key, value) VALUES (?, ?, ?)`, sessionID, k, enc); err != nil {
 			WriteError(w, http.StatusInternalServerError, "failed to insert env var")
 			return
 		}
@@ -80,5 +104,15 @@ func (h *EnvVarsHandler) HandlePut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if restart {
+		var cliType string
+		h.db.QueryRow(`SELECT cli_type FROM sessions WHERE id = ?`, sessionID).Scan(&cliType)
+		if _, _, err := restartSessionProcess(h.db, h.manager, h.webhooks, sessionID, cliType, false, nil); err != nil {
+			writeSessionError(w, err)
+			return
+		}
+		log.Printf("Session %s restarted with new env", sessionID)
+	}
+
 	WriteJSON(w, http.StatusOK, envVars)
 }
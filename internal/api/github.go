@@ -0,0 +1,50 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/peterje/superposition/internal/github"
+)
+
+// githubClients keeps one client per API URL and token so the ETag cache
+// and rate limit state survive across requests.
+var githubClients = struct {
+	sync.Mutex
+	clients map[string]*github.Client
+}{clients: map[string]*github.Client{}}
+
+// githubClient returns a GitHub API client using the stored PAT and the
+// github_api_url setting (for GitHub Enterprise or a local fake server).
+func githubClient(db *sql.DB) (*github.Client, error) {
+	pat := githubPAT(db)
+	if pat == "" {
+		return nil, fmt.Errorf("GitHub PAT not configured")
+	}
+	baseURL := settingValue(db, "github_api_url")
+
+	key := baseURL + "\x00" + pat
+	githubClients.Lock()
+	defer githubClients.Unlock()
+	c, ok := githubClients.clients[key]
+	if !ok {
+		c = github.NewClient(baseURL, pat)
+		githubClients.clients[key] = c
+	}
+	return c, nil
+}
+
+// githubRepo returns the GitHub owner and name of a repository, or an error
+// if it isn't a GitHub repository.
+func githubRepo(db *sql.DB, repoID int64) (string, string, error) {
+	var owner, name, repoType string
+	if err := db.QueryRow(`SELECT owner, name, repo_type FROM repositories WHERE id = ?`, repoID).
+		Scan(&owner, &name, &repoType); err != nil {
+		return "", "", err
+	}
+	if repoType != "github" {
+		return "", "", fmt.Errorf("not a GitHub repository")
+	}
+	return owner, name, nil
+}
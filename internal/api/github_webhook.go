@@ -0,0 +1,267 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peterje/superposition/internal/models"
+	ptymgr "github.com/peterje/superposition/internal/pty"
+)
+
+// maxGitHubWebhookBody caps inbound GitHub deliveries; GitHub itself caps
+// payloads at 25MB but the events handled here are far smaller.
+const maxGitHubWebhookBody = 5 << 20
+
+// GitHubWebhookHandler receives webhook deliveries from GitHub and turns the
+// events it understands into internal events for triggers:
+//
+//	github.issue.labeled.<label>    an issue was labeled
+//	github.pr.command.<command>     a PR comment starting with "/<command>"
+//	github.push                     a push to the repo's default branch
+//
+// Labels and commands are part of the event name so triggers can match them
+// with an exact or prefix pattern. Commands are only accepted from the
+// repository's owner, members and collaborators; labels can only be applied
+// by users GitHub gives triage access. The event data only holds identifiers
+// (numbers, URLs, the label, branch and SHAs): titles, comment text and
+// commit messages can be written by anyone and would reach workflow steps.
+// Deliveries must be signed with the github_webhook_secret setting, and a
+// delivery seen in the last recentDeliveryTTL is not handled again. If
+// github_webhook_sync is "true", a push to any branch also fetches the
+// matching repository.
+type GitHubWebhookHandler struct {
+	db       *sql.DB
+	manager  ptymgr.SessionManager
+	webhooks *WebhooksHandler
+}
+
+func NewGitHubWebhookHandler(db *sql.DB, manager ptymgr.SessionManager, webhooks *WebhooksHandler) *GitHubWebhookHandler {
+	return &GitHubWebhookHandler{db: db, manager: manager, webhooks: webhooks}
+}
+
+// gitHubEvent holds the parts of GitHub webhook payloads used here.
+type gitHubEvent struct {
+	Action     string `json:"action"`
+	Ref        string `json:"ref"`
+	Before     string `json:"before"`
+	After      string `json:"after"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+	Label struct {
+		Name string `json:"name"`
+	} `json:"label"`
+	Issue struct {
+		Number      int    `json:"number"`
+		HTMLURL     string `json:"html_url"`
+		PullRequest *struct {
+			URL string `json:"url"`
+		} `json:"pull_request"`
+	} `json:"issue"`
+	Comment struct {
+		Body              string `json:"body"`
+		HTMLURL           string `json:"html_url"`
+		AuthorAssociation string `json:"author_association"`
+	} `json:"comment"`
+}
+
+// verifyGitHubSignature checks an X-Hub-Signature-256 header against body.
+func verifyGitHubSignature(secret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// trustedAssociations are the author_association values whose comments may
+// run commands.
+var trustedAssociations = map[string]bool{"OWNER": true, "MEMBER": true, "COLLABORATOR": true}
+
+// commandRe matches the command names accepted in PR comments.
+var commandRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// parseCommentCommand returns the command of a comment whose first line
+// starts with "/", e.g. "/fix the tests" gives "fix". Anything after the
+// command is ignored.
+func parseCommentCommand(body string) (string, bool) {
+	line, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "/") {
+		return "", false
+	}
+	command, _, _ := strings.Cut(line[1:], " ")
+	command = strings.ToLower(command)
+	if !commandRe.MatchString(command) {
+		return "", false
+	}
+	return command, true
+}
+
+// recentDeliveryTTL is how long a delivery is remembered, so that GitHub
+// redelivering it, or someone replaying a captured one, doesn't fire
+// triggers twice.
+const recentDeliveryTTL = 72 * time.Hour
+
+// recentDeliveries holds the X-GitHub-Delivery IDs and body digests of the
+// deliveries handled within recentDeliveryTTL. The delivery ID header isn't
+// covered by the signature, so a replay is also recognised by its body.
+var recentDeliveries = struct {
+	sync.Mutex
+	seen map[string]time.Time
+}{seen: map[string]time.Time{}}
+
+// seenDelivery records a delivery and reports whether it had been seen.
+func seenDelivery(id string, body []byte) bool {
+	sum := sha256.Sum256(body)
+	keys := []string{"body:" + hex.EncodeToString(sum[:])}
+	if id != "" {
+		keys = append(keys, "id:"+id)
+	}
+
+	recentDeliveries.Lock()
+	defer recentDeliveries.Unlock()
+	now := time.Now()
+	for key, at := range recentDeliveries.seen {
+		if now.Sub(at) > recentDeliveryTTL {
+			delete(recentDeliveries.seen, key)
+		}
+	}
+	seen := false
+	for _, key := range keys {
+		if _, ok := recentDeliveries.seen[key]; ok {
+			seen = true
+		}
+		recentDeliveries.seen[key] = now
+	}
+	return seen
+}
+
+// HandleWebhook serves POST /api/github/webhook.
+func (h *GitHubWebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	secret := settingValue(h.db, "github_webhook_secret")
+	if secret == "" {
+		WriteError(w, http.StatusServiceUnavailable, "github_webhook_secret is not configured")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGitHubWebhookBody))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if !verifyGitHubSignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		WriteError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	if seenDelivery(r.Header.Get("X-GitHub-Delivery"), body) {
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ignored", "reason": "duplicate delivery"})
+		return
+	}
+
+	kind := r.Header.Get("X-GitHub-Event")
+	if kind == "ping" {
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "pong"})
+		return
+	}
+
+	var ev gitHubEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	owner, name, _ := strings.Cut(ev.Repository.FullName, "/")
+	var repo models.Repository
+	err = h.db.QueryRow(`SELECT id, local_path, clone_status, repo_type, default_branch FROM repositories
+		WHERE owner = ? COLLATE NOCASE AND name = ? COLLATE NOCASE AND repo_type = 'github'`, owner, name).
+		Scan(&repo.ID, &repo.LocalPath, &repo.CloneStatus, &repo.RepoType, &repo.DefaultBranch)
+	if err == sql.ErrNoRows {
+		WriteJSON(w, http.StatusAccepted, map[string]string{"status": "ignored", "reason": "unknown repository"})
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	data := map[string]any{
+		"repo_id": repo.ID,
+		"repo":    ev.Repository.FullName,
+		"sender":  ev.Sender.Login,
+	}
+	var event string
+
+	switch kind {
+	case "issues":
+		if ev.Action == "labeled" && ev.Issue.PullRequest == nil && ev.Label.Name != "" {
+			event = "github.issue.labeled." + ev.Label.Name
+			data["label"] = ev.Label.Name
+			data["issue_number"] = ev.Issue.Number
+			data["issue_url"] = ev.Issue.HTMLURL
+		}
+	case "issue_comment":
+		if ev.Action != "created" || ev.Issue.PullRequest == nil {
+			break
+		}
+		if !trustedAssociations[ev.Comment.AuthorAssociation] {
+			if _, ok := parseCommentCommand(ev.Comment.Body); ok {
+				log.Printf("github webhook: ignoring command from %s (%s) on repo %d", ev.Sender.Login, ev.Comment.AuthorAssociation, repo.ID)
+			}
+			break
+		}
+		if command, ok := parseCommentCommand(ev.Comment.Body); ok {
+			event = "github.pr.command." + command
+			data["command"] = command
+			data["pr_number"] = ev.Issue.Number
+			data["comment_url"] = ev.Comment.HTMLURL
+		}
+	case "push":
+		branch, isBranch := strings.CutPrefix(ev.Ref, "refs/heads/")
+		if isBranch && repo.CloneStatus == "ready" && h.autoSync() {
+			go func() {
+				if _, _, err := syncRepo(h.db, h.webhooks, repo); err != nil {
+					log.Printf("github webhook: sync repo %d failed: %v", repo.ID, err)
+				}
+			}()
+		}
+		if isBranch && branch == repo.DefaultBranch {
+			event = "github.push"
+			data["branch"] = branch
+			data["before"] = ev.Before
+			data["after"] = ev.After
+		}
+	}
+
+	if event == "" {
+		WriteJSON(w, http.StatusAccepted, map[string]string{"status": "ignored"})
+		return
+	}
+
+	log.Printf("github webhook: %s for repo %d", event, repo.ID)
+	go CheckAndFireTriggers(h.db, h.manager, event, "", data)
+	WriteJSON(w, http.StatusAccepted, map[string]string{"status": "accepted", "event": event})
+}
+
+func (h *GitHubWebhookHandler) autoSync() bool {
+	return settingValue(h.db, "github_webhook_sync") == "true"
+}
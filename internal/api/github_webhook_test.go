@@ -0,0 +1,37 @@
+package api
+
+import "testing"
+
+func TestSeenDelivery(t *testing.T) {
+	if seenDelivery("d1", []byte(`{"a":1}`)) {
+		t.Fatal("first delivery reported as seen")
+	}
+	if !seenDelivery("d1", []byte(`{"a":1}`)) {
+		t.Error("redelivery not reported as seen")
+	}
+	if !seenDelivery("d2", []byte(`{"a":1}`)) {
+		t.Error("replayed body with a new delivery ID not reported as seen")
+	}
+	if seenDelivery("d3", []byte(`{"a":2}`)) {
+		t.Error("new delivery reported as seen")
+	}
+}
+
+func TestParseCommentCommand(t *testing.T) {
+	tests := []struct {
+		body, want string
+		ok         bool
+	}{
+		{"/Fix the tests\nmore", "fix", true},
+		{"  /review", "review", true},
+		{"please /fix", "", false},
+		{"/$(id)", "", false},
+		{"/", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parseCommentCommand(tt.body)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseCommentCommand(%q) = %q, %v; want %q, %v", tt.body, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -1,42 +1,81 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // WriteSessionMCPConfig writes the .mcp.json for a regular coding session.
 // Called at session creation and during re-adoption on server restart.
+// Servers already in the file other than the forge-* ones (from the repo, the
+// MCP config UI or repo settings) are preserved.
 func WriteSessionMCPConfig(sessionID, worktreePath string) {
-	mcpConfig := fmt.Sprintf(`{
-  "mcpServers": {
-    "forge-notepad": {
-      "type": "stdio",
-      "command": "node",
-      "args": ["/opt/superposition/mcp/notepad-server.js"],
-      "env": {
-        "FORGE_SESSION_ID": "%s",
-        "FORGE_API_URL": "http://localhost:8800"
-      }
-    },
-    "forge-ui": {
-      "type": "stdio",
-      "command": "node",
-      "args": ["/opt/superposition/mcp/a2ui-server.js"],
-      "env": {
-        "FORGE_SESSION_ID": "%s",
-        "FORGE_API_URL": "http://localhost:8800"
-      }
-    }
-  }
-}`, sessionID, sessionID)
-	if err := os.WriteFile(filepath.Join(worktreePath, ".mcp.json"), []byte(mcpConfig), 0644); err != nil {
+	servers := readMCPServers(worktreePath)
+	for name := range servers {
+		if strings.HasPrefix(name, "forge-") {
+			delete(servers, name)
+		}
+	}
+	for name, script := range map[string]string{
+		"forge-notepad": "notepad-server.js",
+		"forge-ui":      "a2ui-server.js",
+	} {
+		servers[name] = map[string]any{
+			"type":    "stdio",
+			"command": "node",
+			"args":    []string{"/opt/superposition/mcp/" + script},
+			"env": map[string]string{
+				"FORGE_SESSION_ID": sessionID,
+				"FORGE_API_URL":    "http://localhost:8800",
+			},
+		}
+	}
+	if err := writeMCPServers(worktreePath, servers); err != nil {
 		log.Printf("Failed to write .mcp.json for session %s: %v", sessionID, err)
 	}
 }
 
+// addMCPServers merges extra servers into a worktree's .mcp.json.
+func addMCPServers(worktreePath string, extra map[string]any) error {
+	if len(extra) == 0 {
+		return nil
+	}
+	servers := readMCPServers(worktreePath)
+	for name, cfg := range extra {
+		servers[name] = cfg
+	}
+	return writeMCPServers(worktreePath, servers)
+}
+
+// readMCPServers returns the mcpServers of a directory's .mcp.json, or an
+// empty map if there is no valid file.
+func readMCPServers(dir string) map[string]any {
+	servers := map[string]any{}
+	data, err := os.ReadFile(filepath.Join(dir, ".mcp.json"))
+	if err != nil {
+		return servers
+	}
+	var config struct {
+		MCPServers map[string]any `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil || config.MCPServers == nil {
+		return servers
+	}
+	return config.MCPServers
+}
+
+func writeMCPServers(dir string, servers map[string]any) error {
+	data, err := json.MarshalIndent(map[string]any{"mcpServers": servers}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ".mcp.json"), data, 0644)
+}
+
 // WriteOrchestratorMCPConfig writes the .mcp.json for an orchestrator session.
 // Called at orchestrator creation and during re-adoption on server restart.
 func WriteOrchestratorMCPConfig(sessionID, workDir string) {
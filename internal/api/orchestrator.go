@@ -128,7 +128,7 @@ func (h *OrchestratorHandler) HandleStop(w http.ResponseWriter, r *http.Request)
 // live-terminal snippet where available.
 func (h *OrchestratorHandler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
 	rows, err := h.db.Query(`
-		SELECT s.id, s.repo_id, s.worktree_path, s.branch, s.cli_type, s.status, s.pid, s.created_at,
+		SELECT s.id, s.repo_id, s.worktree_path, s.branch, s.cli_type, s.status, s.pid, s.batch_id, s.created_at,
 		       r.owner, r.name
 		FROM sessions s
 		JOIN repositories r ON s.repo_id = r.id
@@ -140,14 +140,15 @@ func (h *OrchestratorHandler) HandleListSessions(w http.ResponseWriter, r *http.
 	defer rows.Close()
 
 	type sessionSummary struct {
-		ID        string `json:"id"`
-		RepoOwner string `json:"repo_owner"`
-		RepoName  string `json:"repo_name"`
-		Branch    string `json:"branch"`
-		CLIType   string `json:"cli_type"`
-		Status    string `json:"status"`
-		Snippet   string `json:"snippet"`
-		CreatedAt string `json:"created_at"`
+		ID        string  `json:"id"`
+		RepoOwner string  `json:"repo_owner"`
+		RepoName  string  `json:"repo_name"`
+		Branch    string  `json:"branch"`
+		CLIType   string  `json:"cli_type"`
+		Status    string  `json:"status"`
+		BatchID   *string `json:"batch_id"`
+		Snippet   string  `json:"snippet"`
+		CreatedAt string  `json:"created_at"`
 	}
 
 	result := []sessionSummary{}
@@ -158,7 +159,7 @@ func (h *OrchestratorHandler) HandleListSessions(w http.ResponseWriter, r *http.
 		var pid sql.NullInt64
 		if err := rows.Scan(
 			&s.ID, &repoID, &worktreePath, &s.Branch, &s.CLIType,
-			&s.Status, &pid, &s.CreatedAt, &s.RepoOwner, &s.RepoName,
+			&s.Status, &pid, &s.BatchID, &s.CreatedAt, &s.RepoOwner, &s.RepoName,
 		); err != nil {
 			WriteError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/peterje/superposition/internal/git"
+	"github.com/peterje/superposition/internal/provider"
+	"github.com/peterje/superposition/internal/secrets"
+)
+
+// providerTokenSettings names the setting holding each provider's API token,
+// which is also used for HTTPS git access to its repositories.
+var providerTokenSettings = map[string]string{
+	provider.GitHub: "github_pat",
+	provider.GitLab: "gitlab_token",
+	provider.Gitea:  "gitea_token",
+}
+
+// providerURLSettings names the setting holding each provider's instance
+// URL. GitHub's is the API URL; GitLab's and Gitea's are the web URL.
+var providerURLSettings = map[string]string{
+	provider.GitHub: "github_api_url",
+	provider.GitLab: "gitlab_url",
+	provider.Gitea:  "gitea_url",
+}
+
+// providerClients keeps one client per provider, URL and token, like
+// githubClients.
+var providerClients = struct {
+	sync.Mutex
+	clients map[string]provider.Provider
+}{clients: map[string]provider.Provider{}}
+
+// providerClient returns an API client for a provider using its token and
+// URL settings.
+func providerClient(db *sql.DB, repoType string) (provider.Provider, error) {
+	if repoType == provider.GitHub {
+		return githubClient(db)
+	}
+	if !provider.HasAPI(repoType) {
+		return nil, fmt.Errorf("%s repositories have no provider API", repoType)
+	}
+	token := settingValue(db, providerTokenSettings[repoType])
+	if token == "" {
+		return nil, fmt.Errorf("%s not configured", providerTokenSettings[repoType])
+	}
+	baseURL := settingValue(db, providerURLSettings[repoType])
+	if repoType == provider.Gitea && baseURL == "" {
+		return nil, fmt.Errorf("gitea_url not configured")
+	}
+
+	key := repoType + "\x00" + baseURL + "\x00" + token
+	providerClients.Lock()
+	defer providerClients.Unlock()
+	c, ok := providerClients.clients[key]
+	if !ok {
+		if repoType == provider.GitLab {
+			c = provider.NewGitLab(baseURL, token)
+		} else {
+			c = provider.NewGitea(baseURL, token)
+		}
+		providerClients.clients[key] = c
+	}
+	return c, nil
+}
+
+// repoProvider returns the provider API client and the owner and name of a
+// repository, or an error if it isn't hosted on a supported provider.
+func repoProvider(db *sql.DB, repoID int64) (provider.Provider, string, string, error) {
+	var owner, name, repoType string
+	if err := db.QueryRow(`SELECT owner, name, repo_type FROM repositories WHERE id = ?`, repoID).
+		Scan(&owner, &name, &repoType); err != nil {
+		return nil, "", "", err
+	}
+	client, err := providerClient(db, repoType)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return client, owner, name, nil
+}
+
+// repoGitAuth returns the credentials git needs for a repository's SSH
+// remote: its own key if set, otherwise the git_ssh_key setting. HTTPS
+// credentials are supplied by the credential helper; see GitCredential.
+func repoGitAuth(db *sql.DB, repoID int64) git.Auth {
+	var repoType, cloneURL, sshKey string
+	err := db.QueryRow(`SELECT repo_type, clone_url, ssh_key_path FROM repositories WHERE id = ?`, repoID).
+		Scan(&repoType, &cloneURL, &sshKey)
+	if err != nil || repoType == provider.Local || !git.IsSSHURL(cloneURL) {
+		return git.Auth{}
+	}
+	if sshKey == "" {
+		sshKey = settingValue(db, "git_ssh_key")
+	}
+	return git.Auth{SSHKey: sshKey}
+}
+
+// GitCredential returns the username and token for the HTTPS remote at
+// host (with port, if any) and path, as asked for by the git credential
+// helper: the repository's own credentials if set, otherwise its provider's
+// token.
+func GitCredential(db *sql.DB, host, urlPath string) (string, string, bool) {
+	rows, err := db.Query(`SELECT repo_type, clone_url, auth_username, auth_token FROM repositories
+		WHERE repo_type != 'local' AND clone_url != ''`)
+	if err != nil {
+		return "", "", false
+	}
+	defer rows.Close()
+
+	want := strings.TrimSuffix(strings.Trim(urlPath, "/"), ".git")
+	for rows.Next() {
+		var repoType, cloneURL, username, token string
+		if err := rows.Scan(&repoType, &cloneURL, &username, &token); err != nil {
+			continue
+		}
+		u, err := url.Parse(cloneURL)
+		if err != nil || !strings.EqualFold(u.Host, host) ||
+			strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git") != want {
+			continue
+		}
+		if token, err = secrets.Decrypt(token); err != nil {
+			log.Printf("git credential: repository %s: %v", cloneURL, err)
+			return "", "", false
+		}
+		if token != "" {
+			if username == "" {
+				username = provider.GitUsername(repoType)
+			}
+			return username, token, true
+		}
+		if setting, ok := providerTokenSettings[repoType]; ok {
+			if token := settingValue(db, setting); token != "" {
+				return provider.GitUsername(repoType), token, true
+			}
+		}
+		return "", "", false
+	}
+	return "", "", false
+}
+
+// parseRemoteURL splits an HTTPS or SSH remote URL into its host and
+// repository path without a .git suffix, e.g. "git@host:group/repo.git"
+// gives ("host", "group/repo").
+func parseRemoteURL(rawURL string) (string, string, error) {
+	var host, p string
+	if git.IsSSHURL(rawURL) && !strings.Contains(rawURL, "://") {
+		userHost, rest, _ := strings.Cut(rawURL, ":")
+		_, host, _ = strings.Cut(userHost, "@")
+		p = rest
+	} else {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid URL: %w", err)
+		}
+		switch u.Scheme {
+		case "https", "http", "ssh", "git+ssh":
+		default:
+			return "", "", fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+		}
+		host, p = u.Hostname(), u.Path
+	}
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	if host == "" || !strings.Contains(p, "/") {
+		return "", "", fmt.Errorf("invalid remote URL: need host and owner/name")
+	}
+	return strings.ToLower(host), p, nil
+}
+
+// detectProvider guesses a remote's provider from its host: github.com,
+// or the host of the gitlab_url (default gitlab.com) or gitea_url setting.
+// Anything else is a plain git remote.
+func detectProvider(db *sql.DB, host string) string {
+	if host == "github.com" {
+		return provider.GitHub
+	}
+	gitlabURL := settingValue(db, "gitlab_url")
+	if gitlabURL == "" {
+		gitlabURL = provider.DefaultGitLabURL
+	}
+	if u, err := url.Parse(gitlabURL); err == nil && strings.EqualFold(u.Hostname(), host) {
+		return provider.GitLab
+	}
+	if u, err := url.Parse(settingValue(db, "gitea_url")); err == nil && u.Hostname() != "" && strings.EqualFold(u.Hostname(), host) {
+		return provider.Gitea
+	}
+	return provider.Git
+}
+
+// remoteRepo describes a repository to clone from a remote URL.
+type remoteRepo struct {
+	URL        string `json:"url"`
+	Provider   string `json:"provider"`
+	Username   string `json:"username"`
+	Token      string `json:"token"`
+	SSHKeyPath string `json:"ssh_key_path"`
+}
+
+// resolve validates the remote and returns its provider, the owner and name
+// to record, and the directory under the repos dir to clone into.
+func (rr remoteRepo) resolve(db *sql.DB) (repoType, owner, name, dir string, err error) {
+	host, p, err := parseRemoteURL(rr.URL)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	repoType = rr.Provider
+	if repoType == "" {
+		repoType = detectProvider(db, host)
+	}
+	if !provider.HasAPI(repoType) && repoType != provider.Git {
+		return "", "", "", "", fmt.Errorf("provider must be 'github', 'gitlab', 'gitea' or 'git'")
+	}
+	if git.IsSSHURL(rr.URL) {
+		if rr.Token != "" {
+			return "", "", "", "", fmt.Errorf("token is only used with HTTPS remotes")
+		}
+		if rr.SSHKeyPath != "" {
+			if _, err := os.Stat(rr.SSHKeyPath); err != nil {
+				return "", "", "", "", fmt.Errorf("ssh_key_path: %w", err)
+			}
+		}
+	} else if rr.SSHKeyPath != "" {
+		return "", "", "", "", fmt.Errorf("ssh_key_path is only used with SSH remotes")
+	}
+	owner, name = path.Dir(p), path.Base(p)
+	return repoType, owner, name, path.Join(host, owner), nil
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/peterje/superposition/internal/git"
+)
+
+// cloneJob is a repository clone in progress: the latest progress git
+// reported, the event streams following it, and how to cancel it.
+type cloneJob struct {
+	repoID int64
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu          sync.Mutex
+	progress    git.CloneProgress
+	finished    bool
+	subscribers map[chan runEvent]struct{}
+}
+
+// activeClones tracks clones that are still running so their progress can
+// be reported and they can be cancelled. Finished clones are described by
+// the repository row.
+var activeClones = struct {
+	sync.Mutex
+	jobs map[int64]*cloneJob
+}{jobs: map[int64]*cloneJob{}}
+
+// startCloneJob registers a clone of a repository as active. The clone runs
+// with the returned context and reports to the job with update and finish.
+func startCloneJob(repoID int64) (*cloneJob, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &cloneJob{
+		repoID:      repoID,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		subscribers: map[chan runEvent]struct{}{},
+	}
+	activeClones.Lock()
+	activeClones.jobs[repoID] = job
+	activeClones.Unlock()
+	return job, ctx
+}
+
+func getCloneJob(repoID int64) *cloneJob {
+	activeClones.Lock()
+	defer activeClones.Unlock()
+	return activeClones.jobs[repoID]
+}
+
+// update records the clone's progress and streams it to subscribers.
+func (job *cloneJob) update(p git.CloneProgress) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.progress = p
+	for ch := range job.subscribers {
+		select {
+		case ch <- runEvent{Event: "progress", Data: p}:
+		default:
+			// Slow subscriber, drop event
+		}
+	}
+}
+
+func (job *cloneJob) snapshot() git.CloneProgress {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.progress
+}
+
+// subscribe returns the progress so far and a channel of subsequent events.
+// The channel is closed when the clone finishes.
+func (job *cloneJob) subscribe() (git.CloneProgress, <-chan runEvent, func()) {
+	ch := make(chan runEvent, 64)
+	job.mu.Lock()
+	progress := job.progress
+	if job.finished {
+		close(ch)
+	} else {
+		job.subscribers[ch] = struct{}{}
+	}
+	job.mu.Unlock()
+
+	unsub := func() {
+		job.mu.Lock()
+		delete(job.subscribers, ch)
+		job.mu.Unlock()
+	}
+	return progress, ch, unsub
+}
+
+// finish sends subscribers the clone's final status ("ready", "error" or
+// "cancelled") and removes it from the active set.
+func (job *cloneJob) finish(status, errMsg string) {
+	job.mu.Lock()
+	job.finished = true
+	for ch := range job.subscribers {
+		select {
+		case ch <- runEvent{Event: "status", Data: map[string]string{"status": status, "error": errMsg}}:
+		default:
+		}
+		close(ch)
+		delete(job.subscribers, ch)
+	}
+	job.mu.Unlock()
+
+	activeClones.Lock()
+	delete(activeClones.jobs, job.repoID)
+	activeClones.Unlock()
+	job.cancel()
+	close(job.done)
+}
+
+// cloneRepo starts cloning a remote repository into dir/name.git under the
+// repos directory, where dir is the owner for GitHub repos added by URL and
+// host/owner otherwise. The clone is registered before cloneRepo returns,
+// so it can be cancelled as soon as the repository row exists.
+func (h *ReposHandler) cloneRepo(id int64, cloneURL, dir, name string, opts git.CloneOptions) {
+	job, ctx := startCloneJob(id)
+	go func() {
+		localPath, err := git.CloneBare(ctx, cloneURL, repoGitAuth(h.db, id), dir, name, opts, job.update)
+		h.finishClone(job, dir+"/"+name, localPath, err)
+	}()
+}
+
+// cloneLocalRepo starts cloning a local repository, as cloneRepo does.
+func (h *ReposHandler) cloneLocalRepo(id int64, sourcePath, name string, opts git.CloneOptions) {
+	job, ctx := startCloneJob(id)
+	go func() {
+		localPath, err := git.CloneBareLocal(ctx, sourcePath, name, opts, job.update)
+		h.finishClone(job, "local repo "+sourcePath, localPath, err)
+	}()
+}
+
+// finishClone records how a clone ended on its repository row and ends its
+// job. A cancelled clone's row is being deleted, so it is left alone.
+func (h *ReposHandler) finishClone(job *cloneJob, label, localPath string, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		log.Printf("Clone of %s cancelled", label)
+		job.finish("cancelled", "")
+	case err != nil:
+		log.Printf("Clone failed for %s: %v", label, err)
+		h.db.Exec(`UPDATE repositories SET clone_status = 'error', clone_error = ? WHERE id = ?`, err.Error(), job.repoID)
+		job.finish("error", err.Error())
+	default:
+		defaultBranch := detectDefaultBranch(localPath)
+		h.db.Exec(`UPDATE repositories SET local_path = ?, clone_status = 'ready', clone_error = '', default_branch = ?, last_synced = ? WHERE id = ?`,
+			localPath, defaultBranch, time.Now(), job.repoID)
+		log.Printf("Cloned %s to %s", label, localPath)
+		if _, err := syncRepoWorkflows(h.db, job.repoID, localPath, defaultBranch); err != nil {
+			log.Printf("Failed to load workflows for %s: %v", label, err)
+		}
+		job.finish("ready", "")
+	}
+}
+
+// cancelClone stops a repository's clone if one is running and waits for
+// it to clean up.
+func cancelClone(repoID int64) {
+	job := getCloneJob(repoID)
+	if job == nil {
+		return
+	}
+	job.cancel()
+	select {
+	case <-job.done:
+	case <-time.After(30 * time.Second):
+		log.Printf("Clone of repo id=%d did not stop after cancel", repoID)
+	}
+}
+
+// HandleCloneEvents streams a repository's clone as server-sent events: the
+// progress so far as a "progress" event, live "progress" events as git
+// reports them, and a final "status" event when the clone finishes. For a
+// repository that isn't cloning only the "status" event is sent.
+func (h *ReposHandler) HandleCloneEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	cloneStatus := func() (runEvent, bool) {
+		var status, errMsg string
+		if err := h.db.QueryRow(`SELECT clone_status, clone_error FROM repositories WHERE id = ?`, id).Scan(&status, &errMsg); err != nil {
+			// Deleted after its clone was cancelled.
+			return runEvent{Event: "status", Data: map[string]string{"status": "cancelled", "error": ""}}, false
+		}
+		return runEvent{Event: "status", Data: map[string]string{"status": status, "error": errMsg}}, true
+	}
+
+	job := getCloneJob(id)
+	if job == nil {
+		ev, ok := cloneStatus()
+		if !ok {
+			WriteError(w, http.StatusNotFound, "repository not found")
+			return
+		}
+		startSSE(w)
+		writeSSE(w, ev)
+		flusher.Flush()
+		return
+	}
+
+	progress, events, unsub := job.subscribe()
+	defer unsub()
+
+	startSSE(w)
+	writeSSE(w, runEvent{Event: "progress", Data: progress})
+	flusher.Flush()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				// Finished before we subscribed, or the status event was
+				// dropped; report the recorded status.
+				final, _ := cloneStatus()
+				writeSSE(w, final)
+				flusher.Flush()
+				return
+			}
+			writeSSE(w, ev)
+			flusher.Flush()
+			if ev.Event == "status" {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/peterje/superposition/internal/git"
+	"github.com/peterje/superposition/internal/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// repoConfigFile is the checked-in per-repository config file.
+const repoConfigFile = ".superposition.yaml"
+
+// repoConfig holds per-repository session defaults. It can come from the
+// repo's .superposition.yaml and from the repo_config table; see mergeRepoConfig.
+type repoConfig struct {
+	CLIType      string            `json:"cli_type,omitempty" yaml:"cli_type"`
+	SourceBranch string            `json:"source_branch,omitempty" yaml:"source_branch"`
+	Env          map[string]string `json:"env,omitempty" yaml:"env"`
+	MCPServers   map[string]any    `json:"mcp_servers,omitempty" yaml:"mcp_servers"`
+	Setup        []string          `json:"setup,omitempty" yaml:"setup"`
+}
+
+func validCLIType(cliType string) bool {
+	return cliType == "claude" || cliType == "codex" || cliType == "gemini"
+}
+
+func (c repoConfig) validate() error {
+	if c.CLIType != "" && !validCLIType(c.CLIType) {
+		return fmt.Errorf("cli_type must be 'claude', 'codex', or 'gemini'")
+	}
+	return nil
+}
+
+// mergeRepoConfig layers the stored config over the checked-in file: scalar
+// fields and the setup list are replaced when set, env and mcp_servers are
+// merged key by key.
+func mergeRepoConfig(file, stored repoConfig) repoConfig {
+	merged := file
+	if stored.CLIType != "" {
+		merged.CLIType = stored.CLIType
+	}
+	if stored.SourceBranch != "" {
+		merged.SourceBranch = stored.SourceBranch
+	}
+	if stored.Setup != nil {
+		merged.Setup = stored.Setup
+	}
+	if len(stored.Env) > 0 {
+		env := map[string]string{}
+		for k, v := range file.Env {
+			env[k] = v
+		}
+		for k, v := range stored.Env {
+			env[k] = v
+		}
+		merged.Env = env
+	}
+	if len(stored.MCPServers) > 0 {
+		servers := map[string]any{}
+		for k, v := range file.MCPServers {
+			servers[k] = v
+		}
+		for k, v := range stored.MCPServers {
+			servers[k] = v
+		}
+		merged.MCPServers = servers
+	}
+	return merged
+}
+
+func loadStoredRepoConfig(db *sql.DB, repoID int64) (repoConfig, error) {
+	var cfg repoConfig
+	var configJSON string
+	err := db.QueryRow(`SELECT config FROM repo_config WHERE repo_id = ?`, repoID).Scan(&configJSON)
+	if err == sql.ErrNoRows {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	// Stored encrypted, as env and mcp_servers may hold tokens.
+	if configJSON, err = secrets.Decrypt(configJSON); err != nil {
+		return cfg, fmt.Errorf("stored config: %w", err)
+	}
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return cfg, fmt.Errorf("stored config: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadRepoConfigFile reads .superposition.yaml from branch of the bare repo.
+// A missing file is not an error.
+func loadRepoConfigFile(barePath, branch string) (repoConfig, bool, error) {
+	var cfg repoConfig
+	files, err := git.ListFiles(barePath, branch, repoConfigFile)
+	if err != nil || len(files) == 0 {
+		return cfg, false, nil
+	}
+	data, err := git.ReadFile(barePath, branch, repoConfigFile)
+	if err != nil {
+		return cfg, true, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return cfg, true, fmt.Errorf("%s: %w", repoConfigFile, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, true, fmt.Errorf("%s: %w", repoConfigFile, err)
+	}
+	return cfg, true, nil
+}
+
+// loadRepoConfig returns the effective config for sessions created from
+// branch: the checked-in file on that branch overlaid with the stored config.
+func loadRepoConfig(db *sql.DB, repoID int64, barePath, branch string) (repoConfig, error) {
+	stored, err := loadStoredRepoConfig(db, repoID)
+	if err != nil {
+		return repoConfig{}, err
+	}
+	file, _, err := loadRepoConfigFile(barePath, branch)
+	if err != nil {
+		return repoConfig{}, err
+	}
+	return mergeRepoConfig(file, stored), nil
+}
+
+// HandleGetConfig returns a repo's stored config, its checked-in config on
+// the default branch, and the effective merge of the two.
+func (h *ReposHandler) HandleGetConfig(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	var localPath, cloneStatus, defaultBranch string
+	err = h.db.QueryRow(`SELECT local_path, clone_status, default_branch FROM repositories WHERE id = ?`, id).
+		Scan(&localPath, &cloneStatus, &defaultBranch)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	stored, err := loadStoredRepoConfig(h.db, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := map[string]any{"stored": stored, "file": nil, "file_error": ""}
+	var file repoConfig
+	if cloneStatus == "ready" {
+		var found bool
+		file, found, err = loadRepoConfigFile(localPath, defaultBranch)
+		if err != nil {
+			resp["file_error"] = err.Error()
+		} else if found {
+			resp["file"] = file
+		}
+	}
+	resp["effective"] = mergeRepoConfig(file, stored)
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// HandlePutConfig replaces a repo's stored config.
+func (h *ReposHandler) HandlePutConfig(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	var cfg repoConfig
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if err := cfg.validate(); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var exists int
+	if err := h.db.QueryRow(`SELECT 1 FROM repositories WHERE id = ?`, id).Scan(&exists); err != nil {
+		WriteError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	configJSON, err := json.Marshal(cfg)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "failed to encode config")
+		return
+	}
+	configData, err := secrets.Encrypt(string(configJSON))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	_, err = h.db.Exec(
+		`INSERT INTO repo_config (repo_id, config, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(repo_id) DO UPDATE SET config = excluded.config, updated_at = excluded.updated_at`,
+		id, configData, time.Now(),
+	)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, cfg)
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/peterje/superposition/internal/git"
+	"github.com/peterje/superposition/internal/models"
+)
+
+// repoSyncResult is the report of a successful sync, stored on the
+// repository row and sent with repo.synced.
+type repoSyncResult struct {
+	SyncedAt time.Time `json:"synced_at"`
+	git.FetchResult
+	Sessions []sessionDrift `json:"sessions"`
+}
+
+// sessionDrift is how far an active session's branch and its source branch
+// have diverged: Behind is how many commits the source branch has moved on
+// that the session doesn't have.
+type sessionDrift struct {
+	SessionID    string `json:"session_id"`
+	Branch       string `json:"branch"`
+	SourceBranch string `json:"source_branch"`
+	Ahead        int    `json:"ahead"`
+	Behind       int    `json:"behind"`
+}
+
+// repoSyncLocks serializes syncs of the same repository, which may be
+// started by the scheduler, the API and GitHub push webhooks at once.
+var repoSyncLocks sync.Map // repo ID -> *sync.Mutex
+
+func repoSyncLock(repoID int64) *sync.Mutex {
+	mu, _ := repoSyncLocks.LoadOrStore(repoID, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
+
+// syncRepo fetches a ready repository from its remote and reloads its
+// checked-in workflows. The outcome is recorded on the repository row: the
+// error, or the branches the fetch updated or skipped and how far each
+// active session's source branch has moved. It fires repo.synced or
+// repo.sync_failed.
+func syncRepo(db *sql.DB, webhooks *WebhooksHandler, repo models.Repository) (repoSyncResult, []repoWorkflowResult, error) {
+	mu := repoSyncLock(repo.ID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	log.Printf("Sync repo id=%d: fetching (path=%s)", repo.ID, repo.LocalPath)
+	fetched, err := git.FetchBranches(repo.LocalPath, repoGitAuth(db, repo.ID))
+	if err != nil {
+		log.Printf("Sync repo id=%d: git fetch failed: %v", repo.ID, err)
+		db.Exec(`UPDATE repositories SET last_sync_at = ?, last_sync_error = ? WHERE id = ?`, time.Now(), err.Error(), repo.ID)
+		webhooks.FireWebhook("repo.sync_failed", "", map[string]any{"repo_id": repo.ID, "error": err.Error()})
+		return repoSyncResult{}, nil, err
+	}
+
+	result := repoSyncResult{SyncedAt: time.Now(), FetchResult: fetched, Sessions: sessionDrifts(db, repo)}
+	data, _ := json.Marshal(result)
+	if _, err := db.Exec(`UPDATE repositories SET last_synced = ?, last_sync_at = ?, last_sync_error = '', last_sync_result = ? WHERE id = ?`,
+		result.SyncedAt, result.SyncedAt, string(data), repo.ID); err != nil {
+		log.Printf("Sync repo id=%d: failed to record sync: %v", repo.ID, err)
+	}
+	if len(fetched.Skipped) > 0 {
+		log.Printf("Sync repo id=%d: not updating branches checked out in worktrees: %v", repo.ID, fetched.Skipped)
+	}
+	if len(fetched.Diverged) > 0 {
+		log.Printf("Sync repo id=%d: not updating branches that diverged from origin: %v", repo.ID, fetched.Diverged)
+	}
+
+	workflows, err := syncRepoWorkflows(db, repo.ID, repo.LocalPath, repo.DefaultBranch)
+	if err != nil {
+		log.Printf("Sync repo id=%d: failed to load workflows: %v", repo.ID, err)
+	}
+
+	webhooks.FireWebhook("repo.synced", "", map[string]any{
+		"repo_id": repo.ID, "updated": fetched.Updated, "skipped": fetched.Skipped, "diverged": fetched.Diverged, "sessions": result.Sessions,
+	})
+	return result, workflows, nil
+}
+
+// sessionDrifts compares each active session's branch of repo with its
+// source branch, recording how far behind it is on the session row.
+func sessionDrifts(db *sql.DB, repo models.Repository) []sessionDrift {
+	drifts := []sessionDrift{}
+	rows, err := db.Query(`SELECT id, branch, source_branch FROM sessions WHERE repo_id = ? AND status IN ('starting', 'running') ORDER BY created_at`, repo.ID)
+	if err != nil {
+		log.Printf("Sync repo id=%d: list sessions: %v", repo.ID, err)
+		return drifts
+	}
+	for rows.Next() {
+		var d sessionDrift
+		if rows.Scan(&d.SessionID, &d.Branch, &d.SourceBranch) == nil {
+			if d.SourceBranch == "" {
+				d.SourceBranch = repo.DefaultBranch
+			}
+			drifts = append(drifts, d)
+		}
+	}
+	rows.Close()
+
+	measured := drifts[:0]
+	for _, d := range drifts {
+		var err error
+		if d.Ahead, d.Behind, err = git.Divergence(repo.LocalPath, d.Branch, d.SourceBranch); err != nil {
+			log.Printf("Sync repo id=%d: session %s: %v", repo.ID, d.SessionID, err)
+			continue
+		}
+		db.Exec(`UPDATE sessions SET source_behind = ? WHERE id = ?`, d.Behind, d.SessionID)
+		measured = append(measured, d)
+	}
+	return measured
+}
+
+// repoSyncCheckInterval is how often RunRepoSync looks for repositories due
+// for a sync.
+const repoSyncCheckInterval = time.Minute
+
+// RunRepoSync syncs each ready repository every sync_interval_minutes, or
+// every repo_sync_interval_minutes (default 15) when the repository doesn't
+// set its own; 0 disables it. It never returns.
+func RunRepoSync(db *sql.DB, webhooks *WebhooksHandler) {
+	for {
+		time.Sleep(repoSyncCheckInterval)
+		syncDueRepos(db, webhooks)
+	}
+}
+
+func syncDueRepos(db *sql.DB, webhooks *WebhooksHandler) {
+	minutes := 15
+	if v := settingValue(db, "repo_sync_interval_minutes"); v != "" {
+		minutes, _ = strconv.Atoi(v)
+	}
+
+	rows, err := db.Query(`SELECT id, local_path, default_branch, sync_interval_minutes, last_sync_at FROM repositories WHERE clone_status = 'ready'`)
+	if err != nil {
+		log.Printf("repo sync: %v", err)
+		return
+	}
+	var due []models.Repository
+	for rows.Next() {
+		var repo models.Repository
+		if err := rows.Scan(&repo.ID, &repo.LocalPath, &repo.DefaultBranch, &repo.SyncIntervalMinutes, &repo.LastSyncAt); err != nil {
+			continue
+		}
+		interval := minutes
+		if repo.SyncIntervalMinutes != nil {
+			interval = *repo.SyncIntervalMinutes
+		}
+		if interval <= 0 || (repo.LastSyncAt != nil && time.Since(*repo.LastSyncAt) < time.Duration(interval)*time.Minute) {
+			continue
+		}
+		due = append(due, repo)
+	}
+	rows.Close()
+
+	for _, repo := range due {
+		syncRepo(db, webhooks, repo)
+	}
+}
+
+// HandleUpdate changes a repository's settings. Only sync_interval_minutes
+// can be changed: minutes between background syncs, 0 to disable them, or
+// null to use the repo_sync_interval_minutes setting.
+func (h *ReposHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	var body struct {
+		SyncIntervalMinutes *int `json:"sync_interval_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if body.SyncIntervalMinutes != nil && *body.SyncIntervalMinutes < 0 {
+		WriteError(w, http.StatusBadRequest, "sync_interval_minutes must not be negative")
+		return
+	}
+	res, err := h.db.Exec(`UPDATE repositories SET sync_interval_minutes = ? WHERE id = ?`, body.SyncIntervalMinutes, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		WriteError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{"id": id, "sync_interval_minutes": body.SyncIntervalMinutes})
+}
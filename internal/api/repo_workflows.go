@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/peterje/superposition/internal/git"
+	"gopkg.in/yaml.v3"
+)
+
+// repoWorkflowsDir is where repositories keep checked-in workflow definitions.
+const repoWorkflowsDir = ".superposition/workflows"
+
+// workflowStepTypes lists the step types runStep understands.
+var workflowStepTypes = map[string]bool{
+	"shell": true, "send_input": true, "create_session": true,
+	"wait_idle": true, "wait_output": true, "capture": true,
+	"git_commit": true, "git_push": true, "stop_session": true,
+}
+
+// workflowFile is the YAML form of a workflow definition.
+type workflowFile struct {
+	Name        string           `yaml:"name"`
+	Description string           `yaml:"description"`
+	Params      []workflowParam  `yaml:"params"`
+	Steps       []map[string]any `yaml:"steps"`
+}
+
+// repoWorkflowResult reports the outcome of loading one workflow file.
+type repoWorkflowResult struct {
+	ID    int64  `json:"id"`
+	Path  string `json:"path"`
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// parseWorkflowFile parses and validates a workflow definition, returning its
+// params and steps as the JSON stored in the workflows table.
+func parseWorkflowFile(filePath string, data []byte) (workflowFile, string, string, error) {
+	var wf workflowFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&wf); err != nil {
+		return wf, "", "", fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	if wf.Name == "" {
+		wf.Name = strings.TrimSuffix(path.Base(filePath), path.Ext(filePath))
+	}
+	if wf.Params == nil {
+		wf.Params = []workflowParam{}
+	}
+	if err := validateWorkflowParams(wf.Params); err != nil {
+		return wf, "", "", err
+	}
+	if len(wf.Steps) == 0 {
+		return wf, "", "", fmt.Errorf("steps: at least one step is required")
+	}
+
+	stepsJSON, err := json.Marshal(wf.Steps)
+	if err != nil {
+		return wf, "", "", fmt.Errorf("steps: %w", err)
+	}
+	if err := validateWorkflowSteps(stepsJSON); err != nil {
+		return wf, "", "", err
+	}
+	paramsJSON, err := json.Marshal(wf.Params)
+	if err != nil {
+		return wf, "", "", fmt.Errorf("params: %w", err)
+	}
+	return wf, string(paramsJSON), string(stepsJSON), nil
+}
+
+// validateWorkflowSteps rejects unknown step types and unknown step fields,
+// which usually indicate a typo in a hand-written definition.
+func validateWorkflowSteps(stepsJSON []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(stepsJSON, &raw); err != nil {
+		return fmt.Errorf("steps: %w", err)
+	}
+	for i, r := range raw {
+		var step workflowStep
+		dec := json.NewDecoder(bytes.NewReader(r))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&step); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		if !workflowStepTypes[step.Type] {
+			return fmt.Errorf("step %d: unknown type %q", i+1, step.Type)
+		}
+	}
+	return validateShellCommands(stepsJSON)
+}
+
+// validateShellCommands checks that shell steps quote the variables they
+// use (see parseShellCommand).
+func validateShellCommands(stepsJSON []byte) error {
+	var steps []struct {
+		Type    string `json:"type"`
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(stepsJSON, &steps); err != nil {
+		return fmt.Errorf("steps: %w", err)
+	}
+	for i, step := range steps {
+		if step.Type == "shell" && strings.Contains(step.Command, "{{") {
+			if _, err := parseShellCommand(step.Command); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// syncRepoWorkflows loads every workflow file on the repo's default branch
+// into the workflows table, keeping IDs stable per path so triggers keep
+// working, and removes workflows whose files were deleted. Files that fail
+// validation are still recorded, with their error and no steps.
+func syncRepoWorkflows(db *sql.DB, repoID int64, barePath, branch string) ([]repoWorkflowResult, error) {
+	files, err := git.ListFiles(barePath, branch, repoWorkflowsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []repoWorkflowResult{}
+	seen := map[string]bool{}
+	for _, f := range files {
+		if ext := path.Ext(f); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		seen[f] = true
+
+		result := repoWorkflowResult{Path: f}
+		var name, description string
+		paramsJSON, stepsJSON := "[]", "[]"
+
+		data, err := git.ReadFile(barePath, branch, f)
+		if err == nil {
+			var wf workflowFile
+			var p, s string
+			wf, p, s, err = parseWorkflowFile(f, data)
+			name, description = wf.Name, wf.Description
+			if err == nil {
+				paramsJSON, stepsJSON = p, s
+			}
+		}
+		if name == "" {
+			name = strings.TrimSuffix(path.Base(f), path.Ext(f))
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Name = name
+
+		_, execErr := db.Exec(`INSERT INTO workflows (name, description, params, steps, repo_id, path, error)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(repo_id, path) WHERE repo_id IS NOT NULL DO UPDATE SET
+				name = excluded.name, description = excluded.description, params = excluded.params,
+				steps = excluded.steps, error = excluded.error`,
+			name, description, paramsJSON, stepsJSON, repoID, f, result.Error)
+		if execErr != nil {
+			return nil, fmt.Errorf("save workflow %s: %w", f, execErr)
+		}
+		db.QueryRow(`SELECT id FROM workflows WHERE repo_id = ? AND path = ?`, repoID, f).Scan(&result.ID)
+		results = append(results, result)
+	}
+
+	rows, err := db.Query(`SELECT id, path FROM workflows WHERE repo_id = ?`, repoID)
+	if err != nil {
+		return results, err
+	}
+	var stale []int64
+	for rows.Next() {
+		var id int64
+		var p string
+		if err := rows.Scan(&id, &p); err == nil && !seen[p] {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+	for _, id := range stale {
+		db.Exec(`DELETE FROM workflows WHERE id = ?`, id)
+	}
+
+	for _, r := range results {
+		if r.Error != "" {
+			log.Printf("repo %d: workflow %s: %s", repoID, r.Path, r.Error)
+		}
+	}
+	return results, nil
+}
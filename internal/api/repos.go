@@ -7,56 +7,81 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/peterje/superposition/internal/git"
 	"github.com/peterje/superposition/internal/github"
 	"github.com/peterje/superposition/internal/models"
+	"github.com/peterje/superposition/internal/provider"
+	"github.com/peterje/superposition/internal/secrets"
 )
 
 type ReposHandler struct {
-	db          *sql.DB
-	cachedRepos []github.Repo
-	cachedAt    time.Time
+	db       *sql.DB
+	webhooks *WebhooksHandler
+	mu       sync.Mutex
+	cache    map[string]repoListCache // by provider
 }
 
-func NewReposHandler(db *sql.DB) *ReposHandler {
-	return &ReposHandler{db: db}
+type repoListCache struct {
+	repos    []github.Repo
+	cachedAt time.Time
+}
+
+func NewReposHandler(db *sql.DB, webhooks *WebhooksHandler) *ReposHandler {
+	return &ReposHandler{db: db, webhooks: webhooks, cache: map[string]repoListCache{}}
 }
 
 const repoCacheTTL = 5 * time.Minute
 
 func (h *ReposHandler) HandleGitHubRepos(w http.ResponseWriter, r *http.Request) {
-	pat := h.getPAT()
-	if pat == "" {
-		WriteError(w, http.StatusBadRequest, "GitHub PAT not configured")
+	h.listProviderRepos(w, r, provider.GitHub)
+}
+
+// HandleProviderRepos lists the repositories available on a provider
+// ("github", "gitlab" or "gitea"), filtered by ?q=.
+func (h *ReposHandler) HandleProviderRepos(w http.ResponseWriter, r *http.Request) {
+	h.listProviderRepos(w, r, r.PathValue("provider"))
+}
+
+func (h *ReposHandler) listProviderRepos(w http.ResponseWriter, r *http.Request, repoType string) {
+	client, err := providerClient(h.db, repoType)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	refresh := r.URL.Query().Get("refresh") == "true"
 
 	// Fetch and cache all repos if cache is empty, stale, or refresh requested
-	if h.cachedRepos == nil || refresh || time.Since(h.cachedAt) > repoCacheTTL {
-		repos, err := github.ListAllRepos(pat)
+	h.mu.Lock()
+	cached, ok := h.cache[repoType]
+	h.mu.Unlock()
+	if !ok || refresh || time.Since(cached.cachedAt) > repoCacheTTL {
+		repos, err := client.ListAllRepos()
 		if err != nil {
 			WriteError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
-		h.cachedRepos = repos
-		h.cachedAt = time.Now()
+		cached = repoListCache{repos: repos, cachedAt: time.Now()}
+		h.mu.Lock()
+		h.cache[repoType] = cached
+		h.mu.Unlock()
 	}
 
 	// Filter by search query client-side
 	query := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
 	if query == "" {
-		WriteJSON(w, http.StatusOK, h.cachedRepos)
+		WriteJSON(w, http.StatusOK, cached.repos)
 		return
 	}
 
 	filtered := []github.Repo{}
-	for _, r := range h.cachedRepos {
+	for _, r := range cached.repos {
 		if strings.Contains(strings.ToLower(r.FullName), query) ||
 			strings.Contains(strings.ToLower(r.Description), query) {
 			filtered = append(filtered, r)
@@ -65,48 +90,137 @@ func (h *ReposHandler) HandleGitHubRepos(w http.ResponseWriter, r *http.Request)
 	WriteJSON(w, http.StatusOK, filtered)
 }
 
+// HandleList lists repositories, with the progress of those still cloning.
 func (h *ReposHandler) HandleList(w http.ResponseWriter, _ *http.Request) {
-	rows, err := h.db.Query(`SELECT id, github_url, owner, name, local_path, clone_status, default_branch, last_synced, created_at, source_path, repo_type FROM repositories ORDER BY created_at DESC`)
+	rows, err := h.db.Query(`SELECT id, github_url, owner, name, local_path, clone_status, clone_error, default_branch, last_synced, created_at, source_path, repo_type, clone_url,
+		clone_filter, clone_depth, sparse_paths, sync_interval_minutes, last_sync_at, last_sync_error, last_sync_result FROM repositories ORDER BY created_at DESC`)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer rows.Close()
 
-	repos := []models.Repository{}
+	type repoWithProgress struct {
+		models.Repository
+		CloneProgress *git.CloneProgress `json:"clone_progress,omitempty"`
+	}
+
+	repos := []repoWithProgress{}
 	for rows.Next() {
-		var repo models.Repository
+		var repo repoWithProgress
 		var githubURL sql.NullString
-		if err := rows.Scan(&repo.ID, &githubURL, &repo.Owner, &repo.Name, &repo.LocalPath, &repo.CloneStatus, &repo.DefaultBranch, &repo.LastSynced, &repo.CreatedAt, &repo.SourcePath, &repo.RepoType); err != nil {
+		var sparse, syncResult string
+		if err := rows.Scan(&repo.ID, &githubURL, &repo.Owner, &repo.Name, &repo.LocalPath, &repo.CloneStatus, &repo.CloneError, &repo.DefaultBranch, &repo.LastSynced, &repo.CreatedAt, &repo.SourcePath, &repo.RepoType, &repo.CloneURL,
+			&repo.CloneFilter, &repo.CloneDepth, &sparse, &repo.SyncIntervalMinutes, &repo.LastSyncAt, &repo.LastSyncError, &syncResult); err != nil {
 			WriteError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 		repo.GitHubURL = githubURL.String
+		repo.SparsePaths = decodeSparsePaths(sparse)
+		if syncResult != "" {
+			repo.LastSyncResult = json.RawMessage(syncResult)
+		}
+		if job := getCloneJob(repo.ID); job != nil {
+			progress := job.snapshot()
+			repo.CloneProgress = &progress
+		}
 		repos = append(repos, repo)
 	}
 	WriteJSON(w, http.StatusOK, repos)
 }
 
+// checkoutOptions are a repository's options for large repos: a partial
+// clone filter and shallow clone depth used when it is cloned, and the
+// directories to check out in session worktrees (all when empty), which a
+// session can override.
+type checkoutOptions struct {
+	CloneFilter string   `json:"clone_filter"`
+	CloneDepth  int      `json:"clone_depth"`
+	SparsePaths []string `json:"sparse_paths"`
+}
+
+// cloneFilterRe matches the partial clone filters worth offering.
+var cloneFilterRe = regexp.MustCompile(`^(blob:none|tree:0|blob:limit=[0-9]+[kmg]?)$`)
+
+func (o checkoutOptions) validate() error {
+	if o.CloneFilter != "" && !cloneFilterRe.MatchString(o.CloneFilter) {
+		return fmt.Errorf("clone_filter must be blob:none, tree:0 or blob:limit=<size>")
+	}
+	if o.CloneDepth < 0 {
+		return fmt.Errorf("clone_depth must not be negative")
+	}
+	return validateSparsePaths(o.SparsePaths)
+}
+
+func (o checkoutOptions) cloneOptions() git.CloneOptions {
+	return git.CloneOptions{Filter: o.CloneFilter, Depth: o.CloneDepth}
+}
+
+// validateSparsePaths checks that sparse checkout paths are directories
+// inside the repository.
+func validateSparsePaths(paths []string) error {
+	for _, p := range paths {
+		clean := filepath.ToSlash(filepath.Clean(p))
+		if p == "" || clean == "." || filepath.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("sparse_paths: invalid path %q", p)
+		}
+	}
+	return nil
+}
+
+// encodeSparsePaths and decodeSparsePaths convert sparse checkout paths to
+// and from their JSON column.
+func encodeSparsePaths(paths []string) string {
+	if len(paths) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(paths)
+	return string(data)
+}
+
+func decodeSparsePaths(data string) []string {
+	var paths []string
+	json.Unmarshal([]byte(data), &paths)
+	return paths
+}
+
+// HandleCreate adds a repository from a GitHub URL ("github_url"), a local
+// path ("local_path") or any remote URL ("url"); see remoteRepo for the
+// options accepted with "url" and checkoutOptions for those accepted with
+// any of them.
 func (h *ReposHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		GitHubURL string `json:"github_url"`
 		LocalPath string `json:"local_path"`
+		remoteRepo
+		checkoutOptions
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		WriteError(w, http.StatusBadRequest, "invalid JSON")
 		return
 	}
+	if err := body.checkoutOptions.validate(); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := checkDiskQuota(h.db); err != nil {
+		writeSessionError(w, err)
+		return
+	}
 
 	if body.LocalPath != "" {
-		h.createLocalRepo(w, body.LocalPath)
+		h.createLocalRepo(w, body.LocalPath, body.checkoutOptions)
 	} else if body.GitHubURL != "" {
-		h.createGitHubRepo(w, body.GitHubURL)
+		h.createGitHubRepo(w, body.GitHubURL, body.checkoutOptions)
+	} else if body.URL != "" {
+		h.createRemoteRepo(w, body.remoteRepo, body.checkoutOptions)
 	} else {
-		WriteError(w, http.StatusBadRequest, "github_url or local_path is required")
+		WriteError(w, http.StatusBadRequest, "github_url, url or local_path is required")
 	}
 }
 
-func (h *ReposHandler) createGitHubRepo(w http.ResponseWriter, githubURL string) {
+func (h *ReposHandler) createGitHubRepo(w http.ResponseWriter, githubURL string, opts checkoutOptions) {
 	owner, name, err := parseGitHubURL(githubURL)
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, err.Error())
@@ -116,8 +230,9 @@ func (h *ReposHandler) createGitHubRepo(w http.ResponseWriter, githubURL string)
 	cloneURL := fmt.Sprintf("https://github.com/%s/%s.git", owner, name)
 
 	result, err := h.db.Exec(
-		`INSERT INTO repositories (github_url, owner, name, local_path, clone_status, default_branch, repo_type) VALUES (?, ?, ?, '', 'cloning', 'main', 'github')`,
-		githubURL, owner, name,
+		`INSERT INTO repositories (github_url, owner, name, local_path, clone_status, default_branch, repo_type, clone_url, clone_filter, clone_depth, sparse_paths)
+		 VALUES (?, ?, ?, '', 'cloning', 'main', 'github', ?, ?, ?, ?)`,
+		githubURL, owner, name, cloneURL, opts.CloneFilter, opts.CloneDepth, encodeSparsePaths(opts.SparsePaths),
 	)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE") {
@@ -129,7 +244,7 @@ func (h *ReposHandler) createGitHubRepo(w http.ResponseWriter, githubURL string)
 	}
 
 	id, _ := result.LastInsertId()
-	go h.cloneRepo(id, cloneURL, owner, name)
+	h.cloneRepo(id, cloneURL, owner, name, opts.cloneOptions())
 
 	repo := models.Repository{
 		ID:          id,
@@ -138,11 +253,60 @@ func (h *ReposHandler) createGitHubRepo(w http.ResponseWriter, githubURL string)
 		Name:        name,
 		CloneStatus: "cloning",
 		RepoType:    "github",
+		CloneURL:    cloneURL,
+		CloneFilter: opts.CloneFilter,
+		CloneDepth:  opts.CloneDepth,
+		SparsePaths: opts.SparsePaths,
 	}
 	WriteJSON(w, http.StatusCreated, repo)
 }
 
-func (h *ReposHandler) createLocalRepo(w http.ResponseWriter, sourcePath string) {
+func (h *ReposHandler) createRemoteRepo(w http.ResponseWriter, rr remoteRepo, opts checkoutOptions) {
+	repoType, owner, name, dir, err := rr.resolve(h.db)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := secrets.Encrypt(rr.Token)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := h.db.Exec(
+		`INSERT INTO repositories (owner, name, local_path, clone_status, default_branch, repo_type, clone_url, auth_username, auth_token, ssh_key_path,
+		 clone_filter, clone_depth, sparse_paths)
+		 VALUES (?, ?, '', 'cloning', 'main', ?, ?, ?, ?, ?, ?, ?, ?)`,
+		owner, name, repoType, rr.URL, rr.Username, token, rr.SSHKeyPath, opts.CloneFilter, opts.CloneDepth, encodeSparsePaths(opts.SparsePaths),
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			WriteError(w, http.StatusConflict, "repository already added")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	h.cloneRepo(id, rr.URL, dir, name, opts.cloneOptions())
+
+	repo := models.Repository{
+		ID:          id,
+		Owner:       owner,
+		Name:        name,
+		CloneStatus: "cloning",
+		RepoType:    repoType,
+		CloneURL:    rr.URL,
+		CloneFilter: opts.CloneFilter,
+		CloneDepth:  opts.CloneDepth,
+		SparsePaths: opts.SparsePaths,
+	}
+	WriteJSON(w, http.StatusCreated, repo)
+}
+
+func (h *ReposHandler) createLocalRepo(w http.ResponseWriter, sourcePath string, opts checkoutOptions) {
 	name := filepath.Base(sourcePath)
 	if name == "" || name == "." || name == "/" {
 		WriteError(w, http.StatusBadRequest, "invalid local path")
@@ -150,8 +314,9 @@ func (h *ReposHandler) createLocalRepo(w http.ResponseWriter, sourcePath string)
 	}
 
 	result, err := h.db.Exec(
-		`INSERT INTO repositories (owner, name, local_path, clone_status, default_branch, source_path, repo_type) VALUES ('local', ?, '', 'cloning', 'main', ?, 'local')`,
-		name, sourcePath,
+		`INSERT INTO repositories (owner, name, local_path, clone_status, default_branch, source_path, repo_type, clone_filter, clone_depth, sparse_paths)
+		 VALUES ('local', ?, '', 'cloning', 'main', ?, 'local', ?, ?, ?)`,
+		name, sourcePath, opts.CloneFilter, opts.CloneDepth, encodeSparsePaths(opts.SparsePaths),
 	)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE") {
@@ -163,7 +328,7 @@ func (h *ReposHandler) createLocalRepo(w http.ResponseWriter, sourcePath string)
 	}
 
 	id, _ := result.LastInsertId()
-	go h.cloneLocalRepo(id, sourcePath, name)
+	h.cloneLocalRepo(id, sourcePath, name, opts.cloneOptions())
 
 	repo := models.Repository{
 		ID:          id,
@@ -172,6 +337,9 @@ func (h *ReposHandler) createLocalRepo(w http.ResponseWriter, sourcePath string)
 		CloneStatus: "cloning",
 		SourcePath:  &sourcePath,
 		RepoType:    "local",
+		CloneFilter: opts.CloneFilter,
+		CloneDepth:  opts.CloneDepth,
+		SparsePaths: opts.SparsePaths,
 	}
 	WriteJSON(w, http.StatusCreated, repo)
 }
@@ -185,12 +353,16 @@ func (h *ReposHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 
 	// Check for active sessions
 	var count int
-	h.db.QueryRow(`SELECT COUNT(*) FROM sessions WHERE repo_id = ? AND status NOT IN ('stopped', 'error')`, id).Scan(&count)
+	h.db.QueryRow(`SELECT COUNT(*) FROM sessions WHERE repo_id = ? AND status NOT IN ('stopped', 'error', 'setup_failed')`, id).Scan(&count)
 	if count > 0 {
 		WriteError(w, http.StatusConflict, "repository has active sessions")
 		return
 	}
 
+	// Deleting a repository that is still cloning cancels the clone, which
+	// removes what it had cloned.
+	cancelClone(id)
+
 	result, err := h.db.Exec("DELETE FROM repositories WHERE id = ?", id)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
@@ -214,8 +386,8 @@ func (h *ReposHandler) HandleSync(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Sync requested for repo id=%d", id)
 
 	var repo models.Repository
-	err = h.db.QueryRow(`SELECT id, local_path, clone_status, repo_type FROM repositories WHERE id = ?`, id).
-		Scan(&repo.ID, &repo.LocalPath, &repo.CloneStatus, &repo.RepoType)
+	err = h.db.QueryRow(`SELECT id, local_path, clone_status, repo_type, default_branch FROM repositories WHERE id = ?`, id).
+		Scan(&repo.ID, &repo.LocalPath, &repo.CloneStatus, &repo.RepoType, &repo.DefaultBranch)
 	if err == sql.ErrNoRows {
 		WriteError(w, http.StatusNotFound, "repository not found")
 		return
@@ -231,23 +403,13 @@ func (h *ReposHandler) HandleSync(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Sync repo id=%d: fetching (path=%s)", id, repo.LocalPath)
-	pat := ""
-	if repo.RepoType != "local" {
-		pat = h.getPAT()
-	}
-	if err := git.Fetch(repo.LocalPath, pat); err != nil {
-		log.Printf("Sync repo id=%d: git fetch failed: %v", id, err)
+	result, workflows, err := syncRepo(h.db, h.webhooks, repo)
+	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-
-	now := time.Now()
-	if _, err := h.db.Exec(`UPDATE repositories SET last_synced = ? WHERE id = ?`, now, id); err != nil {
-		log.Printf("Sync repo id=%d: failed to update last_synced: %v", id, err)
-	}
 	log.Printf("Sync repo id=%d: complete", id)
-	WriteJSON(w, http.StatusOK, map[string]string{"status": "synced"})
+	WriteJSON(w, http.StatusOK, map[string]any{"status": "synced", "workflows": workflows, "result": result})
 }
 
 func (h *ReposHandler) HandleBranches(w http.ResponseWriter, r *http.Request) {
@@ -277,39 +439,6 @@ func (h *ReposHandler) HandleBranches(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, branches)
 }
 
-func (h *ReposHandler) cloneRepo(id int64, cloneURL, owner, name string) {
-	pat := h.getPAT()
-	localPath, err := git.CloneBare(cloneURL, pat, owner, name)
-	if err != nil {
-		log.Printf("Clone failed for %s/%s: %v", owner, name, err)
-		h.db.Exec(`UPDATE repositories SET clone_status = 'error' WHERE id = ?`, id)
-		return
-	}
-
-	defaultBranch := detectDefaultBranch(localPath)
-
-	now := time.Now()
-	h.db.Exec(`UPDATE repositories SET local_path = ?, clone_status = 'ready', default_branch = ?, last_synced = ? WHERE id = ?`,
-		localPath, defaultBranch, now, id)
-	log.Printf("Cloned %s/%s to %s", owner, name, localPath)
-}
-
-func (h *ReposHandler) cloneLocalRepo(id int64, sourcePath, name string) {
-	localPath, err := git.CloneBareLocal(sourcePath, name)
-	if err != nil {
-		log.Printf("Clone failed for local repo %s: %v", sourcePath, err)
-		h.db.Exec(`UPDATE repositories SET clone_status = 'error' WHERE id = ?`, id)
-		return
-	}
-
-	defaultBranch := detectDefaultBranch(localPath)
-
-	now := time.Now()
-	h.db.Exec(`UPDATE repositories SET local_path = ?, clone_status = 'ready', default_branch = ?, last_synced = ? WHERE id = ?`,
-		localPath, defaultBranch, now, id)
-	log.Printf("Cloned local repo %s to %s", sourcePath, localPath)
-}
-
 // detectDefaultBranch finds "main" or "master" from branches, falling back to first available.
 func detectDefaultBranch(barePath string) string {
 	branches, err := git.ListBranches(barePath)
@@ -329,12 +458,6 @@ func detectDefaultBranch(barePath string) string {
 	return branches[0]
 }
 
-func (h *ReposHandler) getPAT() string {
-	var pat string
-	h.db.QueryRow(`SELECT value FROM settings WHERE key = 'github_pat'`).Scan(&pat)
-	return pat
-}
-
 func parseGitHubURL(rawURL string) (string, string, error) {
 	// Handle formats: https://github.com/owner/name, github.com/owner/name, owner/name
 	rawURL = strings.TrimSuffix(rawURL, ".git")
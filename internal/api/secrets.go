@@ -0,0 +1,144 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/peterje/superposition/internal/secrets"
+)
+
+// SecretsHandler manages named secrets. Values are encrypted at rest and are
+// never returned by the API; env vars use them by writing ${secret:NAME} in
+// a value, which is substituted when the session's process starts.
+type SecretsHandler struct {
+	db *sql.DB
+}
+
+func NewSecretsHandler(db *sql.DB) *SecretsHandler {
+	return &SecretsHandler{db: db}
+}
+
+type secretInfo struct {
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// secretRefRe matches ${secret:NAME} references in env values.
+var secretRefRe = regexp.MustCompile(`\$\{secret:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveEnvSecrets returns env with ${secret:NAME} references replaced by
+// the secrets' values. A reference to a missing secret is an error, so a
+// process never starts with a literal placeholder where a token should be.
+func resolveEnvSecrets(db *sql.DB, env map[string]string) (map[string]string, error) {
+	if env == nil {
+		return nil, nil
+	}
+	resolved := make(map[string]string, len(env))
+	for k, v := range env {
+		var missing string
+		var decryptErr error
+		resolved[k] = secretRefRe.ReplaceAllStringFunc(v, func(ref string) string {
+			name := secretRefRe.FindStringSubmatch(ref)[1]
+			var stored string
+			if err := db.QueryRow(`SELECT value FROM secrets WHERE name = ?`, name).Scan(&stored); err != nil {
+				missing = name
+				return ""
+			}
+			plain, err := secrets.Decrypt(stored)
+			if err != nil {
+				decryptErr = fmt.Errorf("secret %s: %w", name, err)
+			}
+			return plain
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("env %s: secret %q is not defined", k, missing)
+		}
+		if decryptErr != nil {
+			return nil, decryptErr
+		}
+	}
+	return resolved, nil
+}
+
+// HandleList returns the names of all secrets, without their values.
+func (h *SecretsHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`SELECT name, created_at, updated_at FROM secrets ORDER BY name`)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	result := []secretInfo{}
+	for rows.Next() {
+		var s secretInfo
+		if err := rows.Scan(&s.Name, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		result = append(result, s)
+	}
+	WriteJSON(w, http.StatusOK, result)
+}
+
+// HandlePut creates or replaces a secret.
+func (h *SecretsHandler) HandlePut(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !paramNameRe.MatchString(name) {
+		WriteError(w, http.StatusBadRequest, "name must contain only letters, digits and underscores and not start with a digit")
+		return
+	}
+
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if body.Value == "" {
+		WriteError(w, http.StatusBadRequest, "value is required")
+		return
+	}
+
+	value, err := secrets.Encrypt(body.Value)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	_, err = h.db.Exec(
+		`INSERT INTO secrets (name, value, created_at, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		name, value, now, now,
+	)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var s secretInfo
+	h.db.QueryRow(`SELECT name, created_at, updated_at FROM secrets WHERE name = ?`, name).
+		Scan(&s.Name, &s.CreatedAt, &s.UpdatedAt)
+	WriteJSON(w, http.StatusOK, s)
+}
+
+// HandleDelete removes a secret. Sessions that reference it fail to start
+// until it is defined again.
+func (h *SecretsHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	res, err := h.db.Exec(`DELETE FROM secrets WHERE name = ?`, r.PathValue("name"))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		WriteError(w, http.StatusNotFound, "secret not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
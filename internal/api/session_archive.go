@@ -0,0 +1,576 @@
+package api
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peterje/superposition/internal/db"
+	"github.com/peterje/superposition/internal/git"
+	"github.com/peterje/superposition/internal/models"
+	ptymgr "github.com/peterje/superposition/internal/pty"
+)
+
+// sessionArchive is the metadata.json of a session archive. An archive is a
+// gzipped tarball at ~/.superposition/archives/<session id>.tar.gz holding:
+//
+//	metadata.json   this struct
+//	branch.bundle   git bundle of the branch and, if any, BackupRef
+//	transcript.log  the terminal output, if the CLI was still known
+//	notes.md        session notes
+//	ui.json         A2UI content
+//	claude/         Claude Code's conversation history for the worktree
+//
+// Env values are kept as stored, so encrypted ones can only be restored
+// with the same secret key.
+type sessionArchive struct {
+	ID           string            `json:"id"`
+	RepoID       int64             `json:"repo_id"`
+	RepoOwner    string            `json:"repo_owner"`
+	RepoName     string            `json:"repo_name"`
+	Branch       string            `json:"branch"`
+	SourceBranch string            `json:"source_branch"`
+	BaseCommit   string            `json:"base_commit,omitempty"`
+	CLIType      string            `json:"cli_type"`
+	BatchID      *string           `json:"batch_id"`
+	CreatedAt    time.Time         `json:"created_at"`
+	ArchivedAt   time.Time         `json:"archived_at"`
+	Head         string            `json:"head"`
+	BackupRef    string            `json:"backup_ref,omitempty"`
+	Env          map[string]string `json:"env,omitempty"`
+	SparsePaths  []string          `json:"sparse_paths,omitempty"`
+
+	// Size is the archive's size in bytes, filled in when listing.
+	Size int64 `json:"size,omitempty"`
+}
+
+func archivesDir() (string, error) {
+	dataDir, err := db.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "archives"), nil
+}
+
+func archivePath(sessionID string) (string, error) {
+	if !sessionIDRe.MatchString(sessionID) {
+		return "", &sessionError{http.StatusBadRequest, "invalid session id"}
+	}
+	dir, err := archivesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sessionID+".tar.gz"), nil
+}
+
+var sessionIDRe = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// claudeProjectDir returns where Claude Code keeps the conversation history
+// of a working directory: ~/.claude/projects/ plus the path with every
+// character other than letters and digits replaced by "-".
+func claudeProjectDir(worktreePath string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".claude", "projects", nonAlnumRe.ReplaceAllString(worktreePath, "-"))
+}
+
+var nonAlnumRe = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// archiveSession writes a session's archive, then stops its CLI and deletes
+// its worktree, branch and record. Uncommitted changes are committed to a
+// backup ref first, regardless of the worktree_backup setting.
+func archiveSession(db *sql.DB, manager ptymgr.SessionManager, webhooks *WebhooksHandler, sessionID string) (sessionArchive, error) {
+	a := sessionArchive{ID: sessionID, ArchivedAt: time.Now().UTC()}
+	var worktreePath, status, localPath, sparse string
+	var pid sql.NullInt64
+	err := db.QueryRow(`SELECT s.repo_id, s.worktree_path, s.branch, s.source_branch, s.base_commit, s.cli_type, s.status, s.pid, s.batch_id, s.created_at,
+		s.sparse_paths, r.owner, r.name, r.local_path FROM sessions s JOIN repositories r ON r.id = s.repo_id WHERE s.id = ?`, sessionID).
+		Scan(&a.RepoID, &worktreePath, &a.Branch, &a.SourceBranch, &a.BaseCommit, &a.CLIType, &status, &pid, &a.BatchID, &a.CreatedAt,
+			&sparse, &a.RepoOwner, &a.RepoName, &localPath)
+	if err == sql.ErrNoRows {
+		return a, &sessionError{http.StatusNotFound, "session not found"}
+	}
+	if err != nil {
+		return a, err
+	}
+	if status == "starting" {
+		return a, &sessionError{http.StatusConflict, "session is still starting"}
+	}
+	a.SparsePaths = decodeSparsePaths(sparse)
+	path, err := archivePath(sessionID)
+	if err != nil {
+		return a, err
+	}
+
+	var transcript []byte
+	if sess := manager.Get(sessionID); sess != nil {
+		transcript = sess.Replay()
+		manager.Stop(sessionID)
+		if pid.Valid {
+			waitForExit(int(pid.Int64), processExitTimeout)
+		}
+	}
+
+	_, statErr := os.Stat(worktreePath)
+	worktreeExists := worktreePath != "" && statErr == nil
+	if worktreeExists {
+		if dirty, err := worktreeDirty(worktreePath); err != nil {
+			return a, err
+		} else if dirty {
+			ref := fmt.Sprintf("%s%s/%d", git.BackupRefPrefix, sessionID, time.Now().Unix())
+			if _, err := git.BackupWorktree(worktreePath, ref, "superposition: archive of session "+sessionID); err != nil {
+				return a, fmt.Errorf("backup: %w", err)
+			}
+		}
+	}
+	a.BackupRef = currentBackup(localPath, sessionID, a.Branch)
+	if a.Head, err = git.RevParse(localPath, "refs/heads/"+a.Branch); err != nil {
+		return a, &sessionError{http.StatusConflict, "branch " + a.Branch + " not found"}
+	}
+	a.Env = map[string]string{}
+	if rows, err := db.Query(`SELECT key, value FROM session_env WHERE session_id = ?`, sessionID); err == nil {
+		for rows.Next() {
+			var k, v string
+			if rows.Scan(&k, &v) == nil {
+				a.Env[k] = v
+			}
+		}
+		rows.Close()
+	}
+	var notes, ui string
+	db.QueryRow(`SELECT content FROM session_notes WHERE session_id = ?`, sessionID).Scan(&notes)
+	db.QueryRow(`SELECT content FROM session_ui WHERE session_id = ?`, sessionID).Scan(&ui)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return a, err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return a, err
+	}
+	defer os.RemoveAll(tmpDir)
+	bundle := filepath.Join(tmpDir, "branch.bundle")
+	refs := []string{"refs/heads/" + a.Branch}
+	if a.BackupRef != "" {
+		refs = append(refs, a.BackupRef)
+	}
+	if err := git.CreateBundle(localPath, bundle, refs...); err != nil {
+		return a, err
+	}
+
+	metadata, _ := json.MarshalIndent(a, "", "  ")
+	err = writeTarGz(path, func(tw *tar.Writer) error {
+		if err := tarAddBytes(tw, "metadata.json", metadata); err != nil {
+			return err
+		}
+		if err := tarAddFile(tw, "branch.bundle", bundle); err != nil {
+			return err
+		}
+		if len(transcript) > 0 {
+			if err := tarAddBytes(tw, "transcript.log", transcript); err != nil {
+				return err
+			}
+		}
+		if notes != "" {
+			if err := tarAddBytes(tw, "notes.md", []byte(notes)); err != nil {
+				return err
+			}
+		}
+		if ui != "" && ui != "{}" {
+			if err := tarAddBytes(tw, "ui.json", []byte(ui)); err != nil {
+				return err
+			}
+		}
+		if dir := claudeProjectDir(worktreePath); worktreePath != "" && dir != "" {
+			if err := tarAddDir(tw, "claude", dir); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return a, fmt.Errorf("write archive: %w", err)
+	}
+
+	if worktreeExists {
+		if err := git.RemoveWorktree(localPath, worktreePath); err != nil {
+			log.Printf("Failed to remove worktree %s: %v", worktreePath, err)
+		}
+	} else {
+		git.PruneWorktrees(localPath)
+	}
+	if err := git.RemoveBranch(localPath, a.Branch); err != nil {
+		log.Printf("Failed to remove branch %s: %v", a.Branch, err)
+	}
+	db.Exec(`DELETE FROM sessions WHERE id = ?`, sessionID)
+
+	log.Printf("Session %s archived to %s", sessionID, path)
+	webhooks.FireWebhook("session.archived", sessionID, map[string]any{"path": path, "branch": a.Branch})
+	return a, nil
+}
+
+// restoreSession recreates an archived session: its branch and uncommitted
+// changes, worktree, record, notes, A2UI content and env vars, and Claude
+// Code's history if the worktree has none. The session is restored stopped;
+// with start its CLI is started resuming the last conversation, after the
+// archived terminal output. The archive is deleted once restored.
+func restoreSession(db *sql.DB, manager ptymgr.SessionManager, webhooks *WebhooksHandler, sessionID string, start bool) (models.Session, error) {
+	var session models.Session
+	path, err := archivePath(sessionID)
+	if err != nil {
+		return session, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return session, &sessionError{http.StatusNotFound, "archive not found"}
+	}
+	var exists int
+	if db.QueryRow(`SELECT 1 FROM sessions WHERE id = ?`, sessionID).Scan(&exists) == nil {
+		return session, &sessionError{http.StatusConflict, "session already exists"}
+	}
+	if err := checkDiskQuota(db); err != nil {
+		return session, err
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(path), ".restore-*")
+	if err != nil {
+		return session, err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := extractTarGz(path, tmpDir); err != nil {
+		return session, fmt.Errorf("read archive: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(tmpDir, "metadata.json"))
+	if err != nil {
+		return session, fmt.Errorf("read archive: %w", err)
+	}
+	var a sessionArchive
+	if err := json.Unmarshal(data, &a); err != nil {
+		return session, fmt.Errorf("read archive metadata: %w", err)
+	}
+
+	// The repository may have been removed and added again under a new ID.
+	var repo models.Repository
+	err = db.QueryRow(`SELECT id, local_path, clone_status, default_branch FROM repositories
+		WHERE owner = ? AND name = ? ORDER BY id = ? DESC LIMIT 1`, a.RepoOwner, a.RepoName, a.RepoID).
+		Scan(&repo.ID, &repo.LocalPath, &repo.CloneStatus, &repo.DefaultBranch)
+	if err == sql.ErrNoRows {
+		return session, &sessionError{http.StatusNotFound, fmt.Sprintf("repository %s/%s not found", a.RepoOwner, a.RepoName)}
+	}
+	if err != nil {
+		return session, err
+	}
+	if repo.CloneStatus != "ready" {
+		return session, &sessionError{http.StatusBadRequest, "repository not ready"}
+	}
+
+	wtDir, err := git.WorktreesDir()
+	if err != nil {
+		return session, err
+	}
+	worktreePath := filepath.Join(wtDir, sessionID)
+	if _, err := os.Stat(worktreePath); err == nil {
+		return session, &sessionError{http.StatusConflict, "worktree path already exists: " + worktreePath}
+	}
+
+	refspecs := []string{"refs/heads/" + a.Branch + ":refs/heads/" + a.Branch}
+	if a.BackupRef != "" {
+		refspecs = append(refspecs, a.BackupRef+":"+a.BackupRef)
+	}
+	if err := git.FetchBundle(repo.LocalPath, filepath.Join(tmpDir, "branch.bundle"), refspecs...); err != nil {
+		return session, &sessionError{http.StatusConflict, "restore branch: " + err.Error()}
+	}
+
+	sourceBranch := a.SourceBranch
+	if sourceBranch == "" {
+		sourceBranch = repo.DefaultBranch
+	}
+	cfg, err := loadRepoConfig(db, repo.ID, repo.LocalPath, sourceBranch)
+	if err != nil {
+		return session, &sessionError{http.StatusBadRequest, "repository config: " + err.Error()}
+	}
+	if err := checkoutSessionWorktree(sessionID, repo.LocalPath, worktreePath, a.Branch, a.SparsePaths, cfg.MCPServers); err != nil {
+		return session, &sessionError{http.StatusConflict, "restore worktree: " + err.Error()}
+	}
+
+	if _, err := db.Exec(`INSERT INTO sessions (id, repo_id, worktree_path, branch, source_branch, base_commit, cli_type, status, batch_id, created_at, stopped_at, sparse_paths)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 'stopped', ?, ?, CURRENT_TIMESTAMP, ?)`,
+		sessionID, repo.ID, worktreePath, a.Branch, a.SourceBranch, a.BaseCommit, a.CLIType, a.BatchID, a.CreatedAt, encodeSparsePaths(a.SparsePaths)); err != nil {
+		git.RemoveWorktree(repo.LocalPath, worktreePath)
+		return session, err
+	}
+	for k, v := range a.Env {
+		db.Exec(`INSERT INTO session_env (session_id, key, value) VALUES (?, ?, ?)`, sessionID, k, v)
+	}
+	if notes, err := os.ReadFile(filepath.Join(tmpDir, "notes.md")); err == nil {
+		db.Exec(`INSERT INTO session_notes (session_id, content, updated_at) VALUES (?, ?, ?)`, sessionID, string(notes), time.Now())
+	}
+	if ui, err := os.ReadFile(filepath.Join(tmpDir, "ui.json")); err == nil {
+		db.Exec(`INSERT INTO session_ui (session_id, content, updated_at) VALUES (?, ?, ?)`, sessionID, string(ui), time.Now())
+	}
+	if dir := claudeProjectDir(worktreePath); dir != "" {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if _, err := os.Stat(filepath.Join(tmpDir, "claude")); err == nil {
+				os.MkdirAll(filepath.Dir(dir), 0700)
+				if err := os.Rename(filepath.Join(tmpDir, "claude"), dir); err != nil {
+					log.Printf("Session %s: failed to restore Claude history: %v", sessionID, err)
+				}
+			}
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("Failed to remove archive %s: %v", path, err)
+	}
+	log.Printf("Session %s restored from archive", sessionID)
+	webhooks.FireWebhook("session.restored", sessionID, map[string]any{"repo_id": repo.ID, "branch": a.Branch})
+
+	session = models.Session{
+		ID: sessionID, RepoID: repo.ID, WorktreePath: worktreePath, Branch: a.Branch,
+		CLIType: a.CLIType, Status: "stopped", BatchID: a.BatchID, CreatedAt: a.CreatedAt,
+	}
+	if start {
+		transcript, _ := os.ReadFile(filepath.Join(tmpDir, "transcript.log"))
+		_, pid, err := restartSessionProcess(db, manager, webhooks, sessionID, a.CLIType, true, transcript)
+		if err != nil {
+			return session, err
+		}
+		session.Status = "running"
+		session.PID = &pid
+	}
+	return session, nil
+}
+
+// readArchiveMetadata returns the metadata of the archive at path, which
+// archiveSession writes as its first entry.
+func readArchiveMetadata(path string) (sessionArchive, error) {
+	var a sessionArchive
+	f, err := os.Open(path)
+	if err != nil {
+		return a, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return a, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return a, fmt.Errorf("metadata.json: %w", err)
+		}
+		if hdr.Name == "metadata.json" {
+			err := json.NewDecoder(tr).Decode(&a)
+			return a, err
+		}
+	}
+}
+
+// writeTarGz writes a gzipped tarball to dest with add, replacing dest only
+// once it is complete.
+func writeTarGz(dest string, add func(tw *tar.Writer) error) error {
+	tmp := dest + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = add(tw)
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+func tarAddBytes(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func tarAddFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// tarAddDir adds the regular files under dir, if it exists, below prefix.
+func tarAddDir(tw *tar.Writer, prefix, dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return tarAddFile(tw, prefix+"/"+filepath.ToSlash(rel), path)
+	})
+}
+
+// extractTarGz extracts the regular files of a gzipped tarball into dest,
+// rejecting entries that would land outside it.
+func extractTarGz(src, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid entry %q", hdr.Name)
+		}
+		target := filepath.Join(dest, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// HandleArchive archives a session (see archiveSession) and returns the
+// archive's metadata.
+func (h *SessionsHandler) HandleArchive(w http.ResponseWriter, r *http.Request) {
+	a, err := archiveSession(h.db, h.manager, h.webhooks, r.PathValue("id"))
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, a)
+}
+
+// HandleRestore restores an archived session (see restoreSession). Body:
+// {"start": true} to also start its CLI.
+func (h *SessionsHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Start bool `json:"start"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+	}
+	session, err := restoreSession(h.db, h.manager, h.webhooks, r.PathValue("id"), body.Start)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, session)
+}
+
+// HandleListArchives returns the metadata of every session archive, most
+// recently archived first.
+func (h *SessionsHandler) HandleListArchives(w http.ResponseWriter, r *http.Request) {
+	dir, err := archivesDir()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	archives := []sessionArchive{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".tar.gz") {
+			continue
+		}
+		a, err := readArchiveMetadata(filepath.Join(dir, e.Name()))
+		if err != nil {
+			log.Printf("archives: %s: %v", e.Name(), err)
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			a.Size = info.Size()
+		}
+		archives = append(archives, a)
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].ArchivedAt.After(archives[j].ArchivedAt) })
+	WriteJSON(w, http.StatusOK, archives)
+}
+
+// HandleDeleteArchive deletes a session archive and returns 204.
+func (h *SessionsHandler) HandleDeleteArchive(w http.ResponseWriter, r *http.Request) {
+	path, err := archivePath(r.PathValue("id"))
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	if err := os.Remove(path); os.IsNotExist(err) {
+		WriteError(w, http.StatusNotFound, "archive not found")
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
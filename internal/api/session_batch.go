@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/peterje/superposition/internal/models"
+)
+
+const maxBatchSessions = 20
+
+// batchRequest creates several sessions at once. Either list them in
+// Sessions, with unset fields taken from the top level, or leave Sessions
+// empty to create one session for every combination of RepoIDs, CLITypes
+// and Prompts (each defaulting to the single RepoID, CLIType or Prompt).
+type batchRequest struct {
+	RepoID       int64                 `json:"repo_id"`
+	RepoIDs      []int64               `json:"repo_ids"`
+	SourceBranch string                `json:"source_branch"`
+	CLIType      string                `json:"cli_type"`
+	CLITypes     []string              `json:"cli_types"`
+	Prompt       string                `json:"prompt"`
+	Prompts      []string              `json:"prompts"`
+	TemplateID   *int64                `json:"template_id"`
+	BranchPrefix string                `json:"branch_prefix"`
+	Sessions     []createSessionParams `json:"sessions"`
+}
+
+// batchResult reports the outcome of creating one session of a batch.
+type batchResult struct {
+	Index   int             `json:"index"`
+	Status  string          `json:"status"` // "created" or "failed"
+	Session *models.Session `json:"session,omitempty"`
+	Branch  string          `json:"branch"`
+	CLIType string          `json:"cli_type"`
+	RepoID  int64           `json:"repo_id"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// expand returns the sessions the request describes.
+func (b batchRequest) expand() []createSessionParams {
+	if len(b.Sessions) > 0 {
+		out := make([]createSessionParams, len(b.Sessions))
+		for i, p := range b.Sessions {
+			if p.RepoID == 0 {
+				p.RepoID = b.RepoID
+			}
+			if p.SourceBranch == "" {
+				p.SourceBranch = b.SourceBranch
+			}
+			if p.CLIType == "" {
+				p.CLIType = b.CLIType
+			}
+			if p.Prompt == "" {
+				p.Prompt = b.Prompt
+			}
+			if p.TemplateID == nil {
+				p.TemplateID = b.TemplateID
+			}
+			out[i] = p
+		}
+		return out
+	}
+
+	repoIDs := b.RepoIDs
+	if len(repoIDs) == 0 {
+		repoIDs = []int64{b.RepoID}
+	}
+	cliTypes := b.CLITypes
+	if len(cliTypes) == 0 {
+		cliTypes = []string{b.CLIType}
+	}
+	prompts := b.Prompts
+	if len(prompts) == 0 {
+		prompts = []string{b.Prompt}
+	}
+
+	var out []createSessionParams
+	for _, repoID := range repoIDs {
+		for _, cliType := range cliTypes {
+			for _, prompt := range prompts {
+				out = append(out, createSessionParams{
+					RepoID:       repoID,
+					SourceBranch: b.SourceBranch,
+					CLIType:      cliType,
+					Prompt:       prompt,
+					TemplateID:   b.TemplateID,
+				})
+			}
+		}
+	}
+	return out
+}
+
+// HandleBatch creates several sessions from one request and groups them
+// under a batch ID. Sessions are created in order; a failure doesn't stop
+// the rest, and each session's outcome is reported in the response.
+func (h *SessionsHandler) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	var body batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	params := body.expand()
+	if len(params) == 0 {
+		WriteError(w, http.StatusBadRequest, "no sessions requested")
+		return
+	}
+	if len(params) > maxBatchSessions {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("a batch can create at most %d sessions", maxBatchSessions))
+		return
+	}
+
+	batchID := uuid.New().String()[:8]
+	prefix := strings.Trim(body.BranchPrefix, "/")
+	if prefix == "" {
+		prefix = "batch"
+	}
+
+	results := make([]batchResult, len(params))
+	created := 0
+	for i, p := range params {
+		p.batchID = batchID
+		// Templates name their own branches.
+		if p.NewBranch == "" && p.TemplateID == nil {
+			p.NewBranch = fmt.Sprintf("%s/%s/%d", prefix, batchID, i+1)
+			if p.CLIType != "" {
+				p.NewBranch += "-" + p.CLIType
+			}
+		}
+
+		res := batchResult{Index: i, Branch: p.NewBranch, CLIType: p.CLIType, RepoID: p.RepoID}
+		session, err := createSession(h.db, h.manager, h.webhooks, p)
+		if err != nil {
+			res.Status = "failed"
+			res.Error = err.Error()
+		} else {
+			res.Status = "created"
+			res.Session = &session
+			res.CLIType = session.CLIType
+			res.RepoID = session.RepoID
+			created++
+		}
+		results[i] = res
+	}
+
+	status := http.StatusCreated
+	if created == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	WriteJSON(w, status, map[string]any{
+		"batch_id": batchID,
+		"created":  created,
+		"failed":   len(params) - created,
+		"sessions": results,
+	})
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/peterje/superposition/internal/git"
+)
+
+const maxPatchSize = 2 << 20 // truncate patches larger than 2MB
+
+// sessionGit is what's needed to run git commands for a session.
+type sessionGit struct {
+	ID           string
+	RepoID       int64
+	BarePath     string
+	WorktreePath string
+	Branch       string
+	SourceBranch string
+	BaseCommit   string
+}
+
+func loadSessionGit(db *sql.DB, id string) (sessionGit, error) {
+	var s sessionGit
+	var defaultBranch string
+	err := db.QueryRow(`SELECT s.id, s.repo_id, r.local_path, s.worktree_path, s.branch, s.source_branch, s.base_commit, r.default_branch
+		FROM sessions s JOIN repositories r ON s.repo_id = r.id WHERE s.id = ?`, id).
+		Scan(&s.ID, &s.RepoID, &s.BarePath, &s.WorktreePath, &s.Branch, &s.SourceBranch, &s.BaseCommit, &defaultBranch)
+	if err != nil {
+		return s, err
+	}
+	// Sessions from before source branches were recorded diff against the
+	// repo's default branch.
+	if s.SourceBranch == "" {
+		s.SourceBranch = defaultBranch
+	}
+	return s, nil
+}
+
+// hasWorktree reports whether the session's worktree is still on disk.
+func (s sessionGit) hasWorktree() bool {
+	if s.WorktreePath == "" {
+		return false
+	}
+	_, err := os.Stat(s.WorktreePath)
+	return err == nil
+}
+
+// tree returns a tree-ish for the session's current state: a snapshot of its
+// worktree including uncommitted changes, or its branch once the worktree is
+// gone.
+func (s sessionGit) tree() (string, error) {
+	if s.hasWorktree() {
+		return git.SnapshotTree(s.WorktreePath)
+	}
+	return "refs/heads/" + s.Branch, nil
+}
+
+// base returns the commit the session's branch forked from its source
+// branch, or the recorded base commit if the source branch is gone.
+func (s sessionGit) base() (string, error) {
+	var base string
+	var err error
+	if s.hasWorktree() {
+		base, err = git.BaseCommit(s.BarePath, s.WorktreePath, s.SourceBranch)
+	} else {
+		base, err = git.BranchBaseCommit(s.BarePath, s.Branch, s.SourceBranch)
+	}
+	if err != nil && s.BaseCommit != "" {
+		return s.BaseCommit, nil
+	}
+	return base, err
+}
+
+type diffResponse struct {
+	Files     []git.FileStat `json:"files"`
+	Additions int            `json:"additions"`
+	Deletions int            `json:"deletions"`
+	Patch     string         `json:"patch"`
+	Truncated bool           `json:"truncated"`
+}
+
+func buildDiff(repoPath, from, to string, paths []string) (diffResponse, error) {
+	var d diffResponse
+	stats, err := git.DiffStats(repoPath, from, to, paths...)
+	if err != nil {
+		return d, err
+	}
+	patch, err := git.DiffTrees(repoPath, from, to, paths...)
+	if err != nil {
+		return d, err
+	}
+	d.Files = stats
+	for _, f := range stats {
+		d.Additions += f.Additions
+		d.Deletions += f.Deletions
+	}
+	if len(patch) > maxPatchSize {
+		patch = patch[:maxPatchSize]
+		d.Truncated = true
+	}
+	d.Patch = patch
+	return d, nil
+}
+
+func writeSessionLookupError(w http.ResponseWriter, id string, err error) {
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("session %s not found", id))
+		return
+	}
+	WriteError(w, http.StatusInternalServerError, err.Error())
+}
+
+// HandleDiff returns the changes a session has made relative to the branch
+// it was created from, including uncommitted work. Query param path limits
+// the diff to a file or directory.
+func (h *SessionsHandler) HandleDiff(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s, err := loadSessionGit(h.db, id)
+	if err != nil {
+		writeSessionLookupError(w, id, err)
+		return
+	}
+
+	base, err := s.base()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	tree, err := s.tree()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var paths []string
+	if p := r.URL.Query().Get("path"); p != "" {
+		paths = append(paths, p)
+	}
+	d, err := buildDiff(s.BarePath, base, tree, paths)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"session_id":    s.ID,
+		"branch":        s.Branch,
+		"source_branch": s.SourceBranch,
+		"base_commit":   base,
+		"files":         d.Files,
+		"additions":     d.Additions,
+		"deletions":     d.Deletions,
+		"patch":         d.Patch,
+		"truncated":     d.Truncated,
+	})
+}
+
+// HandleCompare diffs two sessions' results against each other: the patch
+// turns session a's tree into session b's. Both must belong to the same repo.
+// Query params: a, b (session IDs) and optional path.
+func (h *SessionsHandler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	idA, idB := q.Get("a"), q.Get("b")
+	if idA == "" || idB == "" {
+		WriteError(w, http.StatusBadRequest, "a and b session IDs are required")
+		return
+	}
+
+	a, err := loadSessionGit(h.db, idA)
+	if err != nil {
+		writeSessionLookupError(w, idA, err)
+		return
+	}
+	b, err := loadSessionGit(h.db, idB)
+	if err != nil {
+		writeSessionLookupError(w, idB, err)
+		return
+	}
+	if a.RepoID != b.RepoID {
+		WriteError(w, http.StatusBadRequest, "sessions belong to different repositories")
+		return
+	}
+
+	treeA, err := a.tree()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	treeB, err := b.tree()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var paths []string
+	if p := q.Get("path"); p != "" {
+		paths = append(paths, p)
+	}
+	d, err := buildDiff(a.BarePath, treeA, treeB, paths)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"a":         map[string]string{"session_id": a.ID, "branch": a.Branch},
+		"b":         map[string]string{"session_id": b.ID, "branch": b.Branch},
+		"files":     d.Files,
+		"additions": d.Additions,
+		"deletions": d.Deletions,
+		"patch":     d.Patch,
+		"truncated": d.Truncated,
+	})
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/peterje/superposition/internal/git"
+)
+
+const (
+	defaultLogLimit = 50
+	maxLogLimit     = 500
+	// maxDiffLines caps the hunk lines returned by the structured diff
+	// endpoints; files past the cap are listed without hunks.
+	maxDiffLines = 20000
+)
+
+// requireWorktree loads a session and checks its worktree is still on disk.
+func (h *SessionsHandler) requireWorktree(w http.ResponseWriter, id string) (sessionGit, bool) {
+	s, err := loadSessionGit(h.db, id)
+	if err != nil {
+		writeSessionLookupError(w, id, err)
+		return s, false
+	}
+	if !s.hasWorktree() {
+		WriteError(w, http.StatusConflict, "session worktree no longer exists")
+		return s, false
+	}
+	return s, true
+}
+
+// limitDiff drops hunks once maxLines diff lines have been kept, and reports
+// whether anything was dropped.
+func limitDiff(files []git.FileDiff, maxLines int) bool {
+	truncated := false
+	for i := range files {
+		kept := files[i].Hunks[:0]
+		for _, h := range files[i].Hunks {
+			if truncated || len(h.Lines) > maxLines {
+				truncated = true
+				continue
+			}
+			maxLines -= len(h.Lines)
+			kept = append(kept, h)
+		}
+		files[i].Hunks = kept
+	}
+	return truncated
+}
+
+// HandleGitStatus returns the branch, ahead/behind counts and changed files
+// of a session's worktree.
+func (h *SessionsHandler) HandleGitStatus(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.requireWorktree(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	status, err := git.Status(s.WorktreePath)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, status)
+}
+
+// HandleGitDiff returns a structured diff of a session's changes.
+// Query params:
+//   - mode: "worktree" (default; uncommitted changes to tracked files),
+//     "staged", "unstaged", or "base" (everything since the session's branch
+//     forked from its source branch, including uncommitted and untracked files)
+//   - path: limit to a file or directory
+//   - context: lines of context around changes
+func (h *SessionsHandler) HandleGitDiff(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	q := r.URL.Query()
+
+	mode := q.Get("mode")
+	if mode == "" {
+		mode = "worktree"
+	}
+	contextLines := -1
+	if raw := q.Get("context"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			WriteError(w, http.StatusBadRequest, "context must be a non-negative integer")
+			return
+		}
+		contextLines = n
+	}
+	var paths []string
+	if p := q.Get("path"); p != "" {
+		paths = append(paths, p)
+	}
+
+	var s sessionGit
+	var files []git.FileDiff
+	var err error
+	resp := map[string]any{"mode": mode}
+	switch mode {
+	case "worktree", "staged", "unstaged":
+		var ok bool
+		if s, ok = h.requireWorktree(w, id); !ok {
+			return
+		}
+		switch mode {
+		case "worktree":
+			files, err = git.Diff(s.WorktreePath, "HEAD", "", contextLines, paths...)
+		case "staged":
+			files, err = git.DiffStaged(s.WorktreePath, contextLines, paths...)
+		case "unstaged":
+			files, err = git.DiffUnstaged(s.WorktreePath, contextLines, paths...)
+		}
+	case "base":
+		if s, err = loadSessionGit(h.db, id); err != nil {
+			writeSessionLookupError(w, id, err)
+			return
+		}
+		var base, tree string
+		if base, err = s.base(); err == nil {
+			if tree, err = s.tree(); err == nil {
+				files, err = git.Diff(s.BarePath, base, tree, contextLines, paths...)
+			}
+		}
+		resp["source_branch"] = s.SourceBranch
+		resp["base_commit"] = base
+	default:
+		WriteError(w, http.StatusBadRequest, "mode must be worktree, staged, unstaged or base")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	additions, deletions := 0, 0
+	for _, f := range files {
+		additions += f.Additions
+		deletions += f.Deletions
+	}
+	resp["files"] = files
+	resp["additions"] = additions
+	resp["deletions"] = deletions
+	resp["truncated"] = limitDiff(files, maxDiffLines)
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// HandleGitLog returns the commits on a session's branch, newest first.
+// Query params: limit (default 50), since_base=true to only list commits
+// made since the branch forked from its source branch.
+func (h *SessionsHandler) HandleGitLog(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s, err := loadSessionGit(h.db, id)
+	if err != nil {
+		writeSessionLookupError(w, id, err)
+		return
+	}
+
+	limit := defaultLogLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			limit = min(n, maxLogLimit)
+		}
+	}
+
+	repoPath, head := s.BarePath, "refs/heads/"+s.Branch
+	if s.hasWorktree() {
+		repoPath, head = s.WorktreePath, "HEAD"
+	}
+	rev := head
+	if r.URL.Query().Get("since_base") == "true" {
+		base, err := s.base()
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		rev = base + ".." + head
+	}
+
+	commits, err := git.Log(repoPath, rev, limit)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, commits)
+}
+
+// HandleGitShow returns one commit of a session's repo with its structured
+// diff. Query param: rev (commit hash or ref).
+func (h *SessionsHandler) HandleGitShow(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s, err := loadSessionGit(h.db, id)
+	if err != nil {
+		writeSessionLookupError(w, id, err)
+		return
+	}
+
+	rev := r.URL.Query().Get("rev")
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		WriteError(w, http.StatusBadRequest, "rev is required")
+		return
+	}
+	repoPath := s.BarePath
+	if s.hasWorktree() {
+		repoPath = s.WorktreePath
+	}
+
+	commit, files, err := git.Show(repoPath, rev)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	truncated := limitDiff(files, maxDiffLines)
+	WriteJSON(w, http.StatusOK, map[string]any{"commit": commit, "files": files, "truncated": truncated})
+}
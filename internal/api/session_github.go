@@ -0,0 +1,252 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/peterje/superposition/internal/git"
+	"github.com/peterje/superposition/internal/github"
+)
+
+const (
+	maxBranchSlug = 40
+	// maxSeedPrompt caps prompts built from GitHub content, since they are
+	// typed into the CLI.
+	maxSeedPrompt = 32 << 10
+)
+
+// issueBranchName names the branch for work on an issue, e.g.
+// "issue-42-fix-login-redirect".
+func issueBranchName(number int, title string) string {
+	slug := strings.Trim(branchSlugRe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > maxBranchSlug {
+		slug = strings.TrimRight(slug[:maxBranchSlug], "-")
+	}
+	if slug == "" {
+		return fmt.Sprintf("issue-%d", number)
+	}
+	return fmt.Sprintf("issue-%d-%s", number, slug)
+}
+
+// truncatePrompt cuts prompt to at most maxSeedPrompt bytes, backing off to
+// a rune boundary so a multi-byte character isn't split.
+func truncatePrompt(prompt string) string {
+	if len(prompt) <= maxSeedPrompt {
+		return prompt
+	}
+	cut := maxSeedPrompt
+	for cut > 0 && !utf8.RuneStart(prompt[cut]) {
+		cut--
+	}
+	return prompt[:cut] + "\n\n[truncated]"
+}
+
+// issuePrompt builds the initial prompt for a session working on an issue.
+func issuePrompt(owner, name string, issue github.Issue, comments []github.Comment) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Work on GitHub issue #%d in %s/%s: %s\n", issue.Number, owner, name, issue.Title)
+	fmt.Fprintf(&b, "%s\n", issue.HTMLURL)
+	if len(issue.Labels) > 0 {
+		fmt.Fprintf(&b, "Labels: %s\n", strings.Join(issue.Labels, ", "))
+	}
+	if body := strings.TrimSpace(issue.Body); body != "" {
+		fmt.Fprintf(&b, "\n%s\n", body)
+	}
+	if len(comments) > 0 {
+		b.WriteString("\nComments:\n")
+		for _, c := range comments {
+			fmt.Fprintf(&b, "\n@%s (%s):\n%s\n", c.User, c.CreatedAt.Format("2006-01-02"), strings.TrimSpace(c.Body))
+		}
+	}
+	return truncatePrompt(b.String())
+}
+
+// hunkTail returns the last n lines of a review comment's diff hunk, which
+// end at the commented line.
+func hunkTail(hunk string, n int) string {
+	lines := strings.Split(strings.TrimRight(hunk, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// reviewPrompt builds the initial prompt for a session addressing the
+// unresolved review threads of a pull request.
+func reviewPrompt(pr github.PullRequest, threads []github.ReviewThread) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Address the unresolved review comments on pull request #%d: %s\n", pr.Number, pr.Title)
+	fmt.Fprintf(&b, "%s\n", pr.HTMLURL)
+	for i, t := range threads {
+		loc := t.Path
+		if t.Line > 0 {
+			loc = fmt.Sprintf("%s:%d", t.Path, t.Line)
+		}
+		if t.IsOutdated {
+			loc += " (outdated)"
+		}
+		fmt.Fprintf(&b, "\n%d. %s\n", i+1, loc)
+		if len(t.Comments) > 0 && t.Comments[0].DiffHunk != "" {
+			fmt.Fprintf(&b, "```diff\n%s\n```\n", hunkTail(t.Comments[0].DiffHunk, 6))
+		}
+		for _, c := range t.Comments {
+			fmt.Fprintf(&b, "@%s: %s\n", c.Author, strings.TrimSpace(c.Body))
+		}
+	}
+	return truncatePrompt(b.String())
+}
+
+// HandleCreateFromIssue starts a session on a new branch named after a
+// GitHub issue, seeded with the issue's title, body and comments. Body:
+// {"repo_id", "issue_number", "cli_type", "source_branch", "new_branch",
+// "template_id"}; all but repo_id and issue_number are optional.
+func (h *SessionsHandler) HandleCreateFromIssue(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		createSessionParams
+		IssueNumber int `json:"issue_number"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if body.IssueNumber <= 0 {
+		WriteError(w, http.StatusBadRequest, "issue_number is required")
+		return
+	}
+
+	owner, name, err := githubRepo(h.db, body.RepoID)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "repository not found or not a GitHub repository")
+		return
+	}
+	client, err := githubClient(h.db)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	issue, err := client.GetIssue(owner, name, body.IssueNumber)
+	if github.IsNotFound(err) {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("issue #%d not found", body.IssueNumber))
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if issue.IsPullRequest {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("#%d is a pull request; use /api/sessions/from-pr", issue.Number))
+		return
+	}
+	var comments []github.Comment
+	if issue.Comments > 0 {
+		if comments, err = client.ListIssueComments(owner, name, issue.Number); err != nil {
+			WriteError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+
+	p := body.createSessionParams
+	if p.NewBranch == "" {
+		p.NewBranch = issueBranchName(issue.Number, issue.Title)
+	}
+	p.Prompt = issuePrompt(owner, name, issue, comments)
+
+	session, err := createSession(h.db, h.manager, h.webhooks, p)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusCreated, map[string]any{"session": session, "issue": issue})
+}
+
+// HandleCreateFromPR starts a session on an existing pull request's branch,
+// seeded with its unresolved review comments, so pushing from the session
+// updates the pull request. Body: {"repo_id", "pr_number", "cli_type"}.
+func (h *SessionsHandler) HandleCreateFromPR(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RepoID   int64  `json:"repo_id"`
+		PRNumber int    `json:"pr_number"`
+		CLIType  string `json:"cli_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if body.PRNumber <= 0 {
+		WriteError(w, http.StatusBadRequest, "pr_number is required")
+		return
+	}
+
+	owner, name, err := githubRepo(h.db, body.RepoID)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "repository not found or not a GitHub repository")
+		return
+	}
+	client, err := githubClient(h.db)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pr, err := client.GetPullRequest(owner, name, body.PRNumber)
+	if github.IsNotFound(err) {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("pull request #%d not found", body.PRNumber))
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if pr.State != "open" {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("pull request #%d is %s", pr.Number, pr.State))
+		return
+	}
+	if !strings.EqualFold(pr.HeadRepo, owner+"/"+name) {
+		WriteError(w, http.StatusBadRequest, "pull requests from forks are not supported")
+		return
+	}
+
+	threads, err := client.ListReviewThreads(owner, name, pr.Number)
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	unresolved := []github.ReviewThread{}
+	for _, t := range threads {
+		if !t.IsResolved {
+			unresolved = append(unresolved, t)
+		}
+	}
+	if len(unresolved) == 0 {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("pull request #%d has no unresolved review comments", pr.Number))
+		return
+	}
+
+	// Make sure the local copy of the PR branch is current.
+	var barePath string
+	h.db.QueryRow(`SELECT local_path FROM repositories WHERE id = ?`, body.RepoID).Scan(&barePath)
+	if err := git.Fetch(barePath, repoGitAuth(h.db, body.RepoID)); err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	session, err := createSession(h.db, h.manager, h.webhooks, createSessionParams{
+		RepoID:         body.RepoID,
+		SourceBranch:   pr.Base,
+		NewBranch:      pr.Head,
+		CLIType:        body.CLIType,
+		Prompt:         reviewPrompt(pr, unresolved),
+		existingBranch: true,
+	})
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusCreated, map[string]any{
+		"session": session, "pull_request": pr, "threads": unresolved,
+	})
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	ptymgr "github.com/peterje/superposition/internal/pty"
+)
+
+const (
+	promptReadyTimeout = 2 * time.Minute
+	// promptSettle is how long output must stay quiet after the ready
+	// pattern appears, so the prompt isn't typed into a half-drawn UI.
+	promptSettle = 500 * time.Millisecond
+)
+
+// cliReadyPatterns match the input box each CLI draws once it accepts a
+// prompt. They can be overridden with the cli_ready_pattern.<cli> setting.
+var cliReadyPatterns = map[string]string{
+	"claude": `\? for shortcuts|Try "`,
+	"codex":  `\? for shortcuts|context left|⏎ send`,
+	"gemini": `Type your message`,
+}
+
+func readyPattern(db *sql.DB, cliType string) (*regexp.Regexp, error) {
+	pattern := cliReadyPatterns[cliType]
+	if val := settingValue(db, "cli_ready_pattern."+cliType); val != "" {
+		pattern = val
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("no ready pattern for %s", cliType)
+	}
+	return regexp.Compile(pattern)
+}
+
+// sendInitialPrompt waits until the CLI shows its input prompt and then types
+// prompt into it and submits it. The prompt is sent as a bracketed paste so
+// that newlines don't submit it early.
+func sendInitialPrompt(db *sql.DB, sess ptymgr.SessionHandle, sessionID, cliType, prompt string) {
+	re, err := readyPattern(db, cliType)
+	if err != nil {
+		log.Printf("Session %s: not sending initial prompt: %v", sessionID, err)
+		return
+	}
+	if err := waitForReady(sess, re, promptReadyTimeout); err != nil {
+		log.Printf("Session %s: not sending initial prompt: %v", sessionID, err)
+		return
+	}
+
+	if _, err := sess.Write(bracketedPaste(prompt)); err != nil {
+		log.Printf("Session %s: failed to send initial prompt: %v", sessionID, err)
+		return
+	}
+	// Give the CLI a moment to take the paste before pressing enter.
+	time.Sleep(200 * time.Millisecond)
+	sess.Write([]byte("\r"))
+	log.Printf("Session %s: sent initial prompt", sessionID)
+}
+
+// bracketedPaste wraps prompt in bracketed paste markers. The prompt may
+// contain text from GitHub, so control characters other than newlines and
+// tabs are dropped first: an ESC in it could end the paste early and have
+// the rest typed as keystrokes.
+func bracketedPaste(prompt string) []byte {
+	prompt = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, prompt)
+	return []byte("\x1b[200~" + prompt + "\x1b[201~")
+}
+
+// waitForReady waits for the session's output, including what it printed
+// before we subscribed, to match re and then go quiet for promptSettle.
+func waitForReady(sess ptymgr.SessionHandle, re *regexp.Regexp, timeout time.Duration) error {
+	ch, unsub := sess.Subscribe()
+	defer unsub()
+
+	buf := sess.Replay()
+	if len(buf) > maxWaitOutputBuf {
+		buf = buf[len(buf)-maxWaitOutputBuf:]
+	}
+	ready := re.MatchString(stripANSI(string(buf)))
+
+	settle := time.NewTimer(promptSettle)
+	defer settle.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("session exited")
+			}
+			if !ready {
+				buf = append(buf, data...)
+				if len(buf) > maxWaitOutputBuf {
+					buf = buf[len(buf)-maxWaitOutputBuf:]
+				}
+				ready = re.MatchString(stripANSI(string(buf)))
+			}
+			if !settle.Stop() {
+				select {
+				case <-settle.C:
+				default:
+				}
+			}
+			settle.Reset(promptSettle)
+		case <-settle.C:
+			if ready {
+				return nil
+			}
+		case <-sess.Done():
+			return fmt.Errorf("session exited")
+		case <-deadline.C:
+			return fmt.Errorf("timed out after %s waiting for the CLI prompt (%q)", timeout, re.String())
+		}
+	}
+}
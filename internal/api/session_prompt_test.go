@@ -0,0 +1,31 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/peterje/superposition/internal/github"
+)
+
+func TestBracketedPasteStripsControls(t *testing.T) {
+	issue := github.Issue{
+		Number: 1,
+		Title:  "Title\x1b[201~",
+		Body:   "line one\n\tindented\x1b[201~rm -rf ~\r\x9b\u009b201~\x07done",
+	}
+	paste := bracketedPaste(issuePrompt("o", "r", issue, nil))
+
+	if !bytes.HasPrefix(paste, []byte("\x1b[200~")) || !bytes.HasSuffix(paste, []byte("\x1b[201~")) {
+		t.Fatalf("paste = %q, want it wrapped in paste markers", paste)
+	}
+	inner := string(paste[len("\x1b[200~") : len(paste)-len("\x1b[201~")])
+	for _, r := range inner {
+		if r == '\x1b' || r == '\r' || r == '\x07' || r == '\u009b' {
+			t.Errorf("paste contents %q contain control character %U", inner, r)
+		}
+	}
+	if !strings.Contains(inner, "line one\n\tindented[201~rm -rf ~") {
+		t.Errorf("paste contents %q lost newlines, tabs or text", inner)
+	}
+}
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/peterje/superposition/internal/git"
+	"github.com/peterje/superposition/internal/github"
+)
+
+// githubPAT returns the stored GitHub personal access token, or "".
+func githubPAT(db *sql.DB) string {
+	return settingValue(db, "github_pat")
+}
+
+// pushSession pushes a session's branch to origin and fires session.pushed.
+// It returns the pushed commit.
+func pushSession(db *sql.DB, webhooks *WebhooksHandler, s sessionGit, force bool) (string, error) {
+	if err := git.Push(s.WorktreePath, s.Branch, repoGitAuth(db, s.RepoID), force); err != nil {
+		return "", err
+	}
+	var commit string
+	if commits, err := git.Log(s.WorktreePath, "HEAD", 1); err == nil && len(commits) > 0 {
+		commit = commits[0].Hash
+	}
+	webhooks.FireWebhook("session.pushed", s.ID, map[string]any{
+		"repo_id": s.RepoID, "branch": s.Branch, "commit": commit,
+	})
+	return commit, nil
+}
+
+// HandleGitCommit commits the changes in a session's worktree. Body:
+// {"message": "...", "all": true}; all (the default) stages every change
+// first, otherwise only already-staged changes are committed.
+func (h *SessionsHandler) HandleGitCommit(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.requireWorktree(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Message string `json:"message"`
+		All     *bool  `json:"all"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if strings.TrimSpace(body.Message) == "" {
+		WriteError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	all := body.All == nil || *body.All
+
+	committed, err := git.CommitChanges(s.WorktreePath, body.Message, all)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !committed {
+		WriteJSON(w, http.StatusOK, map[string]any{"committed": false})
+		return
+	}
+	commits, err := git.Log(s.WorktreePath, "HEAD", 1)
+	if err != nil || len(commits) == 0 {
+		WriteJSON(w, http.StatusCreated, map[string]any{"committed": true})
+		return
+	}
+	WriteJSON(w, http.StatusCreated, map[string]any{"committed": true, "commit": commits[0]})
+}
+
+// HandleGitPush pushes a session's branch to origin using the repository's
+// credentials. Body (optional): {"force": true} to force-push with lease.
+func (h *SessionsHandler) HandleGitPush(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.requireWorktree(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Force bool `json:"force"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+	}
+
+	commit, err := pushSession(h.db, h.webhooks, s, body.Force)
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{"branch": s.Branch, "commit": commit})
+}
+
+// HandlePullRequest pushes a session's branch and opens a pull request (a
+// merge request on GitLab) for it. Body: {"title", "body", "base", "draft"}; base defaults to
+// the branch the session was created from. If the branch already has an
+// open pull request, that one is returned with 200 instead.
+func (h *SessionsHandler) HandlePullRequest(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.requireWorktree(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+		Base  string `json:"base"`
+		Draft bool   `json:"draft"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if strings.TrimSpace(body.Title) == "" {
+		WriteError(w, http.StatusBadRequest, "title is required")
+		return
+	}
+	if body.Base == "" {
+		body.Base = s.SourceBranch
+	}
+
+	client, owner, name, err := repoProvider(h.db, s.RepoID)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "pull requests are not available: "+err.Error())
+		return
+	}
+
+	if _, err := pushSession(h.db, h.webhooks, s, false); err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	existing, err := client.ListPullRequestsForBranch(owner, name, s.Branch, "open")
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if len(existing) > 0 {
+		WriteJSON(w, http.StatusOK, existing[0])
+		return
+	}
+
+	pr, err := client.CreatePullRequest(owner, name, github.NewPullRequest{
+		Title: body.Title, Body: body.Body, Head: s.Branch, Base: body.Base, Draft: body.Draft,
+	})
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	h.webhooks.FireWebhook("session.pr_opened", s.ID, map[string]any{
+		"repo_id": s.RepoID, "branch": s.Branch, "base": pr.Base,
+		"number": pr.Number, "url": pr.HTMLURL, "title": pr.Title,
+	})
+	WriteJSON(w, http.StatusCreated, pr)
+}
+
+// sessionGitHub returns a GitHub client and the owner and name of a
+// session's repository, writing an error response if either is unavailable.
+func (h *SessionsHandler) sessionGitHub(w http.ResponseWriter, s sessionGit) (*github.Client, string, string, bool) {
+	owner, name, err := githubRepo(h.db, s.RepoID)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "pull requests are only available for GitHub repositories")
+		return nil, "", "", false
+	}
+	client, err := githubClient(h.db)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return nil, "", "", false
+	}
+	return client, owner, name, true
+}
+
+// sessionPullRequest returns the most recent pull request for a session's
+// branch, or nil if there is none.
+func sessionPullRequest(client *github.Client, owner, name, branch string) (*github.PullRequest, error) {
+	prs, err := client.ListPullRequestsForBranch(owner, name, branch, "all")
+	if err != nil || len(prs) == 0 {
+		return nil, err
+	}
+	latest := prs[0]
+	for _, pr := range prs[1:] {
+		if pr.Number > latest.Number {
+			latest = pr
+		}
+	}
+	return &latest, nil
+}
+
+// HandleGetPullRequest returns the pull request for a session's branch and
+// the status of its checks. pull_request is null if none has been opened.
+func (h *SessionsHandler) HandleGetPullRequest(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s, err := loadSessionGit(h.db, id)
+	if err != nil {
+		writeSessionLookupError(w, id, err)
+		return
+	}
+	client, owner, name, ok := h.sessionGitHub(w, s)
+	if !ok {
+		return
+	}
+
+	pr, err := sessionPullRequest(client, owner, name, s.Branch)
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	resp := map[string]any{"pull_request": pr, "checks": nil}
+	if pr != nil {
+		checks, err := client.GetCheckStatus(owner, name, pr.HeadSHA)
+		if err != nil {
+			WriteError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		resp["checks"] = checks
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// HandleUpdatePullRequest edits the pull request for a session's branch.
+// Body: any of {"title", "body", "base", "state"}.
+func (h *SessionsHandler) HandleUpdatePullRequest(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s, err := loadSessionGit(h.db, id)
+	if err != nil {
+		writeSessionLookupError(w, id, err)
+		return
+	}
+
+	var update github.PullRequestUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if update.State != nil && *update.State != "open" && *update.State != "closed" {
+		WriteError(w, http.StatusBadRequest, "state must be 'open' or 'closed'")
+		return
+	}
+
+	client, owner, name, ok := h.sessionGitHub(w, s)
+	if !ok {
+		return
+	}
+	pr, err := sessionPullRequest(client, owner, name, s.Branch)
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if pr == nil {
+		WriteError(w, http.StatusNotFound, "no pull request for this session")
+		return
+	}
+	updated, err := client.UpdatePullRequest(owner, name, pr.Number, update)
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, updated)
+}
+
+// HandlePullRequestComment posts a comment on the pull request for a
+// session's branch. Body: {"body": "..."}.
+func (h *SessionsHandler) HandlePullRequestComment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s, err := loadSessionGit(h.db, id)
+	if err != nil {
+		writeSessionLookupError(w, id, err)
+		return
+	}
+
+	var body struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if strings.TrimSpace(body.Body) == "" {
+		WriteError(w, http.StatusBadRequest, "body is required")
+		return
+	}
+
+	client, owner, name, ok := h.sessionGitHub(w, s)
+	if !ok {
+		return
+	}
+	pr, err := sessionPullRequest(client, owner, name, s.Branch)
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if pr == nil {
+		WriteError(w, http.StatusNotFound, "no pull request for this session")
+		return
+	}
+	comment, err := client.CreateIssueComment(owner, name, pr.Number, body.Body)
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusCreated, comment)
+}
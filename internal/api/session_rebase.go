@@ -0,0 +1,122 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/peterje/superposition/internal/git"
+)
+
+// baseUpdate is the result of bringing a session's branch up to date with
+// its source branch.
+type baseUpdate struct {
+	Method       string `json:"method"` // "rebase" or "merge"
+	SourceBranch string `json:"source_branch"`
+	PreviousBase string `json:"previous_base"`
+	BaseCommit   string `json:"base_commit"`
+	Head         string `json:"head"`
+	UpToDate     bool   `json:"up_to_date"`
+}
+
+// updateSessionBase rebases a session's branch onto the latest fetched
+// commit of its source branch, or merges that commit into it, and records
+// the commit as the session's base. It refuses while the worktree has
+// uncommitted changes or a stopped rebase or merge. Conflicts are returned
+// as a *git.ConflictError; the operation is aborted unless leaveConflicts
+// is set, in which case it is left for the session's CLI to resolve.
+func updateSessionBase(db *sql.DB, webhooks *WebhooksHandler, s sessionGit, method string, leaveConflicts bool) (baseUpdate, error) {
+	u := baseUpdate{Method: method, SourceBranch: s.SourceBranch}
+	if op := git.OperationInProgress(s.WorktreePath); op != "" {
+		return u, &sessionError{http.StatusConflict, fmt.Sprintf("a %s is already in progress in the session's worktree", op)}
+	}
+	dirty, err := worktreeDirty(s.WorktreePath)
+	if err != nil {
+		return u, err
+	}
+	if dirty {
+		return u, &sessionError{http.StatusConflict, "worktree has uncommitted changes; commit them first"}
+	}
+
+	sourceRef := git.SourceRef(s.BarePath, s.SourceBranch)
+	target, err := git.RevParse(s.BarePath, sourceRef)
+	if err != nil {
+		return u, &sessionError{http.StatusConflict, fmt.Sprintf("source branch %s not found", s.SourceBranch)}
+	}
+	if u.PreviousBase, err = s.base(); err != nil {
+		return u, err
+	}
+
+	if git.IsAncestor(s.WorktreePath, target, "HEAD") {
+		u.UpToDate = true
+	} else if method == "rebase" {
+		err = git.Rebase(s.WorktreePath, target, !leaveConflicts)
+	} else {
+		err = git.Merge(s.WorktreePath, target, fmt.Sprintf("Merge branch '%s' into %s", s.SourceBranch, s.Branch), !leaveConflicts)
+	}
+	if err != nil {
+		return u, err
+	}
+
+	u.BaseCommit = target
+	u.Head, _ = git.RevParse(s.WorktreePath, "HEAD")
+	if _, err := db.Exec(`UPDATE sessions SET base_commit = ?, source_behind = 0 WHERE id = ?`, target, s.ID); err != nil {
+		log.Printf("Session %s: failed to record base commit: %v", s.ID, err)
+	}
+	if !u.UpToDate {
+		log.Printf("Session %s: %s onto %s (%s)", s.ID, method, s.SourceBranch, target)
+		webhooks.FireWebhook("session.base_updated", s.ID, map[string]any{
+			"method": method, "source_branch": s.SourceBranch, "base_commit": target, "head": u.Head,
+		})
+	}
+	return u, nil
+}
+
+// HandleGitRebase rebases a session's branch onto the latest fetched commit
+// of its source branch. Body (optional): {"leave_conflicts": true} to leave
+// a conflicted rebase in progress instead of aborting it. Conflicts are
+// reported with 409 and the conflicting paths.
+func (h *SessionsHandler) HandleGitRebase(w http.ResponseWriter, r *http.Request) {
+	h.handleBaseUpdate(w, r, "rebase")
+}
+
+// HandleGitMergeBaseUpdate merges the latest fetched commit of a session's
+// source branch into its branch. It takes the same body as HandleGitRebase.
+func (h *SessionsHandler) HandleGitMergeBaseUpdate(w http.ResponseWriter, r *http.Request) {
+	h.handleBaseUpdate(w, r, "merge")
+}
+
+func (h *SessionsHandler) handleBaseUpdate(w http.ResponseWriter, r *http.Request, method string) {
+	s, ok := h.requireWorktree(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var body struct {
+		LeaveConflicts bool `json:"leave_conflicts"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+	}
+
+	u, err := updateSessionBase(h.db, h.webhooks, s, method, body.LeaveConflicts)
+	var conflict *git.ConflictError
+	if errors.As(err, &conflict) {
+		WriteJSON(w, http.StatusConflict, struct {
+			Error string `json:"error"`
+			*git.ConflictError
+		}{conflict.Error(), conflict})
+		return
+	}
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, u)
+}
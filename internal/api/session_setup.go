@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	setupCommandTimeout = 10 * time.Minute
+	maxSetupLogSize     = 256 << 10 // keep the last 256KB of setup output
+	setupFlushInterval  = time.Second
+)
+
+// setupLog collects setup command output and periodically saves it to the
+// session_setup table so it can be followed while setup is running.
+type setupLog struct {
+	db        *sql.DB
+	sessionID string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (l *setupLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	if len(l.buf) > maxSetupLogSize {
+		l.buf = l.buf[len(l.buf)-maxSetupLogSize:]
+	}
+	return len(p), nil
+}
+
+func (l *setupLog) save(status, errMsg string) {
+	l.mu.Lock()
+	text := string(l.buf)
+	l.mu.Unlock()
+	l.db.Exec(`UPDATE session_setup SET status = ?, log = ?, error = ?, updated_at = ? WHERE session_id = ?`,
+		status, text, errMsg, time.Now(), l.sessionID)
+}
+
+// runSessionSetup runs the repo's setup commands in a new session's worktree,
+// one after another, stopping at the first failure.
+func runSessionSetup(db *sql.DB, sessionID, worktreePath string, commands []string, env map[string]string) error {
+	if _, err := db.Exec(`INSERT INTO session_setup (session_id, status, updated_at) VALUES (?, 'running', ?)`,
+		sessionID, time.Now()); err != nil {
+		return fmt.Errorf("record setup: %w", err)
+	}
+	out := &setupLog{db: db, sessionID: sessionID}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(setupFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				out.save("running", "")
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	env, err := resolveEnvSecrets(db, env)
+	if err != nil {
+		out.save("failed", err.Error())
+		return err
+	}
+	cmdEnv := os.Environ()
+	for k, v := range env {
+		cmdEnv = append(cmdEnv, k+"="+v)
+	}
+
+	for _, command := range commands {
+		fmt.Fprintf(out, "$ %s\n", command)
+		if err := runSetupCommand(worktreePath, command, cmdEnv, out); err != nil {
+			msg := fmt.Sprintf("setup command %q: %v", command, err)
+			fmt.Fprintf(out, "%s\n", msg)
+			log.Printf("Session %s: %s", sessionID, msg)
+			out.save("failed", msg)
+			return fmt.Errorf("%s", msg)
+		}
+	}
+	out.save("succeeded", "")
+	return nil
+}
+
+func runSetupCommand(dir, command string, env []string, out *setupLog) error {
+	ctx, cancel := context.WithTimeout(context.Background(), setupCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", setupCommandTimeout)
+	}
+	return err
+}
+
+// HandleGetSetup returns the status and output of a session's setup commands.
+func (h *SessionsHandler) HandleGetSetup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var status, logText, errMsg string
+	var updatedAt time.Time
+	err := h.db.QueryRow(`SELECT status, log, error, updated_at FROM session_setup WHERE session_id = ?`, id).
+		Scan(&status, &logText, &errMsg, &updatedAt)
+	if err == sql.ErrNoRows {
+		WriteJSON(w, http.StatusOK, map[string]any{"status": "none", "log": "", "error": ""})
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"status":     status,
+		"log":        logText,
+		"error":      errMsg,
+		"updated_at": updatedAt,
+	})
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peterje/superposition/internal/git"
+	"github.com/peterje/superposition/internal/secrets"
+)
+
+type SessionTemplatesHandler struct {
+	db *sql.DB
+}
+
+func NewSessionTemplatesHandler(db *sql.DB) *SessionTemplatesHandler {
+	return &SessionTemplatesHandler{db: db}
+}
+
+// sessionTemplate is a saved session setup. SourceBranch may be a glob, in
+// which case the most recently updated matching branch is used. BranchPattern
+// names the new branch and may use {{.template}}, {{.id}}, {{.date}} and
+// {{.time}}.
+type sessionTemplate struct {
+	ID            int64             `json:"id"`
+	Name          string            `json:"name"`
+	RepoID        *int64            `json:"repo_id"`
+	SourceBranch  string            `json:"source_branch"`
+	BranchPattern string            `json:"branch_pattern"`
+	CLIType       string            `json:"cli_type"`
+	Env           map[string]string `json:"env"`
+	MCPServers    map[string]any    `json:"mcp_servers"`
+	Prompt        string            `json:"prompt"`
+	CreatedAt     string            `json:"created_at"`
+}
+
+const sessionTemplateColumns = `id, name, repo_id, source_branch, branch_pattern, cli_type, env, mcp_servers, prompt, created_at`
+
+func scanSessionTemplate(row interface {
+	Scan(...any) error
+}) (sessionTemplate, error) {
+	var t sessionTemplate
+	var repoID sql.NullInt64
+	var envJSON, mcpJSON string
+	if err := row.Scan(&t.ID, &t.Name, &repoID, &t.SourceBranch, &t.BranchPattern, &t.CLIType,
+		&envJSON, &mcpJSON, &t.Prompt, &t.CreatedAt); err != nil {
+		return t, err
+	}
+	if repoID.Valid {
+		t.RepoID = &repoID.Int64
+	}
+	envJSON, err := secrets.Decrypt(envJSON)
+	if err != nil {
+		return t, fmt.Errorf("session template %s: env: %w", t.Name, err)
+	}
+	if err := json.Unmarshal([]byte(envJSON), &t.Env); err != nil || t.Env == nil {
+		t.Env = map[string]string{}
+	}
+	if err := json.Unmarshal([]byte(mcpJSON), &t.MCPServers); err != nil || t.MCPServers == nil {
+		t.MCPServers = map[string]any{}
+	}
+	return t, nil
+}
+
+func loadSessionTemplate(db *sql.DB, id int64) (sessionTemplate, error) {
+	return scanSessionTemplate(db.QueryRow(`SELECT `+sessionTemplateColumns+` FROM session_templates WHERE id = ?`, id))
+}
+
+func (t sessionTemplate) validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if t.CLIType != "" && !validCLIType(t.CLIType) {
+		return fmt.Errorf("cli_type must be 'claude', 'codex', or 'gemini'")
+	}
+	if t.BranchPattern != "" {
+		if _, err := expandBranchPattern(t.BranchPattern, t.Name, "00000000"); err != nil {
+			return fmt.Errorf("branch_pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+var branchSlugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// expandBranchPattern returns the new branch name for a session created
+// from a template. The default pattern is "<template name>/<session id>".
+func expandBranchPattern(pattern, templateName, sessionID string) (string, error) {
+	slug := strings.Trim(branchSlugRe.ReplaceAllString(strings.ToLower(templateName), "-"), "-")
+	if slug == "" {
+		slug = "session"
+	}
+	if pattern == "" {
+		pattern = "{{.template}}/{{.id}}"
+	}
+	now := time.Now()
+	return expandTemplate(pattern, map[string]string{
+		"template": slug,
+		"id":       sessionID,
+		"date":     now.Format("20060102"),
+		"time":     now.Format("150405"),
+	})
+}
+
+// resolveSourceBranch returns the branch a template's source branch refers
+// to: the name itself, or the newest branch matching it if it is a glob.
+func resolveSourceBranch(barePath, sourceBranch string) (string, error) {
+	if !strings.ContainsAny(sourceBranch, "*?[") {
+		return sourceBranch, nil
+	}
+	branch, err := git.NewestBranch(barePath, sourceBranch)
+	if err != nil {
+		return "", err
+	}
+	if branch == "" {
+		return "", fmt.Errorf("no branch matches %q", sourceBranch)
+	}
+	return branch, nil
+}
+
+// HandleList returns all session templates.
+func (h *SessionTemplatesHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`SELECT ` + sessionTemplateColumns + ` FROM session_templates ORDER BY name, id`)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	result := []sessionTemplate{}
+	for rows.Next() {
+		t, err := scanSessionTemplate(rows)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		result = append(result, t)
+	}
+	WriteJSON(w, http.StatusOK, result)
+}
+
+// HandleGet returns a single session template.
+func (h *SessionTemplatesHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	t, err := loadSessionTemplate(h.db, id)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "session template not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, t)
+}
+
+// HandleCreate creates a session template.
+func (h *SessionTemplatesHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	h.save(w, r, 0)
+}
+
+// HandleUpdate replaces a session template.
+func (h *SessionTemplatesHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	h.save(w, r, id)
+}
+
+func (h *SessionTemplatesHandler) save(w http.ResponseWriter, r *http.Request, id int64) {
+	var body sessionTemplate
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if err := body.validate(); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.RepoID != nil {
+		var exists int
+		if err := h.db.QueryRow(`SELECT 1 FROM repositories WHERE id = ?`, *body.RepoID).Scan(&exists); err != nil {
+			WriteError(w, http.StatusBadRequest, "repository not found")
+			return
+		}
+	}
+	if body.Env == nil {
+		body.Env = map[string]string{}
+	}
+	if body.MCPServers == nil {
+		body.MCPServers = map[string]any{}
+	}
+	envJSON, _ := json.Marshal(body.Env)
+	envData, err := secrets.Encrypt(string(envJSON))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	mcpJSON, err := json.Marshal(body.MCPServers)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid mcp_servers")
+		return
+	}
+
+	status := http.StatusOK
+	if id == 0 {
+		res, err := h.db.Exec(`INSERT INTO session_templates (name, repo_id, source_branch, branch_pattern, cli_type, env, mcp_servers, prompt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			body.Name, body.RepoID, body.SourceBranch, body.BranchPattern, body.CLIType, envData, string(mcpJSON), body.Prompt)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		id, _ = res.LastInsertId()
+		status = http.StatusCreated
+	} else {
+		res, err := h.db.Exec(`UPDATE session_templates SET name = ?, repo_id = ?, source_branch = ?, branch_pattern = ?,
+			cli_type = ?, env = ?, mcp_servers = ?, prompt = ? WHERE id = ?`,
+			body.Name, body.RepoID, body.SourceBranch, body.BranchPattern, body.CLIType, envData, string(mcpJSON), body.Prompt, id)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			WriteError(w, http.StatusNotFound, "session template not found")
+			return
+		}
+	}
+
+	t, err := loadSessionTemplate(h.db, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, status, t)
+}
+
+// HandleDelete deletes a session template and returns 204.
+func (h *SessionTemplatesHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	res, err := h.db.Exec(`DELETE FROM session_templates WHERE id = ?`, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		WriteError(w, http.StatusNotFound, "session template not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
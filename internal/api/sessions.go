@@ -3,17 +3,21 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/peterje/superposition/internal/git"
 	"github.com/peterje/superposition/internal/models"
 	ptymgr "github.com/peterje/superposition/internal/pty"
+	"github.com/peterje/superposition/internal/secrets"
 )
 
 type SessionsHandler struct {
@@ -26,9 +30,17 @@ func NewSessionsHandler(db *sql.DB, manager ptymgr.SessionManager, webhooks *Web
 	return &SessionsHandler{db: db, manager: manager, webhooks: webhooks}
 }
 
-func (h *SessionsHandler) HandleList(w http.ResponseWriter, _ *http.Request) {
-	rows, err := h.db.Query(`SELECT s.id, s.repo_id, s.worktree_path, s.branch, s.cli_type, s.status, s.pid, s.created_at,
-		r.owner, r.name FROM sessions s JOIN repositories r ON s.repo_id = r.id ORDER BY s.created_at DESC`)
+// HandleList returns all sessions, newest first. ?batch_id= restricts the
+// list to one batch.
+func (h *SessionsHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT s.id, s.repo_id, s.worktree_path, s.branch, s.cli_type, s.status, s.pid, s.batch_id, s.created_at,
+		s.source_branch, s.base_commit, s.source_behind, r.owner, r.name FROM sessions s JOIN repositories r ON s.repo_id = r.id`
+	var args []any
+	if batchID := r.URL.Query().Get("batch_id"); batchID != "" {
+		query += ` WHERE s.batch_id = ?`
+		args = append(args, batchID)
+	}
+	rows, err := h.db.Query(query+` ORDER BY s.created_at DESC`, args...)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -39,12 +51,20 @@ func (h *SessionsHandler) HandleList(w http.ResponseWriter, _ *http.Request) {
 		models.Session
 		RepoOwner string `json:"repo_owner"`
 		RepoName  string `json:"repo_name"`
+
+		// BaseCommit is the commit of SourceBranch the session's branch is
+		// based on. SourceBehind is how many commits SourceBranch had that
+		// the session's branch didn't when its repository was last synced.
+		SourceBranch string `json:"source_branch"`
+		BaseCommit   string `json:"base_commit"`
+		SourceBehind int    `json:"source_behind"`
 	}
 
 	sessions := []sessionWithRepo{}
 	for rows.Next() {
 		var s sessionWithRepo
-		if err := rows.Scan(&s.ID, &s.RepoID, &s.WorktreePath, &s.Branch, &s.CLIType, &s.Status, &s.PID, &s.CreatedAt, &s.RepoOwner, &s.RepoName); err != nil {
+		if err := rows.Scan(&s.ID, &s.RepoID, &s.WorktreePath, &s.Branch, &s.CLIType, &s.Status, &s.PID, &s.BatchID, &s.CreatedAt,
+			&s.SourceBranch, &s.BaseCommit, &s.SourceBehind, &s.RepoOwner, &s.RepoName); err != nil {
 			WriteError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -54,102 +74,439 @@ func (h *SessionsHandler) HandleList(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (h *SessionsHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		RepoID       int64  `json:"repo_id"`
-		SourceBranch string `json:"source_branch"`
-		NewBranch    string `json:"new_branch"`
-		CLIType      string `json:"cli_type"`
-	}
+	var body createSessionParams
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		WriteError(w, http.StatusBadRequest, "invalid JSON")
 		return
 	}
 
-	if body.CLIType != "claude" && body.CLIType != "codex" && body.CLIType != "gemini" {
-		WriteError(w, http.StatusBadRequest, "cli_type must be 'claude', 'codex', or 'gemini'")
+	session, err := createSession(h.db, h.manager, h.webhooks, body)
+	if err != nil {
+		writeSessionError(w, err)
 		return
 	}
-	if body.SourceBranch == "" {
-		WriteError(w, http.StatusBadRequest, "source_branch is required")
+	WriteJSON(w, http.StatusCreated, session)
+}
+
+// createSessionParams describes a new session: which repo and branch to base
+// the worktree on, the branch to create, and which CLI to run in it. Empty
+// cli_type and source_branch fall back to the template, then the repo's
+// config, then to claude and the repo's default branch. A prompt, given
+// directly or by the template, is typed into the CLI once it is ready.
+type createSessionParams struct {
+	RepoID       int64  `json:"repo_id"`
+	SourceBranch string `json:"source_branch"`
+	NewBranch    string `json:"new_branch"`
+	CLIType      string `json:"cli_type"`
+	TemplateID   *int64 `json:"template_id"`
+	Prompt       string `json:"prompt"`
+
+	// SparsePaths overrides the repo's sparse checkout paths; an empty list
+	// checks out everything.
+	SparsePaths *[]string `json:"sparse_paths"`
+
+	// batchID groups sessions created by one batch request.
+	batchID string
+
+	// existingBranch checks out NewBranch as it is instead of creating it
+	// from SourceBranch, which is then only used as the diff base.
+	existingBranch bool
+
+	// waitForSetup runs the repo's setup commands before returning instead
+	// of in the background, so the CLI is running when createSession returns.
+	waitForSetup bool
+}
+
+// sessionError is a session creation failure that carries the HTTP status
+// the API should report for it.
+type sessionError struct {
+	status int
+	msg    string
+}
+
+func (e *sessionError) Error() string { return e.msg }
+
+// writeSessionError writes err using its sessionError status, or 500.
+func writeSessionError(w http.ResponseWriter, err error) {
+	var se *sessionError
+	if errors.As(err, &se) {
+		WriteError(w, se.status, se.msg)
 		return
 	}
-	if body.NewBranch == "" {
-		WriteError(w, http.StatusBadRequest, "new_branch is required")
-		return
+	WriteError(w, http.StatusInternalServerError, err.Error())
+}
+
+// createSession creates a worktree for a new branch, starts the CLI in it and
+// records the session. It is shared by the sessions API and workflow steps.
+//
+// When the repo config has setup commands the session is returned in the
+// "starting" state and the commands run in the worktree in the background;
+// the CLI starts once they succeed, and the session becomes "setup_failed"
+// if one fails.
+func createSession(db *sql.DB, manager ptymgr.SessionManager, webhooks *WebhooksHandler, p createSessionParams) (models.Session, error) {
+	sessionID := uuid.New().String()[:8]
+
+	var tmpl *sessionTemplate
+	if p.TemplateID != nil {
+		t, err := loadSessionTemplate(db, *p.TemplateID)
+		if err == sql.ErrNoRows {
+			return models.Session{}, &sessionError{http.StatusNotFound, "session template not found"}
+		}
+		if err != nil {
+			return models.Session{}, err
+		}
+		tmpl = &t
+		if p.RepoID == 0 && t.RepoID != nil {
+			p.RepoID = *t.RepoID
+		}
+		if p.CLIType == "" {
+			p.CLIType = t.CLIType
+		}
+		if p.Prompt == "" {
+			p.Prompt = t.Prompt
+		}
+		if p.NewBranch == "" {
+			if p.NewBranch, err = expandBranchPattern(t.BranchPattern, t.Name, sessionID); err != nil {
+				return models.Session{}, &sessionError{http.StatusBadRequest, "branch_pattern: " + err.Error()}
+			}
+		}
+	}
+	if p.NewBranch == "" {
+		return models.Session{}, &sessionError{http.StatusBadRequest, "new_branch is required"}
+	}
+	if err := checkDiskQuota(db); err != nil {
+		return models.Session{}, err
 	}
 
 	// Get repo info
 	var repo models.Repository
-	err := h.db.QueryRow(`SELECT id, local_path, clone_status FROM repositories WHERE id = ?`, body.RepoID).
-		Scan(&repo.ID, &repo.LocalPath, &repo.CloneStatus)
+	var repoSparse string
+	err := db.QueryRow(`SELECT id, local_path, clone_status, default_branch, sparse_paths FROM repositories WHERE id = ?`, p.RepoID).
+		Scan(&repo.ID, &repo.LocalPath, &repo.CloneStatus, &repo.DefaultBranch, &repoSparse)
 	if err == sql.ErrNoRows {
-		WriteError(w, http.StatusNotFound, "repository not found")
-		return
+		return models.Session{}, &sessionError{http.StatusNotFound, "repository not found"}
+	}
+	if err != nil {
+		return models.Session{}, err
 	}
 	if repo.CloneStatus != "ready" {
-		WriteError(w, http.StatusBadRequest, "repository not ready")
-		return
+		return models.Session{}, &sessionError{http.StatusBadRequest, "repository not ready"}
+	}
+	sparse := decodeSparsePaths(repoSparse)
+	if p.SparsePaths != nil {
+		if err := validateSparsePaths(*p.SparsePaths); err != nil {
+			return models.Session{}, &sessionError{http.StatusBadRequest, err.Error()}
+		}
+		sparse = *p.SparsePaths
+	}
+
+	if p.SourceBranch == "" && tmpl != nil && tmpl.SourceBranch != "" {
+		if p.SourceBranch, err = resolveSourceBranch(repo.LocalPath, tmpl.SourceBranch); err != nil {
+			return models.Session{}, &sessionError{http.StatusBadRequest, "source_branch: " + err.Error()}
+		}
+	}
+
+	// Repo config is read from the requested source branch, or the default
+	// branch when the config itself may choose the source branch.
+	configBranch := p.SourceBranch
+	if configBranch == "" {
+		configBranch = repo.DefaultBranch
+	}
+	cfg, err := loadRepoConfig(db, repo.ID, repo.LocalPath, configBranch)
+	if err != nil {
+		return models.Session{}, &sessionError{http.StatusBadRequest, "repository config: " + err.Error()}
+	}
+	if p.SourceBranch == "" {
+		p.SourceBranch = cfg.SourceBranch
+	}
+	if p.SourceBranch == "" {
+		p.SourceBranch = repo.DefaultBranch
+	}
+	if p.CLIType == "" {
+		p.CLIType = cfg.CLIType
+	}
+	if p.CLIType == "" {
+		p.CLIType = "claude"
+	}
+	if !validCLIType(p.CLIType) {
+		return models.Session{}, &sessionError{http.StatusBadRequest, "cli_type must be 'claude', 'codex', or 'gemini'"}
+	}
+	baseEnv, err := sessionBaseEnv(db, repo.ID, cfg.Env)
+	if err != nil {
+		return models.Session{}, fmt.Errorf("load env profiles: %w", err)
 	}
 
 	// Create worktree
-	sessionID := uuid.New().String()[:8]
 	wtDir, err := git.WorktreesDir()
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, err.Error())
-		return
+		return models.Session{}, err
 	}
 	worktreePath := filepath.Join(wtDir, sessionID)
 
-	if err := git.AddWorktree(repo.LocalPath, worktreePath, body.NewBranch, body.SourceBranch); err != nil {
-		WriteError(w, http.StatusInternalServerError, fmt.Sprintf("create worktree: %v", err))
-		return
+	if p.existingBranch {
+		err = git.AddWorktreeForBranch(repo.LocalPath, worktreePath, p.NewBranch, sparse)
+	} else {
+		err = git.AddWorktree(repo.LocalPath, worktreePath, p.NewBranch, p.SourceBranch, sparse)
+	}
+	if err != nil {
+		return models.Session{}, fmt.Errorf("create worktree: %w", err)
+	}
+	baseCommit, err := git.BaseCommit(repo.LocalPath, worktreePath, p.SourceBranch)
+	if err != nil {
+		log.Printf("Session %s: %v", sessionID, err)
 	}
 
 	// Write .mcp.json for Claude Code MCP integrations
 	WriteSessionMCPConfig(sessionID, worktreePath)
+	if err := addMCPServers(worktreePath, cfg.MCPServers); err != nil {
+		log.Printf("Failed to add repo MCP servers for session %s: %v", sessionID, err)
+	}
+	if tmpl != nil {
+		if err := addMCPServers(worktreePath, tmpl.MCPServers); err != nil {
+			log.Printf("Failed to add template MCP servers for session %s: %v", sessionID, err)
+		}
+	}
 
-	// Resolve CLI command (may include args from settings override)
-	command := resolveCommand(h.db, body.CLIType)
+	var batchID *string
+	if p.batchID != "" {
+		batchID = &p.batchID
+	}
+	now := time.Now()
+	if _, err := db.Exec(`INSERT INTO sessions (id, repo_id, worktree_path, branch, source_branch, base_commit, cli_type, status, batch_id, created_at, sparse_paths)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 'starting', ?, ?, ?)`,
+		sessionID, p.RepoID, worktreePath, p.NewBranch, p.SourceBranch, baseCommit, p.CLIType, batchID, now, encodeSparsePaths(sparse)); err != nil {
+		git.RemoveWorktree(repo.LocalPath, worktreePath)
+		return models.Session{}, fmt.Errorf("record session: %w", err)
+	}
 
-	// Load session env vars
-	envVars := loadSessionEnv(h.db, sessionID)
+	// Template env vars become the session's own, so they can be edited later.
+	if tmpl != nil {
+		for k, v := range tmpl.Env {
+			enc, err := secrets.Encrypt(v)
+			if err != nil {
+				log.Printf("Session %s: encrypt env %s: %v", sessionID, k, err)
+				continue
+			}
+			db.Exec(`INSERT INTO session_env (session_id, key, value) VALUES (?, ?, ?)`, sessionID, k, enc)
+		}
+	}
 
-	// Start PTY
-	sess, pid, err := h.manager.Start(sessionID, command, worktreePath, envVars)
+	// session.created fires once the CLI has started, so webhooks and
+	// triggers never see a session whose start failed and was removed.
+	fireCreated := func() {
+		webhooks.FireWebhook("session.created", sessionID, map[string]any{
+			"repo_id": p.RepoID, "branch": p.NewBranch, "cli_type": p.CLIType,
+		})
+	}
+
+	session := models.Session{
+		ID:           sessionID,
+		RepoID:       p.RepoID,
+		WorktreePath: worktreePath,
+		Branch:       p.NewBranch,
+		CLIType:      p.CLIType,
+		Status:       "starting",
+		BatchID:      batchID,
+		CreatedAt:    now,
+	}
+
+	if len(cfg.Setup) > 0 {
+		setup := func() {
+			if err := runSessionSetup(db, sessionID, worktreePath, cfg.Setup, baseEnv); err != nil {
+				db.Exec(`UPDATE sessions SET status = 'setup_failed', stopped_at = CURRENT_TIMESTAMP WHERE id = ?`, sessionID)
+				webhooks.FireWebhook("session.setup_failed", sessionID, map[string]any{"error": err.Error()})
+				return
+			}
+			sess, _, err := startSessionProcess(db, manager, webhooks, sessionID, p.CLIType, worktreePath, baseEnv)
+			if err != nil {
+				log.Printf("Session %s: %v", sessionID, err)
+				db.Exec(`UPDATE sessions SET status = 'error', stopped_at = CURRENT_TIMESTAMP WHERE id = ?`, sessionID)
+				return
+			}
+			fireCreated()
+			if p.Prompt != "" {
+				go sendInitialPrompt(db, sess, sessionID, p.CLIType, p.Prompt)
+			}
+		}
+		if !p.waitForSetup {
+			go setup()
+			return session, nil
+		}
+		setup()
+		db.QueryRow(`SELECT status, pid FROM sessions WHERE id = ?`, sessionID).Scan(&session.Status, &session.PID)
+		if session.Status != "running" {
+			return session, fmt.Errorf("session %s: setup failed (status %s)", sessionID, session.Status)
+		}
+		return session, nil
+	}
+
+	sess, pid, err := startSessionProcess(db, manager, webhooks, sessionID, p.CLIType, worktreePath, baseEnv)
 	if err != nil {
+		db.Exec(`DELETE FROM sessions WHERE id = ?`, sessionID)
 		git.RemoveWorktree(repo.LocalPath, worktreePath)
-		WriteError(w, http.StatusInternalServerError, fmt.Sprintf("start session: %v", err))
-		return
+		return models.Session{}, err
+	}
+	fireCreated()
+	if p.Prompt != "" {
+		go sendInitialPrompt(db, sess, sessionID, p.CLIType, p.Prompt)
 	}
+	session.Status = "running"
+	session.PID = &pid
+	return session, nil
+}
 
-	now := time.Now()
-	h.db.Exec(`INSERT INTO sessions (id, repo_id, worktree_path, branch, cli_type, status, pid, created_at)
-		VALUES (?, ?, ?, ?, ?, 'running', ?, ?)`,
-		sessionID, body.RepoID, worktreePath, body.NewBranch, body.CLIType, pid, now)
+// startSessionProcess starts the CLI for a session in its worktree, marks the
+// session running and watches for the process to exit. baseEnv holds the
+// env from profiles and repo config (see sessionBaseEnv); the session's own
+// env vars take precedence. Secret references in either are resolved here.
+func startSessionProcess(db *sql.DB, manager ptymgr.SessionManager, webhooks *WebhooksHandler, sessionID, cliType, worktreePath string, baseEnv map[string]string) (ptymgr.SessionHandle, int, error) {
+	// Resolve CLI command (may include args from settings override)
+	return startSessionCommand(db, manager, webhooks, sessionID, resolveCommand(db, cliType), worktreePath, baseEnv, nil)
+}
 
-	// Fire webhook for session creation
-	h.webhooks.FireWebhook("session.created", sessionID, map[string]any{
-		"repo_id": body.RepoID, "branch": body.NewBranch, "cli_type": body.CLIType,
-	})
+// startSessionCommand is startSessionProcess with the command already
+// resolved. history seeds the terminal replay buffer when restarting.
+func startSessionCommand(db *sql.DB, manager ptymgr.SessionManager, webhooks *WebhooksHandler, sessionID, command, worktreePath string, baseEnv map[string]string, history []byte) (ptymgr.SessionHandle, int, error) {
+	// Load session env vars
+	envVars := map[string]string{}
+	for k, v := range baseEnv {
+		envVars[k] = v
+	}
+	for k, v := range loadSessionEnv(db, sessionID) {
+		envVars[k] = v
+	}
+	if len(envVars) == 0 {
+		envVars = nil
+	}
+	envVars, err := resolveEnvSecrets(db, envVars)
+	if err != nil {
+		return nil, 0, &sessionError{http.StatusBadRequest, err.Error()}
+	}
+
+	// Start PTY
+	sess, pid, err := manager.StartWithHistory(sessionID, command, worktreePath, envVars, history)
+	if err != nil {
+		return nil, 0, fmt.Errorf("start session: %w", err)
+	}
+	db.Exec(`UPDATE sessions SET status = 'running', pid = ?, stopped_at = NULL WHERE id = ?`, pid, sessionID)
 
-	// Monitor for process exit and update DB
+	// Monitor for process exit and update DB. The pid check keeps a process
+	// replaced by restartSessionProcess from marking the session stopped.
 	go func() {
 		<-sess.Done()
-		h.db.Exec(`UPDATE sessions SET status = 'stopped' WHERE id = ?`, sessionID)
+		res, err := db.Exec(`UPDATE sessions SET status = 'stopped', stopped_at = CURRENT_TIMESTAMP WHERE id = ? AND pid = ?`, sessionID, pid)
+		if err != nil {
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return
+		}
 		log.Printf("Session %s stopped", sessionID)
-		h.webhooks.FireWebhook("session.stopped", sessionID, nil)
+		webhooks.FireWebhook("session.stopped", sessionID, nil)
 	}()
+	return sess, pid, nil
+}
 
-	WriteJSON(w, http.StatusCreated, models.Session{
-		ID:           sessionID,
-		RepoID:       body.RepoID,
-		WorktreePath: worktreePath,
-		Branch:       body.NewBranch,
-		CLIType:      body.CLIType,
-		Status:       "running",
-		PID:          &pid,
-		CreatedAt:    now,
-	})
+// resumeArgs are appended to a CLI's command to continue its most recent
+// conversation in the working directory. They can be overridden with the
+// cli_resume_args.<cli> setting, e.g. when cli_command.<cli> wraps the CLI.
+var resumeArgs = map[string]string{
+	"claude": "--continue",
+	"codex":  "resume --last",
+	"gemini": "--resume latest",
+}
+
+func resolveResumeArgs(db *sql.DB, cliType string) string {
+	if val, ok := lookupSetting(db, "cli_resume_args."+cliType); ok {
+		return val
+	}
+	return resumeArgs[cliType]
+}
+
+// restartSessionProcess stops a session's CLI, if it is running, and starts
+// cliType in the same worktree with the current env profiles, repo config
+// env and session env, optionally resuming the CLI's last conversation. The
+// terminal output of the previous process is kept in front of the new one.
+// A worktree removed since the session stopped is checked out again from
+// the session's branch. history is shown in front of the new process's
+// output when there is no running process to take it from.
+func restartSessionProcess(db *sql.DB, manager ptymgr.SessionManager, webhooks *WebhooksHandler, sessionID, cliType string, resume bool, history []byte) (ptymgr.SessionHandle, int, error) {
+	var repoID int64
+	var worktreePath, branch, sourceBranch, status, sparse, localPath, defaultBranch string
+	var oldPID sql.NullInt64
+	err := db.QueryRow(`SELECT s.repo_id, s.worktree_path, s.branch, s.source_branch, s.status, s.pid, s.sparse_paths, r.local_path, r.default_branch
+		FROM sessions s JOIN repositories r ON r.id = s.repo_id WHERE s.id = ?`, sessionID).
+		Scan(&repoID, &worktreePath, &branch, &sourceBranch, &status, &oldPID, &sparse, &localPath, &defaultBranch)
+	if err == sql.ErrNoRows {
+		return nil, 0, &sessionError{http.StatusNotFound, "session not found"}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if status == "starting" {
+		return nil, 0, &sessionError{http.StatusConflict, "session is still starting"}
+	}
+	if worktreePath == "" {
+		return nil, 0, &sessionError{http.StatusConflict, "session has no worktree"}
+	}
+
+	if sourceBranch == "" {
+		sourceBranch = defaultBranch
+	}
+	cfg, err := loadRepoConfig(db, repoID, localPath, sourceBranch)
+	if err != nil {
+		return nil, 0, &sessionError{http.StatusBadRequest, "repository config: " + err.Error()}
+	}
+	baseEnv, err := sessionBaseEnv(db, repoID, cfg.Env)
+	if err != nil {
+		return nil, 0, fmt.Errorf("load env profiles: %w", err)
+	}
+
+	if _, err := os.Stat(worktreePath); os.IsNotExist(err) {
+		if err := checkoutSessionWorktree(sessionID, localPath, worktreePath, branch, decodeSparsePaths(sparse), cfg.MCPServers); err != nil {
+			return nil, 0, &sessionError{http.StatusConflict, "restore worktree: " + err.Error()}
+		}
+	}
+
+	if old := manager.Get(sessionID); old != nil {
+		history = old.Replay()
+		manager.Stop(sessionID)
+		if oldPID.Valid {
+			waitForExit(int(oldPID.Int64), processExitTimeout)
+		}
+	}
+	if len(history) > 0 {
+		history = append(history, []byte("\r\n\x1b[2m--- restarted "+cliType+" ---\x1b[0m\r\n")...)
+	}
+
+	command := resolveCommand(db, cliType)
+	if resume {
+		if args := resolveResumeArgs(db, cliType); args != "" {
+			command += " " + args
+		}
+	}
+	sess, pid, err := startSessionCommand(db, manager, webhooks, sessionID, command, worktreePath, baseEnv, history)
+	if err != nil {
+		return nil, 0, err
+	}
+	db.Exec(`UPDATE sessions SET cli_type = ? WHERE id = ?`, cliType, sessionID)
+	webhooks.FireWebhook("session.restarted", sessionID, map[string]any{"cli_type": cliType, "resume": resume})
+	return sess, pid, nil
+}
+
+// processExitTimeout bounds how long a restart waits for the old CLI to exit
+// after SIGTERM before starting the new one.
+const processExitTimeout = 5 * time.Second
+
+// waitForExit polls until the process pid has exited or timeout passes.
+func waitForExit(pid int, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); err != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
 }
 
 func (h *SessionsHandler) HandleReplay(w http.ResponseWriter, r *http.Request) {
@@ -165,6 +522,60 @@ func (h *SessionsHandler) HandleReplay(w http.ResponseWriter, r *http.Request) {
 	w.Write(replay)
 }
 
+// HandleRestart starts a new CLI process in a session's worktree, stopping
+// the current one if it is still running. The session keeps its ID, branch,
+// notes, UI and terminal output. cli_type switches to a different CLI and
+// resume asks the CLI to continue its last conversation.
+func (h *SessionsHandler) HandleRestart(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var body struct {
+		CLIType string `json:"cli_type"`
+		Resume  bool   `json:"resume"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+	}
+
+	var session models.Session
+	err := h.db.QueryRow(`SELECT id, repo_id, worktree_path, branch, cli_type, batch_id, created_at FROM sessions WHERE id = ?`, id).
+		Scan(&session.ID, &session.RepoID, &session.WorktreePath, &session.Branch, &session.CLIType, &session.BatchID, &session.CreatedAt)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if body.CLIType == "" {
+		body.CLIType = session.CLIType
+	}
+	if !validCLIType(body.CLIType) {
+		WriteError(w, http.StatusBadRequest, "cli_type must be 'claude', 'codex', or 'gemini'")
+		return
+	}
+
+	_, pid, err := restartSessionProcess(h.db, h.manager, h.webhooks, id, body.CLIType, body.Resume, nil)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	log.Printf("Session %s restarted (%s, resume=%v)", id, body.CLIType, body.Resume)
+
+	session.CLIType = body.CLIType
+	session.Status = "running"
+	session.PID = &pid
+	WriteJSON(w, http.StatusOK, session)
+}
+
+// HandleDelete stops a session and deletes it. Unless ?delete_local=false,
+// its worktree and branch are removed too; a worktree with uncommitted
+// changes is refused with 409 unless ?force=true, in which case the changes
+// are first saved according to the worktree_backup setting.
 func (h *SessionsHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	deleteLocal := true
@@ -176,6 +587,15 @@ func (h *SessionsHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 		}
 		deleteLocal = parsed
 	}
+	force := false
+	if raw := r.URL.Query().Get("force"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "force must be true or false")
+			return
+		}
+		force = parsed
+	}
 
 	var worktreePath string
 	var branch string
@@ -191,22 +611,31 @@ func (h *SessionsHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var localPath string
+	if deleteLocal {
+		h.db.QueryRow(`SELECT local_path FROM repositories WHERE id = ?`, repoID).Scan(&localPath)
+	}
+	if localPath != "" && worktreePath != "" && !force {
+		if dirty, err := worktreeDirty(worktreePath); err == nil && dirty {
+			WriteError(w, http.StatusConflict, "worktree has uncommitted changes; delete with force=true to back them up and remove it")
+			return
+		}
+	}
+
 	// Stop PTY if still running
 	h.manager.Stop(id)
 
-	if deleteLocal {
-		var localPath string
-		h.db.QueryRow(`SELECT local_path FROM repositories WHERE id = ?`, repoID).Scan(&localPath)
-		if localPath != "" {
-			if worktreePath != "" {
-				if err := git.RemoveWorktree(localPath, worktreePath); err != nil {
-					log.Printf("Failed to remove worktree %s: %v", worktreePath, err)
-				}
+	if localPath != "" {
+		if worktreePath != "" {
+			if err := removeSessionWorktree(h.db, id, localPath, worktreePath, true); err != nil {
+				log.Printf("Failed to remove worktree %s: %v", worktreePath, err)
+				WriteError(w, http.StatusInternalServerError, "remove worktree: "+err.Error())
+				return
 			}
-			if branch != "" {
-				if err := git.RemoveBranch(localPath, branch); err != nil {
-					log.Printf("Failed to remove branch %s: %v", branch, err)
-				}
+		}
+		if branch != "" {
+			if err := git.RemoveBranch(localPath, branch); err != nil {
+				log.Printf("Failed to remove branch %s: %v", branch, err)
 			}
 		}
 	}
@@ -219,15 +648,14 @@ func (h *SessionsHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 // resolveCommand returns the override command string for a CLI type if one
 // exists in settings, otherwise returns the bare CLI type name.
 func resolveCommand(db *sql.DB, cliType string) string {
-	var val string
-	err := db.QueryRow(`SELECT value FROM settings WHERE key = ?`, "cli_command."+cliType).Scan(&val)
-	if err == nil && val != "" {
+	if val := settingValue(db, "cli_command."+cliType); val != "" {
 		return val
 	}
 	return cliType
 }
 
-// loadSessionEnv returns env vars stored for a session (may be empty for new sessions).
+// loadSessionEnv returns env vars stored for a session (may be empty for new
+// sessions), decrypted but with secret references left unresolved.
 func loadSessionEnv(db *sql.DB, sessionID string) map[string]string {
 	rows, err := db.Query(`SELECT key, value FROM session_env WHERE session_id = ?`, sessionID)
 	if err != nil {
@@ -241,7 +669,12 @@ func loadSessionEnv(db *sql.DB, sessionID string) map[string]string {
 		if err := rows.Scan(&k, &v); err != nil {
 			continue
 		}
-		env[k] = v
+		plain, err := secrets.Decrypt(v)
+		if err != nil {
+			log.Printf("Session %s: env %s: %v", sessionID, k, err)
+			continue
+		}
+		env[k] = plain
 	}
 	if len(env) == 0 {
 		return nil
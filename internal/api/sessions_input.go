@@ -68,7 +68,12 @@ func (h *SessionInputHandler) HandleTail(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	replay := sess.Replay()
+	WriteJSON(w, http.StatusOK, map[string]any{"lines": tailLines(sess.Replay(), lines)})
+}
+
+// tailLines returns the last n non-empty lines of PTY output with ANSI
+// escape sequences removed.
+func tailLines(replay []byte, n int) []string {
 	stripped := stripANSI(string(replay))
 
 	all := strings.Split(stripped, "\n")
@@ -79,11 +84,9 @@ func (h *SessionInputHandler) HandleTail(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	start := len(nonEmpty) - lines
+	start := len(nonEmpty) - n
 	if start < 0 {
 		start = 0
 	}
-	tail := nonEmpty[start:]
-
-	WriteJSON(w, http.StatusOK, map[string]any{"lines": tail})
+	return nonEmpty[start:]
 }
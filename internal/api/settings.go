@@ -3,10 +3,12 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/peterje/superposition/internal/models"
+	"github.com/peterje/superposition/internal/secrets"
 )
 
 type SettingsHandler struct {
@@ -36,8 +38,48 @@ func (h *SettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// secretSettings are always stored as secrets. Other settings can be marked
+// secret when they are set.
+var secretSettings = map[string]bool{
+	"github_pat":            true,
+	"gitlab_token":          true,
+	"gitea_token":           true,
+	"github_webhook_secret": true,
+}
+
+// settingValue returns a setting's value, decrypting it if it is a secret,
+// or "" if it isn't set. All settings are read through it (or
+// lookupSetting), since any setting can be marked secret.
+func settingValue(db *sql.DB, key string) string {
+	v, _ := lookupSetting(db, key)
+	return v
+}
+
+// lookupSetting is settingValue, also reporting whether the setting is set,
+// for settings where an empty value differs from the default.
+func lookupSetting(db *sql.DB, key string) (string, bool) {
+	var v string
+	if err := db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&v); err != nil {
+		return "", false
+	}
+	plain, err := secrets.Decrypt(v)
+	if err != nil {
+		log.Printf("settings: %s: %v", key, err)
+		return "", false
+	}
+	return plain, true
+}
+
+// redactSetting hides the value of a secret setting from API responses.
+func redactSetting(s models.Setting) models.Setting {
+	if s.Secret {
+		s.Value = ""
+	}
+	return s
+}
+
 func (h *SettingsHandler) listSettings(w http.ResponseWriter, _ *http.Request) {
-	rows, err := h.db.Query("SELECT key, value, updated_at FROM settings")
+	rows, err := h.db.Query("SELECT key, value, secret, updated_at FROM settings")
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -47,19 +89,19 @@ func (h *SettingsHandler) listSettings(w http.ResponseWriter, _ *http.Request) {
 	settings := []models.Setting{}
 	for rows.Next() {
 		var s models.Setting
-		if err := rows.Scan(&s.Key, &s.Value, &s.UpdatedAt); err != nil {
+		if err := rows.Scan(&s.Key, &s.Value, &s.Secret, &s.UpdatedAt); err != nil {
 			WriteError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
-		settings = append(settings, s)
+		settings = append(settings, redactSetting(s))
 	}
 	WriteJSON(w, http.StatusOK, settings)
 }
 
 func (h *SettingsHandler) getSetting(w http.ResponseWriter, _ *http.Request, key string) {
 	var s models.Setting
-	err := h.db.QueryRow("SELECT key, value, updated_at FROM settings WHERE key = ?", key).
-		Scan(&s.Key, &s.Value, &s.UpdatedAt)
+	err := h.db.QueryRow("SELECT key, value, secret, updated_at FROM settings WHERE key = ?", key).
+		Scan(&s.Key, &s.Value, &s.Secret, &s.UpdatedAt)
 	if err == sql.ErrNoRows {
 		WriteError(w, http.StatusNotFound, "setting not found")
 		return
@@ -68,7 +110,7 @@ func (h *SettingsHandler) getSetting(w http.ResponseWriter, _ *http.Request, key
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	WriteJSON(w, http.StatusOK, s)
+	WriteJSON(w, http.StatusOK, redactSetting(s))
 }
 
 func (h *SettingsHandler) putSetting(w http.ResponseWriter, r *http.Request, key string) {
@@ -77,26 +119,45 @@ func (h *SettingsHandler) putSetting(w http.ResponseWriter, r *http.Request, key
 		return
 	}
 
+	// secret marks the setting as a secret; once marked, a setting stays
+	// secret unless "secret": false is sent.
 	var body struct {
-		Value string `json:"value"`
+		Value  string `json:"value"`
+		Secret *bool  `json:"secret"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		WriteError(w, http.StatusBadRequest, "invalid JSON")
 		return
 	}
 
+	var secret bool
+	h.db.QueryRow("SELECT secret FROM settings WHERE key = ?", key).Scan(&secret)
+	if body.Secret != nil {
+		secret = *body.Secret
+	}
+	secret = secret || secretSettings[key]
+
+	value := body.Value
+	if secret {
+		var err error
+		if value, err = secrets.Encrypt(value); err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	now := time.Now()
 	_, err := h.db.Exec(
-		`INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
-		 ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
-		key, body.Value, now,
+		`INSERT INTO settings (key, value, secret, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value, secret = excluded.secret, updated_at = excluded.updated_at`,
+		key, value, secret, now,
 	)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, models.Setting{Key: key, Value: body.Value, UpdatedAt: now})
+	WriteJSON(w, http.StatusOK, redactSetting(models.Setting{Key: key, Value: body.Value, Secret: secret, UpdatedAt: now}))
 }
 
 func (h *SettingsHandler) deleteSetting(w http.ResponseWriter, _ *http.Request, key string) {
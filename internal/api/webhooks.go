@@ -15,6 +15,7 @@ import (
 	"time"
 
 	ptymgr "github.com/peterje/superposition/internal/pty"
+	"github.com/peterje/superposition/internal/secrets"
 )
 
 type WebhooksHandler struct {
@@ -50,6 +51,11 @@ func scanWebhook(row interface {
 	if err := row.Scan(&wh.ID, &wh.URL, &wh.Secret, &eventsJSON, &wh.Active, &createdAt); err != nil {
 		return wh, err
 	}
+	secret, err := secrets.Decrypt(wh.Secret)
+	if err != nil {
+		return wh, fmt.Errorf("webhook %d secret: %w", wh.ID, err)
+	}
+	wh.Secret = secret
 	if err := json.Unmarshal([]byte(eventsJSON), &wh.Events); err != nil {
 		wh.Events = []string{}
 	}
@@ -111,9 +117,15 @@ func (h *WebhooksHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	secret, err := secrets.Encrypt(body.Secret)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	res, err := h.db.Exec(
 		`INSERT INTO webhooks (url, secret, events, active) VALUES (?, ?, ?, ?)`,
-		body.URL, body.Secret, string(eventsJSON), active,
+		body.URL, secret, string(eventsJSON), active,
 	)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
@@ -175,9 +187,15 @@ func (h *WebhooksHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	secret, err := secrets.Encrypt(wh.Secret)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	_, err = h.db.Exec(
 		`UPDATE webhooks SET url = ?, secret = ?, events = ?, active = ? WHERE id = ?`,
-		wh.URL, wh.Secret, string(eventsJSON), wh.Active, id,
+		wh.URL, secret, string(eventsJSON), wh.Active, id,
 	)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
@@ -284,11 +302,11 @@ func (h *WebhooksHandler) FireWebhook(event string, sessionID string, data map[s
 		}(wh.URL, wh.Secret)
 	}
 
-	go CheckAndFireTriggers(h.db, h.manager, event, sessionID)
+	go CheckAndFireTriggers(h.db, h.manager, event, sessionID, data)
 }
 
 // CheckAndFireTriggers queries active triggers and fires any that match the event.
-func CheckAndFireTriggers(db *sql.DB, manager ptymgr.SessionManager, event string, sessionID string) {
+func CheckAndFireTriggers(db *sql.DB, manager ptymgr.SessionManager, event string, sessionID string, data map[string]any) {
 	rows, err := db.Query(`SELECT id, event_pattern, action, config FROM triggers WHERE active = 1`)
 	if err != nil {
 		log.Printf("triggers: query error: %v", err)
@@ -310,7 +328,7 @@ func CheckAndFireTriggers(db *sql.DB, manager ptymgr.SessionManager, event strin
 		var config map[string]any
 		json.Unmarshal([]byte(configJSON), &config)
 
-		go executeTriggerAction(db, manager, action, config, sessionID)
+		go executeTriggerAction(db, manager, action, config, event, sessionID, data)
 	}
 }
 
@@ -325,27 +343,35 @@ func matchEventPattern(pattern, event string) bool {
 	return false
 }
 
-func executeTriggerAction(db *sql.DB, manager ptymgr.SessionManager, action string, config map[string]any, sessionID string) {
+func executeTriggerAction(db *sql.DB, manager ptymgr.SessionManager, action string, config map[string]any, event, sessionID string, data map[string]any) {
+	vars := eventVars(event, sessionID, data)
+
 	switch action {
 	case "send_input":
 		targetID, _ := config["session_id"].(string)
 		if targetID == "" {
 			targetID = sessionID
 		}
-		data, _ := config["data"].(string)
-		if data == "" {
+		input, _ := config["data"].(string)
+		if input == "" {
+			return
+		}
+		input, err := expandTemplate(input, vars)
+		if err != nil {
+			log.Printf("triggers: send_input: %v", err)
 			return
 		}
 		sess := manager.Get(targetID)
 		if sess != nil {
-			sess.Write([]byte(data))
+			sess.Write([]byte(input))
 		}
 	case "run_workflow":
 		wfID, ok := config["workflow_id"].(float64)
 		if !ok {
 			return
 		}
-		RunWorkflow(db, manager, int64(wfID))
+		params, _ := config["params"].(map[string]any)
+		RunWorkflow(db, manager, int64(wfID), params, vars)
 	}
 }
 
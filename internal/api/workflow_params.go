@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// workflowParam declares an input a workflow accepts when it is run. Values
+// are available to steps as {{.name}} ({{shq .name}} or $SP_VAR_name in
+// shell commands).
+type workflowParam struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // "string" (default), "number" or "boolean"
+	Default     any    `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+var paramNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func parseWorkflowParams(paramsJSON string) []workflowParam {
+	var params []workflowParam
+	if err := json.Unmarshal([]byte(paramsJSON), &params); err != nil || params == nil {
+		return []workflowParam{}
+	}
+	return params
+}
+
+// validateWorkflowParams checks param names, types and defaults.
+func validateWorkflowParams(params []workflowParam) error {
+	seen := map[string]bool{}
+	for i := range params {
+		p := &params[i]
+		if !paramNameRe.MatchString(p.Name) {
+			return fmt.Errorf("param %q: name must be letters, digits and underscores", p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("param %q declared twice", p.Name)
+		}
+		seen[p.Name] = true
+
+		switch p.Type {
+		case "":
+			p.Type = "string"
+		case "string", "number", "boolean":
+		default:
+			return fmt.Errorf("param %q: type must be string, number or boolean", p.Name)
+		}
+		if p.Default != nil {
+			if _, err := paramValueString(*p, p.Default); err != nil {
+				return fmt.Errorf("param %q: default: %w", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveWorkflowParams checks inputs against the declared params, applies
+// defaults and returns the values as template variables.
+func resolveWorkflowParams(params []workflowParam, inputs map[string]any) (map[string]string, error) {
+	declared := map[string]workflowParam{}
+	for _, p := range params {
+		declared[p.Name] = p
+	}
+
+	var unknown []string
+	for name := range inputs {
+		if _, ok := declared[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown param(s): %s", strings.Join(unknown, ", "))
+	}
+
+	vars := map[string]string{}
+	for _, p := range params {
+		v, ok := inputs[p.Name]
+		if !ok || v == nil {
+			v = p.Default
+		}
+		if v == nil {
+			if p.Required {
+				return nil, fmt.Errorf("param %q is required", p.Name)
+			}
+			vars[p.Name] = ""
+			continue
+		}
+		s, err := paramValueString(p, v)
+		if err != nil {
+			return nil, fmt.Errorf("param %q: %w", p.Name, err)
+		}
+		vars[p.Name] = s
+	}
+	return vars, nil
+}
+
+// paramValueString converts a JSON value to the string form used in
+// templates, checking it against the param's type. Strings are accepted for
+// every type so values can come from query strings and templated triggers.
+func paramValueString(p workflowParam, v any) (string, error) {
+	switch p.Type {
+	case "number":
+		switch n := v.(type) {
+		case float64:
+			return strconv.FormatFloat(n, 'f', -1, 64), nil
+		case string:
+			if _, err := strconv.ParseFloat(n, 64); err != nil {
+				return "", fmt.Errorf("expected a number, got %q", n)
+			}
+			return n, nil
+		}
+		return "", fmt.Errorf("expected a number")
+	case "boolean":
+		switch b := v.(type) {
+		case bool:
+			return strconv.FormatBool(b), nil
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				return "", fmt.Errorf("expected a boolean, got %q", b)
+			}
+			return strconv.FormatBool(parsed), nil
+		}
+		return "", fmt.Errorf("expected a boolean")
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("expected a string")
+		}
+		return s, nil
+	}
+}
+
+// eventVars returns the template variables describing an event that
+// triggered a workflow: event, session_id and each field of the event data.
+func eventVars(event, sessionID string, data map[string]any) map[string]string {
+	vars := map[string]string{"event": event}
+	if sessionID != "" {
+		vars["session_id"] = sessionID
+	}
+	for k, v := range data {
+		if !paramNameRe.MatchString(k) {
+			continue
+		}
+		switch val := v.(type) {
+		case string:
+			vars[k] = val
+		case float64:
+			vars[k] = strconv.FormatFloat(val, 'f', -1, 64)
+		case nil:
+		default:
+			vars[k] = fmt.Sprint(val)
+		}
+	}
+	return vars
+}
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	ptymgr "github.com/peterje/superposition/internal/pty"
+)
+
+const maxRunLogSize = 1 << 20 // keep the last 1MB of a run's output
+
+// workflowRun holds the state threaded through one execution of a workflow:
+// its variables, its output log and the subscribers streaming that log.
+type workflowRun struct {
+	id         int64
+	db         *sql.DB
+	manager    ptymgr.SessionManager
+	webhooks   *WebhooksHandler
+	workflowID int64
+	repoID     int64
+	name       string
+	params     map[string]string
+	vars       map[string]string
+	startedAt  time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	log         []byte
+	status      string
+	errMsg      string
+	subscribers map[chan runEvent]struct{}
+}
+
+// runEvent is one server-sent event on a run's event stream.
+type runEvent struct {
+	Event string
+	Data  any
+}
+
+type workflowRunResponse struct {
+	ID         int64             `json:"id"`
+	WorkflowID int64             `json:"workflow_id"`
+	Status     string            `json:"status"`
+	Error      string            `json:"error"`
+	Params     map[string]string `json:"params"`
+	Log        string            `json:"log,omitempty"`
+	StartedAt  string            `json:"started_at"`
+	FinishedAt *string           `json:"finished_at"`
+}
+
+// activeRuns tracks runs that are still executing so they can be streamed and
+// cancelled. Finished runs are served from the workflow_runs table.
+var activeRuns = struct {
+	sync.Mutex
+	runs map[int64]*workflowRun
+}{runs: map[int64]*workflowRun{}}
+
+// startWorkflowRun records a new run and registers it as active. vars seeds
+// the run's template variables (params and event fields). The caller
+// executes it with run.execute.
+func startWorkflowRun(db *sql.DB, manager ptymgr.SessionManager, wf workflowDef, vars map[string]string) (*workflowRun, error) {
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	paramsJSON, err := json.Marshal(vars)
+	if err != nil {
+		return nil, fmt.Errorf("encode params: %w", err)
+	}
+
+	now := time.Now().UTC()
+	res, err := db.Exec(`INSERT INTO workflow_runs (workflow_id, status, params, started_at) VALUES (?, 'running', ?, ?)`,
+		wf.id, string(paramsJSON), now.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("record workflow run: %w", err)
+	}
+	id, _ := res.LastInsertId()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &workflowRun{
+		id:          id,
+		db:          db,
+		manager:     manager,
+		webhooks:    NewWebhooksHandler(db, manager),
+		workflowID:  wf.id,
+		repoID:      wf.repoID,
+		name:        wf.name,
+		params:      vars,
+		vars:        copyVars(vars),
+		startedAt:   now,
+		ctx:         ctx,
+		cancel:      cancel,
+		status:      "running",
+		subscribers: map[chan runEvent]struct{}{},
+	}
+
+	activeRuns.Lock()
+	activeRuns.runs[id] = run
+	activeRuns.Unlock()
+	return run, nil
+}
+
+func copyVars(vars map[string]string) map[string]string {
+	cp := make(map[string]string, len(vars))
+	for k, v := range vars {
+		cp[k] = v
+	}
+	return cp
+}
+
+func getActiveRun(id int64) *workflowRun {
+	activeRuns.Lock()
+	defer activeRuns.Unlock()
+	return activeRuns.runs[id]
+}
+
+// Write appends command output to the run log and streams it to subscribers.
+func (run *workflowRun) Write(p []byte) (int, error) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.log = append(run.log, p...)
+	if len(run.log) > maxRunLogSize {
+		run.log = run.log[len(run.log)-maxRunLogSize:]
+	}
+	run.broadcastLocked(runEvent{Event: "output", Data: map[string]string{"text": string(p)}})
+	return len(p), nil
+}
+
+// logf writes a line to both the run log and the server log.
+func (run *workflowRun) logf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("workflow %d run %d: %s", run.workflowID, run.id, msg)
+	run.Write([]byte("==> " + msg + "\n"))
+}
+
+func (run *workflowRun) broadcastLocked(ev runEvent) {
+	for ch := range run.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Slow subscriber, drop event
+		}
+	}
+}
+
+// subscribe returns the log so far and a channel of subsequent events. The
+// channel is closed when the run finishes.
+func (run *workflowRun) subscribe() ([]byte, <-chan runEvent, func()) {
+	ch := make(chan runEvent, 256)
+	run.mu.Lock()
+	snapshot := append([]byte(nil), run.log...)
+	if run.status == "running" {
+		run.subscribers[ch] = struct{}{}
+	} else {
+		close(ch)
+	}
+	run.mu.Unlock()
+
+	unsub := func() {
+		run.mu.Lock()
+		delete(run.subscribers, ch)
+		run.mu.Unlock()
+	}
+	return snapshot, ch, unsub
+}
+
+// finish persists the run's final state, notifies subscribers and removes it
+// from the active set.
+func (run *workflowRun) finish(status string, runErr error) {
+	run.mu.Lock()
+	run.status = status
+	if runErr != nil {
+		run.errMsg = runErr.Error()
+	}
+	logText := string(run.log)
+	run.broadcastLocked(runEvent{Event: "status", Data: map[string]string{"status": status, "error": run.errMsg}})
+	for ch := range run.subscribers {
+		close(ch)
+		delete(run.subscribers, ch)
+	}
+	errMsg := run.errMsg
+	run.mu.Unlock()
+
+	run.cancel()
+
+	if _, err := run.db.Exec(`UPDATE workflow_runs SET status = ?, log = ?, error = ?, finished_at = ? WHERE id = ?`,
+		status, logText, errMsg, time.Now().UTC().Format("2006-01-02 15:04:05"), run.id); err != nil {
+		log.Printf("workflow %d run %d: failed to record result: %v", run.workflowID, run.id, err)
+	}
+
+	activeRuns.Lock()
+	delete(activeRuns.runs, run.id)
+	activeRuns.Unlock()
+}
+
+func (run *workflowRun) snapshot() workflowRunResponse {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return workflowRunResponse{
+		ID:         run.id,
+		WorkflowID: run.workflowID,
+		Status:     run.status,
+		Error:      run.errMsg,
+		Params:     run.params,
+		Log:        string(run.log),
+		StartedAt:  run.startedAt.Format(time.RFC3339),
+	}
+}
+
+func scanWorkflowRun(row interface {
+	Scan(...any) error
+}) (workflowRunResponse, error) {
+	var run workflowRunResponse
+	var finishedAt sql.NullString
+	var paramsJSON string
+	if err := row.Scan(&run.ID, &run.WorkflowID, &run.Status, &run.Error, &paramsJSON, &run.Log, &run.StartedAt, &finishedAt); err != nil {
+		return run, err
+	}
+	if err := json.Unmarshal([]byte(paramsJSON), &run.Params); err != nil {
+		run.Params = map[string]string{}
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.String
+	}
+	return run, nil
+}
+
+// HandleListRuns returns the runs of a workflow, newest first, without logs.
+func (h *WorkflowsHandler) HandleListRuns(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	rows, err := h.db.Query(`SELECT id, workflow_id, status, error, params, '', started_at, finished_at
+		FROM workflow_runs WHERE workflow_id = ? ORDER BY id DESC LIMIT 50`, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	result := []workflowRunResponse{}
+	for rows.Next() {
+		run, err := scanWorkflowRun(rows)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		result = append(result, run)
+	}
+	WriteJSON(w, http.StatusOK, result)
+}
+
+// HandleGetRun returns a single run including its log.
+func (h *WorkflowsHandler) HandleGetRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	if run := getActiveRun(id); run != nil {
+		WriteJSON(w, http.StatusOK, run.snapshot())
+		return
+	}
+
+	row := h.db.QueryRow(`SELECT id, workflow_id, status, error, params, log, started_at, finished_at FROM workflow_runs WHERE id = ?`, id)
+	run, err := scanWorkflowRun(row)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "workflow run not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, http.StatusOK, run)
+}
+
+// HandleCancelRun cancels a running workflow. The step in progress is
+// interrupted and no further steps run.
+func (h *WorkflowsHandler) HandleCancelRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	run := getActiveRun(id)
+	if run == nil {
+		WriteError(w, http.StatusConflict, "workflow run is not running")
+		return
+	}
+	run.cancel()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRunEvents streams a run's output as server-sent events. The log so
+// far is sent first as one "output" event, followed by live "output" and
+// "step" events, and a final "status" event when the run finishes.
+func (h *WorkflowsHandler) HandleRunEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	run := getActiveRun(id)
+	if run == nil {
+		// Finished run: replay the stored log and final status.
+		row := h.db.QueryRow(`SELECT id, workflow_id, status, error, params, log, started_at, finished_at FROM workflow_runs WHERE id = ?`, id)
+		stored, err := scanWorkflowRun(row)
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "workflow run not found")
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		startSSE(w)
+		if stored.Log != "" {
+			writeSSE(w, runEvent{Event: "output", Data: map[string]string{"text": stored.Log}})
+		}
+		writeSSE(w, runEvent{Event: "status", Data: map[string]string{"status": stored.Status, "error": stored.Error}})
+		flusher.Flush()
+		return
+	}
+
+	snapshot, events, unsub := run.subscribe()
+	defer unsub()
+
+	startSSE(w)
+	if len(snapshot) > 0 {
+		writeSSE(w, runEvent{Event: "output", Data: map[string]string{"text": string(snapshot)}})
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				// Run finished before we subscribed, or the status event was
+				// dropped; report its final status.
+				final := run.snapshot()
+				writeSSE(w, runEvent{Event: "status", Data: map[string]string{"status": final.Status, "error": final.Error}})
+				flusher.Flush()
+				return
+			}
+			writeSSE(w, ev)
+			flusher.Flush()
+			if ev.Event == "status" {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func startSSE(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeSSE(w http.ResponseWriter, ev runEvent) {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Event, data)
+}
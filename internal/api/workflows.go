@@ -1,14 +1,26 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"text/template/parse"
 	"time"
 
+	"github.com/peterje/superposition/internal/git"
 	ptymgr "github.com/peterje/superposition/internal/pty"
 )
 
@@ -22,20 +34,65 @@ func NewWorkflowsHandler(db *sql.DB, manager ptymgr.SessionManager) *WorkflowsHa
 }
 
 type workflowResponse struct {
-	ID          int64  `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Steps       any    `json:"steps"`
-	CreatedAt   string `json:"created_at"`
+	ID          int64           `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Params      []workflowParam `json:"params"`
+	Steps       any             `json:"steps"`
+	CreatedAt   string          `json:"created_at"`
+
+	// Set for workflows defined in a repository's .superposition/workflows.
+	RepoID *int64 `json:"repo_id"`
+	Path   string `json:"path,omitempty"`
+	Error  string `json:"error,omitempty"`
 }
 
+// workflowStep is one entry of a workflow's steps array. Which fields apply
+// depends on Type:
+//
+//   - shell: Command, SessionID or RepoID (+ SourceBranch), Timeout
+//   - send_input: SessionID, Data
+//   - create_session: RepoID, SourceBranch, NewBranch, CLIType, SaveAs
+//   - wait_idle: SessionID, IdleSeconds, Timeout
+//   - wait_output: SessionID, Pattern, Timeout
+//   - capture: SessionID, Lines, SaveAs
+//   - git_commit: SessionID, Message, Push
+//   - git_push: SessionID
+//   - stop_session: SessionID
+//
+// String fields may reference workflow variables as {{.name}}, except in
+// shell commands, where values must be quoted with {{shq .name}} or read
+// from the step's environment as $SP_VAR_name (see expandShellCommand). Steps that
+// act on a session default to the session most recently created by the run;
+// shell steps only target a session when session_id is set.
 type workflowStep struct {
 	Type      string `json:"type"`
 	Command   string `json:"command"`
 	SessionID string `json:"session_id"`
 	Data      string `json:"data"`
+
+	RepoID       int64  `json:"repo_id"`
+	SourceBranch string `json:"source_branch"`
+	NewBranch    string `json:"new_branch"`
+	CLIType      string `json:"cli_type"`
+
+	Pattern     string `json:"pattern"`
+	IdleSeconds int    `json:"idle_seconds"`
+	Timeout     int    `json:"timeout"`
+
+	Lines   int    `json:"lines"`
+	Message string `json:"message"`
+	Push    bool   `json:"push"`
+	SaveAs  string `json:"save_as"`
 }
 
+const (
+	defaultShellTimeout = 60 * time.Second
+	defaultWaitIdle     = 10 * time.Second
+	defaultWaitTimeout  = 30 * time.Minute
+	maxWaitOutputBuf    = 64 * 1024
+)
+
 func parseWorkflowSteps(stepsJSON string) any {
 	var steps []any
 	if err := json.Unmarshal([]byte(stepsJSON), &steps); err != nil {
@@ -44,9 +101,10 @@ func parseWorkflowSteps(stepsJSON string) any {
 	return steps
 }
 
-// HandleList returns all workflows as a JSON array.
+// HandleList returns all workflows as a JSON array, including those
+// discovered in repositories.
 func (h *WorkflowsHandler) HandleList(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.db.Query(`SELECT id, name, description, steps, created_at FROM workflows ORDER BY id`)
+	rows, err := h.db.Query(`SELECT id, name, description, params, steps, created_at, repo_id, path, error FROM workflows ORDER BY id`)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -56,11 +114,12 @@ func (h *WorkflowsHandler) HandleList(w http.ResponseWriter, r *http.Request) {
 	result := []workflowResponse{}
 	for rows.Next() {
 		var wf workflowResponse
-		var stepsJSON string
-		if err := rows.Scan(&wf.ID, &wf.Name, &wf.Description, &stepsJSON, &wf.CreatedAt); err != nil {
+		var paramsJSON, stepsJSON string
+		if err := rows.Scan(&wf.ID, &wf.Name, &wf.Description, &paramsJSON, &stepsJSON, &wf.CreatedAt, &wf.RepoID, &wf.Path, &wf.Error); err != nil {
 			WriteError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
+		wf.Params = parseWorkflowParams(paramsJSON)
 		wf.Steps = parseWorkflowSteps(stepsJSON)
 		result = append(result, wf)
 	}
@@ -70,9 +129,10 @@ func (h *WorkflowsHandler) HandleList(w http.ResponseWriter, r *http.Request) {
 // HandleCreate creates a new workflow.
 func (h *WorkflowsHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	var body struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Steps       []any  `json:"steps"`
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Params      []workflowParam `json:"params"`
+		Steps       []any           `json:"steps"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		WriteError(w, http.StatusBadRequest, "invalid JSON")
@@ -85,16 +145,32 @@ func (h *WorkflowsHandler) HandleCreate(w http.ResponseWriter, r *http.Request)
 	if body.Steps == nil {
 		body.Steps = []any{}
 	}
+	if body.Params == nil {
+		body.Params = []workflowParam{}
+	}
+	if err := validateWorkflowParams(body.Params); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	stepsJSON, err := json.Marshal(body.Steps)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "failed to encode steps")
 		return
 	}
+	if err := validateShellCommands(stepsJSON); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	paramsJSON, err := json.Marshal(body.Params)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "failed to encode params")
+		return
+	}
 
 	res, err := h.db.Exec(
-		`INSERT INTO workflows (name, description, steps) VALUES (?, ?, ?)`,
-		body.Name, body.Description, string(stepsJSON),
+		`INSERT INTO workflows (name, description, params, steps) VALUES (?, ?, ?, ?)`,
+		body.Name, body.Description, string(paramsJSON), string(stepsJSON),
 	)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
@@ -103,21 +179,38 @@ func (h *WorkflowsHandler) HandleCreate(w http.ResponseWriter, r *http.Request)
 
 	id, _ := res.LastInsertId()
 	var wf workflowResponse
-	var stepsOut string
-	err = h.db.QueryRow(`SELECT id, name, description, steps, created_at FROM workflows WHERE id = ?`, id).
-		Scan(&wf.ID, &wf.Name, &wf.Description, &stepsOut, &wf.CreatedAt)
+	var paramsOut, stepsOut string
+	err = h.db.QueryRow(`SELECT id, name, description, params, steps, created_at FROM workflows WHERE id = ?`, id).
+		Scan(&wf.ID, &wf.Name, &wf.Description, &paramsOut, &stepsOut, &wf.CreatedAt)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	wf.Params = parseWorkflowParams(paramsOut)
 	wf.Steps = parseWorkflowSteps(stepsOut)
 	WriteJSON(w, http.StatusCreated, wf)
 }
 
-// HandleDelete deletes a workflow by ID and returns 204.
+// HandleDelete deletes a workflow by ID and returns 204. Workflows defined in
+// a repository can only be removed by deleting their file.
 func (h *WorkflowsHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
+	var repoID sql.NullInt64
+	err := h.db.QueryRow(`SELECT repo_id FROM workflows WHERE id = ?`, id).Scan(&repoID)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "workflow not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if repoID.Valid {
+		WriteError(w, http.StatusConflict, "workflow is defined in a repository; delete its file and sync instead")
+		return
+	}
+
 	res, err := h.db.Exec(`DELETE FROM workflows WHERE id = ?`, id)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
@@ -131,14 +224,26 @@ func (h *WorkflowsHandler) HandleDelete(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// HandleRun returns 202 immediately and executes workflow steps in a goroutine.
+// HandleRun starts the workflow in the background and returns the new run
+// with 202. The optional body {"params": {...}} supplies values for the
+// workflow's declared params. Progress can be followed via the run's event
+// stream.
 func (h *WorkflowsHandler) HandleRun(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
 
-	var workflowID int64
-	var name, stepsJSON string
-	err := h.db.QueryRow(`SELECT id, name, steps FROM workflows WHERE id = ?`, id).
-		Scan(&workflowID, &name, &stepsJSON)
+	var body struct {
+		Params map[string]any `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		WriteError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	wf, err := loadWorkflow(h.db, id)
 	if err == sql.ErrNoRows {
 		WriteError(w, http.StatusNotFound, "workflow not found")
 		return
@@ -147,62 +252,670 @@ func (h *WorkflowsHandler) HandleRun(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if wf.err != "" {
+		WriteError(w, http.StatusConflict, "workflow definition is invalid: "+wf.err)
+		return
+	}
+
+	vars, err := resolveWorkflowParams(wf.params, body.Params)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	run, err := startWorkflowRun(h.db, h.manager, wf, vars)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go run.execute(wf.stepsJSON)
 
-	w.WriteHeader(http.StatusAccepted)
+	WriteJSON(w, http.StatusAccepted, run.snapshot())
+}
 
-	go executeWorkflowSteps(h.manager, workflowID, name, stepsJSON)
+// workflowDef is a workflow loaded for execution.
+type workflowDef struct {
+	id        int64
+	name      string
+	params    []workflowParam
+	stepsJSON string
+	repoID    int64  // owning repository for repo-defined workflows, else 0
+	err       string // validation error for repo-defined workflows
+}
+
+func loadWorkflow(db *sql.DB, id int64) (workflowDef, error) {
+	wf := workflowDef{id: id}
+	var paramsJSON string
+	var repoID sql.NullInt64
+	err := db.QueryRow(`SELECT name, params, steps, repo_id, error FROM workflows WHERE id = ?`, id).
+		Scan(&wf.name, &paramsJSON, &wf.stepsJSON, &repoID, &wf.err)
+	wf.params = parseWorkflowParams(paramsJSON)
+	wf.repoID = repoID.Int64
+	return wf, err
 }
 
 // RunWorkflow loads a workflow by ID from the DB and executes its steps sequentially.
-// This is a package-level function so webhooks.go can call it directly as RunWorkflow(db, manager, id).
-func RunWorkflow(db *sql.DB, manager ptymgr.SessionManager, workflowID int64) {
-	var name, stepsJSON string
-	err := db.QueryRow(`SELECT name, steps FROM workflows WHERE id = ?`, workflowID).Scan(&name, &stepsJSON)
+// This is a package-level function so webhooks.go can call it directly.
+// inputs supplies values for the workflow's params; string inputs may
+// reference the triggering event's variables (e.g. {{.session_id}}), which
+// are also available to the steps themselves.
+func RunWorkflow(db *sql.DB, manager ptymgr.SessionManager, workflowID int64, inputs map[string]any, event map[string]string) {
+	wf, err := loadWorkflow(db, workflowID)
 	if err != nil {
 		log.Printf("workflow %d: not found: %v", workflowID, err)
 		return
 	}
+	if wf.err != "" {
+		log.Printf("workflow %d: definition is invalid: %s", workflowID, wf.err)
+		return
+	}
 
-	executeWorkflowSteps(manager, workflowID, name, stepsJSON)
+	expanded := make(map[string]any, len(inputs))
+	for k, v := range inputs {
+		if s, ok := v.(string); ok {
+			if s, err = expandTemplate(s, event); err != nil {
+				log.Printf("workflow %d: param %q: %v", workflowID, k, err)
+				return
+			}
+			v = s
+		}
+		expanded[k] = v
+	}
+
+	params, err := resolveWorkflowParams(wf.params, expanded)
+	if err != nil {
+		log.Printf("workflow %d: %v", workflowID, err)
+		return
+	}
+	vars := make(map[string]string, len(event)+len(params))
+	for k, v := range event {
+		vars[k] = v
+	}
+	for k, v := range params {
+		vars[k] = v
+	}
+
+	run, err := startWorkflowRun(db, manager, wf, vars)
+	if err != nil {
+		log.Printf("workflow %d: %v", workflowID, err)
+		return
+	}
+	run.execute(wf.stepsJSON)
 }
 
-func executeWorkflowSteps(manager ptymgr.SessionManager, workflowID int64, name, stepsJSON string) {
+// execute runs the steps in order, stopping at the first failure or when the
+// run is cancelled.
+func (run *workflowRun) execute(stepsJSON string) {
 	var steps []workflowStep
 	if err := json.Unmarshal([]byte(stepsJSON), &steps); err != nil {
-		log.Printf("workflow %d (%s): invalid steps JSON: %v", workflowID, name, err)
+		run.finish("failed", fmt.Errorf("invalid steps JSON: %w", err))
 		return
 	}
 
-	log.Printf("workflow %d (%s): running %d step(s)", workflowID, name, len(steps))
+	run.logf("running %s (%d step(s))", run.name, len(steps))
 	for i, step := range steps {
-		log.Printf("workflow %d: step %d type=%s", workflowID, i+1, step.Type)
-		switch step.Type {
-		case "shell":
-			ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-			cmd := exec.CommandContext(ctx, "sh", "-c", step.Command)
-			out, err := cmd.CombinedOutput()
-			cancel()
-			if err != nil {
-				log.Printf("workflow %d: step %d shell error: %v", workflowID, i+1, err)
-			}
-			if len(out) > 0 {
-				log.Printf("workflow %d: step %d output: %s", workflowID, i+1, string(out))
+		if run.ctx.Err() != nil {
+			run.logf("cancelled")
+			run.finish("cancelled", nil)
+			return
+		}
+
+		run.logf("step %d: %s", i+1, step.Type)
+		run.mu.Lock()
+		run.broadcastLocked(runEvent{Event: "step", Data: map[string]any{"step": i + 1, "type": step.Type}})
+		run.mu.Unlock()
+
+		if err := run.runStep(i+1, step); err != nil {
+			if run.ctx.Err() != nil {
+				run.logf("cancelled during step %d", i+1)
+				run.finish("cancelled", nil)
+				return
 			}
-		case "send_input":
-			if step.SessionID == "" || step.Data == "" {
-				log.Printf("workflow %d: step %d send_input missing session_id or data, skipping", workflowID, i+1)
-				continue
+			run.logf("step %d failed: %v", i+1, err)
+			run.finish("failed", fmt.Errorf("step %d: %w", i+1, err))
+			return
+		}
+	}
+	run.logf("completed")
+	run.finish("succeeded", nil)
+}
+
+func (run *workflowRun) runStep(n int, step workflowStep) error {
+	switch step.Type {
+	case "shell":
+		return run.runShell(step)
+	case "send_input":
+		data, err := run.expand(step.Data)
+		if err != nil {
+			return err
+		}
+		sess, _, err := run.session(step.SessionID)
+		if err != nil {
+			return err
+		}
+		if data == "" {
+			return fmt.Errorf("send_input: data is required")
+		}
+		if _, err := sess.Write([]byte(data)); err != nil {
+			return fmt.Errorf("send_input: %w", err)
+		}
+	case "create_session":
+		return run.createSession(step)
+	case "wait_idle":
+		sess, id, err := run.session(step.SessionID)
+		if err != nil {
+			return err
+		}
+		idle := defaultWaitIdle
+		if step.IdleSeconds > 0 {
+			idle = time.Duration(step.IdleSeconds) * time.Second
+		}
+		run.logf("waiting for session %s to be idle for %s", id, idle)
+		return waitForIdle(run.ctx, sess, idle, stepTimeout(step))
+	case "wait_output":
+		pattern, err := run.expand(step.Pattern)
+		if err != nil {
+			return err
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("wait_output: invalid pattern: %w", err)
+		}
+		sess, id, err := run.session(step.SessionID)
+		if err != nil {
+			return err
+		}
+		run.logf("waiting for session %s output to match %q", id, pattern)
+		return waitForOutput(run.ctx, sess, re, stepTimeout(step))
+	case "capture":
+		sess, _, err := run.session(step.SessionID)
+		if err != nil {
+			return err
+		}
+		if step.SaveAs == "" {
+			return fmt.Errorf("capture: save_as is required")
+		}
+		lines := 50
+		if step.Lines > 0 {
+			lines = step.Lines
+		}
+		run.vars[step.SaveAs] = strings.Join(tailLines(sess.Replay(), lines), "\n")
+	case "git_commit":
+		message, err := run.expand(step.Message)
+		if err != nil {
+			return err
+		}
+		if message == "" {
+			return fmt.Errorf("git_commit: message is required")
+		}
+		id, err := run.sessionID(step.SessionID)
+		if err != nil {
+			return err
+		}
+		worktreePath, _, err := run.worktree(id)
+		if err != nil {
+			return err
+		}
+		committed, err := git.CommitAll(worktreePath, message)
+		if err != nil {
+			return err
+		}
+		if !committed {
+			run.logf("session %s has no changes to commit", id)
+		}
+		if step.Push {
+			return run.push(id)
+		}
+	case "git_push":
+		id, err := run.sessionID(step.SessionID)
+		if err != nil {
+			return err
+		}
+		return run.push(id)
+	case "stop_session":
+		id, err := run.sessionID(step.SessionID)
+		if err != nil {
+			return err
+		}
+		return run.manager.Stop(id)
+	default:
+		run.logf("step %d: unknown type %q, skipping", n, step.Type)
+	}
+	return nil
+}
+
+// runShell runs a shell step. With session_id it runs in that session's
+// worktree with the env its CLI gets (see sessionEnv); with repo_id it runs
+// in a temporary checkout of source_branch (default: the repo's default
+// branch). Otherwise repo-defined workflows run in a checkout of their own
+// repo, and others in the server's working directory. Output streams into
+// the run log.
+func (run *workflowRun) runShell(step workflowStep) error {
+	command, err := expandShellCommand(step.Command, run.vars)
+	if err != nil {
+		return err
+	}
+
+	dir, env, cleanup, err := run.shellTarget(step)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	timeout := defaultShellTimeout
+	if step.Timeout > 0 {
+		timeout = time.Duration(step.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(run.ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	for k, v := range run.vars {
+		if paramNameRe.MatchString(k) {
+			cmd.Env = append(cmd.Env, "SP_VAR_"+k+"="+v)
+		}
+	}
+	cmd.Stdout = run
+	cmd.Stderr = run
+	// Run in its own process group so cancellation also kills children
+	// (e.g. the compiler under `make test`).
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("shell: timed out after %s", timeout)
+		}
+		return fmt.Errorf("shell: %w", err)
+	}
+	return nil
+}
+
+// shellTarget resolves where a shell step runs. cleanup must always be called.
+func (run *workflowRun) shellTarget(step workflowStep) (string, map[string]string, func(), error) {
+	noop := func() {}
+
+	if step.SessionID != "" {
+		id, err := run.sessionID(step.SessionID)
+		if err != nil {
+			return "", nil, noop, err
+		}
+		worktreePath, _, err := run.worktree(id)
+		if err != nil {
+			return "", nil, noop, err
+		}
+		env, err := sessionEnv(run.db, id)
+		if err != nil {
+			return "", nil, noop, err
+		}
+		return worktreePath, env, noop, nil
+	}
+
+	if step.RepoID == 0 {
+		step.RepoID = run.repoID
+	}
+	if step.RepoID != 0 {
+		var localPath, cloneStatus, defaultBranch string
+		err := run.db.QueryRow(`SELECT local_path, clone_status, default_branch FROM repositories WHERE id = ?`, step.RepoID).
+			Scan(&localPath, &cloneStatus, &defaultBranch)
+		if err == sql.ErrNoRows {
+			return "", nil, noop, fmt.Errorf("repository %d not found", step.RepoID)
+		}
+		if err != nil {
+			return "", nil, noop, err
+		}
+		if cloneStatus != "ready" {
+			return "", nil, noop, fmt.Errorf("repository %d not ready", step.RepoID)
+		}
+
+		branch, err := run.expand(step.SourceBranch)
+		if err != nil {
+			return "", nil, noop, err
+		}
+		if branch == "" {
+			branch = defaultBranch
+		}
+
+		wtDir, err := git.WorktreesDir()
+		if err != nil {
+			return "", nil, noop, err
+		}
+		worktreePath := filepath.Join(wtDir, fmt.Sprintf("workflow-run-%d-%d", run.id, time.Now().UnixNano()))
+		if err := git.AddDetachedWorktree(localPath, worktreePath, branch); err != nil {
+			return "", nil, noop, err
+		}
+		run.logf("checked out %s of repository %d", branch, step.RepoID)
+		cleanup := func() {
+			if err := git.RemoveWorktree(localPath, worktreePath); err != nil {
+				log.Printf("workflow run %d: failed to remove worktree %s: %v", run.id, worktreePath, err)
 			}
-			sess := manager.Get(step.SessionID)
-			if sess == nil {
-				log.Printf("workflow %d: step %d session %s not found, skipping", workflowID, i+1, step.SessionID)
-				continue
+		}
+		return worktreePath, nil, cleanup, nil
+	}
+
+	return "", nil, noop, nil
+}
+
+func (run *workflowRun) createSession(step workflowStep) error {
+	sourceBranch, err := run.expand(step.SourceBranch)
+	if err != nil {
+		return err
+	}
+	newBranch, err := run.expand(step.NewBranch)
+	if err != nil {
+		return err
+	}
+	if newBranch == "" {
+		newBranch = fmt.Sprintf("workflow/%d-%s", run.workflowID, time.Now().Format("2006-01-02-150405"))
+	}
+
+	repoID := step.RepoID
+	if repoID == 0 {
+		repoID = run.repoID
+	}
+
+	session, err := createSession(run.db, run.manager, run.webhooks, createSessionParams{
+		RepoID:       repoID,
+		SourceBranch: sourceBranch,
+		NewBranch:    newBranch,
+		CLIType:      step.CLIType,
+		waitForSetup: true,
+	})
+	if err != nil {
+		return fmt.Errorf("create_session: %w", err)
+	}
+	log.Printf("workflow %d: created session %s on branch %s", run.workflowID, session.ID, session.Branch)
+
+	run.vars["session_id"] = session.ID
+	if step.SaveAs != "" {
+		run.vars[step.SaveAs] = session.ID
+	}
+	return nil
+}
+
+// expand substitutes workflow variables referenced as {{.name}} in s.
+func (run *workflowRun) expand(s string) (string, error) {
+	return expandTemplate(s, run.vars)
+}
+
+// expandTemplate substitutes variables referenced as {{.name}} in s.
+// Referencing an undefined variable is an error.
+func expandTemplate(s string, vars map[string]string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := template.New("step").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %q: %w", s, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("expand %q: %w", s, err)
+	}
+	return buf.String(), nil
+}
+
+// shellTemplateFuncs are the functions available in shell commands.
+var shellTemplateFuncs = template.FuncMap{"shq": shellQuote}
+
+// shellQuote quotes s as a single sh word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// parseShellCommand parses a shell step's command as a template, rejecting
+// any action whose output isn't quoted with shq, or that sits where shq's
+// quoting doesn't protect it (inside quotes, backticks, a comment or a
+// heredoc), so that variables (which may come from params or webhook events)
+// can't inject shell syntax.
+func parseShellCommand(command string) (*template.Template, error) {
+	tmpl, err := template.New("shell").Funcs(shellTemplateFuncs).Option("missingkey=error").Parse(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %q: %w", command, err)
+	}
+	state := shUnquoted
+	for _, node := range tmpl.Tree.Root.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			state = shellContext(state, string(n.Text))
+		case *parse.ActionNode:
+			if !quotedPipe(n.Pipe) {
+				return nil, fmt.Errorf("command %q: quote variables as {{shq .name}} or use \"$SP_VAR_name\"", command)
 			}
-			if _, err := sess.Write([]byte(step.Data)); err != nil {
-				log.Printf("workflow %d: step %d write error: %v", workflowID, i+1, err)
+			if state != shUnquoted {
+				return nil, fmt.Errorf("command %q: {{shq .name}} can't be used inside quotes, backticks, comments or heredocs; use \"$SP_VAR_name\" there", command)
 			}
 		default:
-			log.Printf("workflow %d: step %d unknown type %q, skipping", workflowID, i+1, step.Type)
+			return nil, fmt.Errorf("command %q: only {{shq .name}} actions are allowed", command)
+		}
+	}
+	return tmpl, nil
+}
+
+// Shell lexer states tracked by shellContext.
+const (
+	shUnquoted = iota
+	shSingle   // inside '...'
+	shDouble   // inside "..."
+	shBacktick // inside `...`
+	shComment  // after an unquoted #, up to the end of the line
+	shEscaped  // after an unquoted backslash
+	shUnknown  // after syntax shellContext doesn't follow, such as a heredoc
+)
+
+// shellContext returns the shell's lexer state after text, given the state
+// before it. It follows only enough of sh's syntax to tell whether a word
+// inserted after text would be unquoted, and gives up for good (shUnknown)
+// on anything more involved.
+func shellContext(state int, text string) int {
+	for i := 0; i < len(text) && state != shUnknown; i++ {
+		c := text[i]
+		switch state {
+		case shEscaped:
+			state = shUnquoted
+		case shSingle:
+			if c == '\'' {
+				state = shUnquoted
+			}
+		case shComment:
+			if c == '\n' {
+				state = shUnquoted
+			}
+		case shDouble, shBacktick:
+			switch {
+			case c == '\\':
+				i++
+			case c == '"' && state == shDouble, c == '`' && state == shBacktick:
+				state = shUnquoted
+			case c == '`', c == '"', c == '\'' && state == shBacktick,
+				c == '$' && strings.HasPrefix(text[i:], "$("):
+				// Nested quoting or command substitution.
+				state = shUnknown
+			}
+		case shUnquoted:
+			switch {
+			case c == '\\':
+				if i++; i == len(text) {
+					state = shEscaped
+				}
+			case c == '\'':
+				state = shSingle
+			case c == '"':
+				state = shDouble
+			case c == '`':
+				state = shBacktick
+			case c == '#' && (i == 0 || strings.IndexByte(" \t\n;&|()<>", text[i-1]) >= 0):
+				state = shComment
+			case c == '<' && strings.HasPrefix(text[i:], "<<"):
+				state = shUnknown
+			}
+		}
+	}
+	return state
+}
+
+// quotedPipe reports whether a pipeline's output goes through shq last.
+func quotedPipe(pipe *parse.PipeNode) bool {
+	if len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+		return false
+	}
+	id, ok := pipe.Cmds[len(pipe.Cmds)-1].Args[0].(*parse.IdentifierNode)
+	return ok && id.Ident == "shq"
+}
+
+// expandShellCommand substitutes variables in a shell step's command. Values
+// must be quoted with shq as a word of their own, e.g. git checkout
+// {{shq .branch}}; inside quotes use "$SP_VAR_branch" instead.
+func expandShellCommand(command string, vars map[string]string) (string, error) {
+	if !strings.Contains(command, "{{") {
+		return command, nil
+	}
+	tmpl, err := parseShellCommand(command)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("expand %q: %w", command, err)
+	}
+	return buf.String(), nil
+}
+
+// sessionID resolves a step's session_id, defaulting to the session most
+// recently created by this run.
+func (run *workflowRun) sessionID(raw string) (string, error) {
+	id, err := run.expand(raw)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		id = run.vars["session_id"]
+	}
+	if id == "" {
+		return "", fmt.Errorf("no session_id given and no session created by this workflow")
+	}
+	return id, nil
+}
+
+// session resolves a step's session and returns its running PTY handle.
+func (run *workflowRun) session(raw string) (ptymgr.SessionHandle, string, error) {
+	id, err := run.sessionID(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	sess := run.manager.Get(id)
+	if sess == nil {
+		return nil, id, fmt.Errorf("session %s not found or not running", id)
+	}
+	return sess, id, nil
+}
+
+// worktree returns the worktree path and branch recorded for a session.
+func (run *workflowRun) worktree(sessionID string) (string, string, error) {
+	var worktreePath, branch string
+	err := run.db.QueryRow(`SELECT worktree_path, branch FROM sessions WHERE id = ?`, sessionID).
+		Scan(&worktreePath, &branch)
+	if err == sql.ErrNoRows {
+		return "", "", fmt.Errorf("session %s not found", sessionID)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if worktreePath == "" {
+		return "", "", fmt.Errorf("session %s has no worktree", sessionID)
+	}
+	return worktreePath, branch, nil
+}
+
+// push pushes a session's branch to origin.
+func (run *workflowRun) push(sessionID string) error {
+	s, err := loadSessionGit(run.db, sessionID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+	if err != nil {
+		return err
+	}
+	run.logf("pushing %s", s.Branch)
+	_, err = pushSession(run.db, run.webhooks, s, false)
+	return err
+}
+
+func stepTimeout(step workflowStep) time.Duration {
+	if step.Timeout > 0 {
+		return time.Duration(step.Timeout) * time.Second
+	}
+	return defaultWaitTimeout
+}
+
+// waitForIdle blocks until the session has produced no output for idle.
+func waitForIdle(ctx context.Context, sess ptymgr.SessionHandle, idle, timeout time.Duration) error {
+	ch, unsub := sess.Subscribe()
+	defer unsub()
+
+	idleTimer := time.NewTimer(idle)
+	defer idleTimer.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("session exited")
+			}
+			if !idleTimer.Stop() {
+				<-idleTimer.C
+			}
+			idleTimer.Reset(idle)
+		case <-idleTimer.C:
+			return nil
+		case <-sess.Done():
+			return fmt.Errorf("session exited")
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("timed out after %s waiting for session to become idle", timeout)
+		}
+	}
+}
+
+// waitForOutput blocks until output produced after the call matches re.
+func waitForOutput(ctx context.Context, sess ptymgr.SessionHandle, re *regexp.Regexp, timeout time.Duration) error {
+	ch, unsub := sess.Subscribe()
+	defer unsub()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	var buf []byte
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("session exited")
+			}
+			buf = append(buf, data...)
+			if len(buf) > maxWaitOutputBuf {
+				buf = buf[len(buf)-maxWaitOutputBuf:]
+			}
+			if re.MatchString(stripANSI(string(buf))) {
+				return nil
+			}
+		case <-sess.Done():
+			return fmt.Errorf("session exited")
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("timed out after %s waiting for output matching %q", timeout, re.String())
 		}
 	}
 }
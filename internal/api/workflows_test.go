@@ -0,0 +1,56 @@
+package api
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestExpandShellCommandQuotes(t *testing.T) {
+	vars := map[string]string{"x": "$(id) `id` 'quoted' \"dq\"\nid"}
+	for _, command := range []string{
+		`printf %s {{shq .x}}`,
+		"# a comment\nprintf %s {{shq .x}}",
+	} {
+		expanded, err := expandShellCommand(command, vars)
+		if err != nil {
+			t.Fatalf("expandShellCommand(%q): %v", command, err)
+		}
+		out, err := exec.Command("sh", "-c", expanded).Output()
+		if err != nil {
+			t.Fatalf("sh -c %q: %v", expanded, err)
+		}
+		if string(out) != vars["x"] {
+			t.Errorf("sh -c %q printed %q, want %q", expanded, out, vars["x"])
+		}
+	}
+}
+
+func TestParseShellCommandRejects(t *testing.T) {
+	for _, command := range []string{
+		`echo {{.x}}`,
+		`echo {{shq .x | printf "%s"}}`,
+		`{{range .x}}echo{{end}}`,
+		`echo "{{shq .x}}"`,
+		`echo "a $(echo ")" {{shq .x}}`,
+		`echo '{{shq .x}}'`,
+		"echo `{{shq .x}}`",
+		"echo `echo 'a` {{shq .x}}",
+		`echo \{{shq .x}}`,
+		`echo $'{{shq .x}}'`,
+		`# {{shq .x}}`,
+		`echo a; #{{shq .x}}`,
+		"cat <<EOF\n{{shq .x}}\nEOF",
+	} {
+		if _, err := parseShellCommand(command); err == nil {
+			t.Errorf("parseShellCommand(%q) accepted an unsafe command", command)
+		}
+	}
+}
+
+func TestExpandShellCommandDoubleQuoted(t *testing.T) {
+	// shq's single quotes are literal inside double quotes, so $(...) in the
+	// value would still run.
+	if _, err := expandShellCommand(`echo "{{shq .x}}"`, map[string]string{"x": "$(id)"}); err == nil {
+		t.Error(`"{{shq .x}}" with x = "$(id)" was expanded`)
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/peterje/superposition/internal/git"
+)
+
+// errWorktreeDirty is returned by removeSessionWorktree when the worktree has
+// uncommitted changes and removal wasn't forced.
+var errWorktreeDirty = errors.New("worktree has uncommitted changes")
+
+// worktreeBackupMode returns how uncommitted changes are saved before a
+// worktree is removed, from the worktree_backup setting:
+//
+//   - "commit" (default): commit them to refs/superposition/backups/<session>/<unix time>
+//   - "stash": git stash push --include-untracked
+//   - "none": don't save them
+func worktreeBackupMode(db *sql.DB) string {
+	switch mode := settingValue(db, "worktree_backup"); mode {
+	case "stash", "none":
+		return mode
+	default:
+		return "commit"
+	}
+}
+
+// worktreeDirty reports whether a worktree has changes other than the
+// .mcp.json superposition writes into every session's worktree.
+func worktreeDirty(worktreePath string) (bool, error) {
+	status, err := git.Status(worktreePath)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range status.Files {
+		if f.Path != ".mcp.json" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// removeSessionWorktree removes a session's worktree. A dirty worktree is
+// only removed with force, after its changes are saved according to the
+// worktree_backup setting; a failed backup aborts the removal. A worktree
+// that is already gone is pruned from the repository's records.
+func removeSessionWorktree(db *sql.DB, sessionID, repoPath, worktreePath string, force bool) error {
+	if _, err := os.Stat(worktreePath); err != nil {
+		return git.PruneWorktrees(repoPath)
+	}
+
+	dirty, err := worktreeDirty(worktreePath)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		if !force {
+			return errWorktreeDirty
+		}
+		message := fmt.Sprintf("superposition: backup of session %s", sessionID)
+		switch worktreeBackupMode(db) {
+		case "commit":
+			ref := fmt.Sprintf("%s%s/%d", git.BackupRefPrefix, sessionID, time.Now().Unix())
+			if _, err := git.BackupWorktree(worktreePath, ref, message); err != nil {
+				return fmt.Errorf("backup: %w", err)
+			}
+			log.Printf("Backed up uncommitted changes of session %s to %s", sessionID, ref)
+		case "stash":
+			if err := git.StashWorktree(worktreePath, message); err != nil {
+				return fmt.Errorf("backup: %w", err)
+			}
+			log.Printf("Stashed uncommitted changes of session %s", sessionID)
+		}
+	}
+	return git.RemoveWorktree(repoPath, worktreePath)
+}
+
+// currentBackup returns a session's latest backup ref if it was made on top
+// of the branch's current commit, or "" if there is none or the branch has
+// moved on since, in which case its changes were presumably committed.
+func currentBackup(repoPath, sessionID, branch string) string {
+	ref := git.LatestBackup(repoPath, git.BackupRefPrefix+sessionID+"/")
+	if ref == "" {
+		return ""
+	}
+	parent, err := git.RevParse(repoPath, ref+"^")
+	if err != nil {
+		return ""
+	}
+	if head, err := git.RevParse(repoPath, "refs/heads/"+branch); err != nil || head != parent {
+		return ""
+	}
+	return ref
+}
+
+// checkoutSessionWorktree checks out a session's branch again at the
+// worktree path it had, limited to its sparse checkout paths, with its MCP
+// config, and re-applies the backup of its uncommitted changes, if there is
+// a current one.
+func checkoutSessionWorktree(sessionID, repoPath, worktreePath, branch string, sparse []string, mcpServers map[string]any) error {
+	git.PruneWorktrees(repoPath)
+	if err := git.AddWorktreeForBranch(repoPath, worktreePath, branch, sparse); err != nil {
+		return err
+	}
+	WriteSessionMCPConfig(sessionID, worktreePath)
+	if err := addMCPServers(worktreePath, mcpServers); err != nil {
+		log.Printf("Failed to add repo MCP servers for session %s: %v", sessionID, err)
+	}
+	log.Printf("Session %s: restored worktree from branch %s", sessionID, branch)
+	if ref := currentBackup(repoPath, sessionID, branch); ref != "" {
+		if err := git.ApplyBackup(worktreePath, ref, ".mcp.json"); err != nil {
+			log.Printf("Session %s: failed to re-apply %s: %v", sessionID, ref, err)
+		} else {
+			log.Printf("Session %s: re-applied uncommitted changes from %s", sessionID, ref)
+		}
+	}
+	return nil
+}
+
+// worktreeJanitorInterval is how often RunWorktreeJanitor looks for expired
+// worktrees.
+const worktreeJanitorInterval = time.Hour
+
+// RunWorktreeJanitor keeps stopped sessions' worktrees for the number of days
+// in the worktree_retention_days setting, then removes them. Without the
+// setting (or with 0) worktrees are kept until their session is deleted.
+// Dirty worktrees are removed only when worktree_backup saves their changes.
+// It never returns.
+func RunWorktreeJanitor(db *sql.DB) {
+	for {
+		expireWorktrees(db)
+		time.Sleep(worktreeJanitorInterval)
+	}
+}
+
+func expireWorktrees(db *sql.DB) {
+	days, _ := strconv.Atoi(settingValue(db, "worktree_retention_days"))
+	if days <= 0 {
+		return
+	}
+
+	rows, err := db.Query(`SELECT s.id, s.worktree_path, r.local_path FROM sessions s
+		JOIN repositories r ON s.repo_id = r.id
+		WHERE s.status IN ('stopped', 'error', 'setup_failed') AND s.worktree_path != ''
+		AND s.stopped_at <= datetime('now', ?)`, fmt.Sprintf("-%d days", days))
+	if err != nil {
+		log.Printf("worktree janitor: %v", err)
+		return
+	}
+	type expired struct{ id, worktreePath, repoPath string }
+	var sessions []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.id, &e.worktreePath, &e.repoPath); err == nil {
+			sessions = append(sessions, e)
+		}
+	}
+	rows.Close()
+
+	force := worktreeBackupMode(db) != "none"
+	for _, e := range sessions {
+		if _, err := os.Stat(e.worktreePath); err != nil {
+			continue
+		}
+		err := removeSessionWorktree(db, e.id, e.repoPath, e.worktreePath, force)
+		switch {
+		case errors.Is(err, errWorktreeDirty):
+			log.Printf("worktree janitor: keeping %s: uncommitted changes and worktree_backup is none", e.worktreePath)
+		case err != nil:
+			log.Printf("worktree janitor: remove %s: %v", e.worktreePath, err)
+		default:
+			log.Printf("worktree janitor: removed worktree of session %s (retention %d days)", e.id, days)
+		}
+	}
+}
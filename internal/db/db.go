@@ -39,10 +39,32 @@ func Open() (*sql.DB, error) {
 	return db, nil
 }
 
-func Migrate(db *sql.DB, migrationsSQL string) error {
-	_, err := db.Exec(migrationsSQL)
-	if err != nil {
-		return fmt.Errorf("run migrations: %w", err)
+// Migrate runs migrationSQL unless a migration with the same name has already
+// been applied, then records it in schema_migrations. Databases created before
+// migrations were tracked re-run every migration once, which is safe because
+// the early migrations were written to run on every startup.
+func Migrate(db *sql.DB, name, migrationSQL string) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		name TEXT PRIMARY KEY,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var applied int
+	err := db.QueryRow(`SELECT 1 FROM schema_migrations WHERE name = ?`, name).Scan(&applied)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("check migration %s: %w", name, err)
+	}
+
+	if _, err := db.Exec(migrationSQL); err != nil {
+		return fmt.Errorf("run migration %s: %w", name, err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations (name) VALUES (?)`, name); err != nil {
+		return fmt.Errorf("record migration %s: %w", name, err)
 	}
 	return nil
 }
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/peterje/superposition/internal/db"
+)
+
+// CredentialsEnv carries a random secret, generated when the server starts,
+// to the git commands superposition runs itself. The credential helper only
+// hands out tokens to git processes that present it, so agents running git
+// in a session can't get tokens from the helper (e.g. with "git credential
+// fill"). This doesn't stop an agent running as the same OS user from
+// reading the database and its key from the data directory.
+const CredentialsEnv = "SUPERPOSITION_GIT_CREDENTIALS"
+
+// credentialsNonceFile is where the server records the SHA-256 of its
+// credentials secret, in the data directory, for the helper to check.
+const credentialsNonceFile = "git-credential.sha256"
+
+// credentialHelper is the credential.helper value configured in bare repos,
+// set at startup by SetCredentialHelper.
+var credentialHelper string
+
+// credentialsNonce is the secret passed in CredentialsEnv.
+var credentialsNonce string
+
+// SetCredentialHelper configures HTTPS authentication to go through
+// "<exe> git-credential", which looks tokens up in the database when git
+// asks for them instead of storing them in remote URLs. It generates the
+// secret the helper requires in CredentialsEnv and records its hash.
+func SetCredentialHelper(exe string) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("generate credentials secret: %w", err)
+	}
+	nonce := hex.EncodeToString(b)
+	dir, err := db.DataDir()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(nonce))
+	if err := os.WriteFile(filepath.Join(dir, credentialsNonceFile), []byte(hex.EncodeToString(sum[:])), 0600); err != nil {
+		return fmt.Errorf("record credentials secret: %w", err)
+	}
+	credentialsNonce = nonce
+	credentialHelper = "!'" + strings.ReplaceAll(exe, "'", `'\''`) + "' git-credential"
+	return nil
+}
+
+// ValidCredentialsNonce reports whether nonce, taken from CredentialsEnv, is
+// the running server's credentials secret.
+func ValidCredentialsNonce(nonce string) bool {
+	if nonce == "" {
+		return false
+	}
+	dir, err := db.DataDir()
+	if err != nil {
+		return false
+	}
+	want, err := os.ReadFile(filepath.Join(dir, credentialsNonceFile))
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256([]byte(nonce))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), bytes.TrimSpace(want)) == 1
+}
+
+// Auth holds the credentials used to talk to a repository's remote that
+// git can't get from the credential helper: the private key for SSH
+// remotes. When SSHKey is empty the user's ssh configuration is used.
+type Auth struct {
+	SSHKey string
+}
+
+// IsSSHURL reports whether a remote URL uses SSH, either as ssh://... or in
+// scp-like form (git@host:owner/repo.git).
+func IsSSHURL(rawURL string) bool {
+	if strings.HasPrefix(rawURL, "ssh://") || strings.HasPrefix(rawURL, "git+ssh://") {
+		return true
+	}
+	if strings.Contains(rawURL, "://") {
+		return false
+	}
+	at := strings.Index(rawURL, "@")
+	colon := strings.Index(rawURL, ":")
+	return at >= 0 && colon > at
+}
+
+// StripCredentials removes any user info from an HTTP(S) remote URL.
+func StripCredentials(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// env returns the environment for git commands that contact the remote:
+// never prompt, allow the credential helper to answer, and use the
+// configured SSH key if any.
+func (a Auth) env() []string {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0", CredentialsEnv+"="+credentialsNonce)
+	if a.SSHKey != "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -i '"+strings.ReplaceAll(a.SSHKey, "'", `'\''`)+
+			"' -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new -o BatchMode=yes")
+	}
+	return env
+}
+
+// command returns a git command that authenticates as a.
+func (a Auth) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Env = a.env()
+	return cmd
+}
+
+// commandContext is command for a git command that ctx can stop.
+func (a Auth) commandContext(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = a.env()
+	return cmd
+}
+
+// credentialArgs returns -c options that make a single git command use the
+// credential helper, for commands run before a repo's config exists.
+func credentialArgs() []string {
+	if credentialHelper == "" {
+		return nil
+	}
+	return []string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper, "-c", "credential.useHttpPath=true"}
+}
+
+// ConfigureCredentials makes a bare repo (and its worktrees, which share
+// its config) authenticate through the credential helper, and removes
+// credentials left behind by older versions that embedded the token in the
+// origin URL.
+func ConfigureCredentials(barePath string) error {
+	if out, err := exec.Command("git", "-C", barePath, "remote", "get-url", "origin").Output(); err == nil {
+		origin := strings.TrimSpace(string(out))
+		if stripped := StripCredentials(origin); stripped != origin {
+			if err := exec.Command("git", "-C", barePath, "remote", "set-url", "origin", stripped).Run(); err != nil {
+				return err
+			}
+		}
+	}
+	// FETCH_HEAD records the URL each ref was fetched from.
+	os.Remove(filepath.Join(barePath, "FETCH_HEAD"))
+
+	if credentialHelper == "" {
+		return nil
+	}
+	exec.Command("git", "-C", barePath, "config", "--unset-all", "credential.helper").Run()
+	for _, args := range [][]string{
+		{"config", "--add", "credential.helper", ""},
+		{"config", "--add", "credential.helper", credentialHelper},
+		{"config", "credential.useHttpPath", "true"},
+	} {
+		if err := exec.Command("git", append([]string{"-C", barePath}, args...)...).Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CreateBundle writes refs of the repository at repoPath, with all the
+// objects they need, to a bundle file at bundlePath.
+func CreateBundle(repoPath, bundlePath string, refs ...string) error {
+	args := append([]string{"-C", repoPath, "bundle", "create", bundlePath}, refs...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git bundle create: %s: %w", string(out), err)
+	}
+	return nil
+}
+
+// FetchBundle fetches refspecs from a bundle file into the repository at
+// repoPath. Refspecs without a leading + only fast-forward existing refs.
+func FetchBundle(repoPath, bundlePath string, refspecs ...string) error {
+	args := append([]string{"-C", repoPath, "fetch", "--no-tags", bundlePath}, refspecs...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git fetch bundle: %s: %w", string(out), err)
+	}
+	return nil
+}
+
+// RevParse returns the commit ID rev resolves to in the repository at
+// repoPath.
+func RevParse(repoPath, rev string) (string, error) {
+	out, err := exec.Command("git", "-C", repoPath, "rev-parse", "--verify", rev+"^{commit}").Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse %s: %w", rev, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
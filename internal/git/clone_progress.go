@@ -0,0 +1,126 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// CloneProgress is how far a clone has got, as reported by git clone
+// --progress. Phase is git's name for the current step ("Counting objects",
+// "Receiving objects", "Resolving deltas", ...) and Percent, Current and
+// Total its progress through that step. Bytes is how much has been received
+// so far, which git only reports while receiving objects.
+type CloneProgress struct {
+	Phase   string `json:"phase"`
+	Percent int    `json:"percent"`
+	Current int64  `json:"current"`
+	Total   int64  `json:"total"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// "remote: Compressing objects:  45% (450/1000)"
+// "Receiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s"
+var (
+	progressRe      = regexp.MustCompile(`^(?:remote: )?([A-Za-z ]+):\s+(\d+)% \((\d+)/(\d+)\)`)
+	progressCountRe = regexp.MustCompile(`^(?:remote: )?([A-Za-z ]+):\s+(\d+)(?:,|$)`)
+	progressBytesRe = regexp.MustCompile(`, ([\d.]+) (bytes|KiB|MiB|GiB)`)
+)
+
+var byteUnits = map[string]float64{"bytes": 1, "KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30}
+
+// parse updates p from a progress line, reporting whether it was one.
+func (p *CloneProgress) parse(line string) bool {
+	if m := progressRe.FindStringSubmatch(line); m != nil {
+		p.Phase = m[1]
+		p.Percent, _ = strconv.Atoi(m[2])
+		p.Current, _ = strconv.ParseInt(m[3], 10, 64)
+		p.Total, _ = strconv.ParseInt(m[4], 10, 64)
+	} else if m := progressCountRe.FindStringSubmatch(line); m != nil {
+		// Phases with no known total, such as "Enumerating objects: 1200".
+		p.Phase = m[1]
+		p.Percent, p.Total = 0, 0
+		p.Current, _ = strconv.ParseInt(m[2], 10, 64)
+	} else {
+		return false
+	}
+	if m := progressBytesRe.FindStringSubmatch(line); m != nil {
+		n, _ := strconv.ParseFloat(m[1], 64)
+		p.Bytes = int64(n * byteUnits[m[2]])
+	}
+	return true
+}
+
+// progressWriter collects a clone's output, passing each progress update to
+// fn and keeping the other lines for error messages. git redraws progress
+// lines with \r, so both \r and \n end a line.
+type progressWriter struct {
+	fn       func(CloneProgress)
+	progress CloneProgress
+	partial  []byte
+	output   []string
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.partial = append(w.partial, b...)
+	for {
+		i := bytes.IndexAny(w.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.line(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+func (w *progressWriter) line(line string) {
+	line = strings.TrimSpace(strings.ReplaceAll(line, "\x00", ""))
+	if line == "" {
+		return
+	}
+	if w.progress.parse(line) {
+		if w.fn != nil {
+			w.fn(w.progress)
+		}
+		return
+	}
+	w.output = append(w.output, line)
+}
+
+func (w *progressWriter) String() string {
+	if len(w.partial) > 0 {
+		w.line(string(w.partial))
+		w.partial = nil
+	}
+	return strings.Join(w.output, "\n")
+}
+
+// runClone runs a git clone into localPath, reporting its progress to
+// progress if it isn't nil. Cancelling ctx stops git and removes whatever
+// it had cloned; the error is then ctx's.
+func runClone(ctx context.Context, cmd *exec.Cmd, localPath string, progress func(CloneProgress)) error {
+	// Let git clean up after itself before it is killed.
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = 10 * time.Second
+	out := &progressWriter{fn: progress}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		os.RemoveAll(localPath)
+		return ctx.Err()
+	}
+	if err != nil {
+		os.RemoveAll(localPath)
+		return fmt.Errorf("git clone: %s: %w", out, err)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// FileStat summarises the change to one file in a diff.
+type FileStat struct {
+	Path      string `json:"path"`
+	OldPath   string `json:"old_path,omitempty"`
+	Status    string `json:"status"` // added, modified, deleted, renamed, copied, type_changed
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary"`
+}
+
+// BaseCommit returns the commit a worktree's branch forked from
+// sourceBranch: their merge base.
+func BaseCommit(barePath, worktreePath, sourceBranch string) (string, error) {
+	base := resolveBase(barePath, sourceBranch)
+	out, err := exec.Command("git", "-C", worktreePath, "merge-base", base, "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("git merge-base %s: %w", sourceBranch, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// BranchBaseCommit is BaseCommit for a branch of the bare repo, for when
+// the session's worktree is gone.
+func BranchBaseCommit(barePath, branch, sourceBranch string) (string, error) {
+	base := resolveBase(barePath, sourceBranch)
+	out, err := exec.Command("git", "-C", barePath, "merge-base", base, "refs/heads/"+branch).Output()
+	if err != nil {
+		return "", fmt.Errorf("git merge-base %s: %w", sourceBranch, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// SnapshotTree writes the current contents of a worktree, including
+// uncommitted and untracked (but not ignored) files, as a tree object and
+// returns its ID. It uses a temporary index, so the worktree's own index
+// and staged changes are left alone.
+func SnapshotTree(worktreePath string) (string, error) {
+	idx, err := os.CreateTemp("", "superposition-index-*")
+	if err != nil {
+		return "", fmt.Errorf("create temp index: %w", err)
+	}
+	idx.Close()
+	// git treats an empty file as a corrupt index; start from none.
+	os.Remove(idx.Name())
+	defer os.Remove(idx.Name())
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+idx.Name())
+	run := func(args ...string) (string, error) {
+		cmd := exec.Command("git", append([]string{"-C", worktreePath}, args...)...)
+		cmd.Env = env
+		out, err := cmd.Output()
+		if err != nil {
+			if ee, ok := err.(*exec.ExitError); ok {
+				return "", fmt.Errorf("git %s: %s: %w", args[0], strings.TrimSpace(string(ee.Stderr)), err)
+			}
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	if _, err := run("read-tree", "HEAD"); err != nil {
+		return "", err
+	}
+	if _, err := run("add", "-A"); err != nil {
+		return "", err
+	}
+	return run("write-tree")
+}
+
+// DiffTrees returns the unified diff between two tree-ish objects in repoPath,
+// optionally limited to paths.
+func DiffTrees(repoPath, from, to string, paths ...string) (string, error) {
+	args := []string{"-C", repoPath, "diff", "--no-color", "--no-ext-diff", "-M", from, to}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff: %w", err)
+	}
+	return string(out), nil
+}
+
+// Diff returns the structured diff between two tree-ish objects in repoPath,
+// optionally limited to paths. An empty to diffs from against the working
+// tree. contextLines < 0 uses git's default.
+func Diff(repoPath, from, to string, contextLines int, paths ...string) ([]FileDiff, error) {
+	revs := []string{from}
+	if to != "" {
+		revs = append(revs, to)
+	}
+	return structuredDiff(repoPath, revs, contextLines, paths)
+}
+
+// DiffStaged returns the structured diff of a worktree's staged changes.
+func DiffStaged(worktreePath string, contextLines int, paths ...string) ([]FileDiff, error) {
+	return structuredDiff(worktreePath, []string{"--cached"}, contextLines, paths)
+}
+
+// DiffUnstaged returns the structured diff of a worktree's unstaged changes.
+func DiffUnstaged(worktreePath string, contextLines int, paths ...string) ([]FileDiff, error) {
+	return structuredDiff(worktreePath, nil, contextLines, paths)
+}
+
+func structuredDiff(repoPath string, revs []string, contextLines int, paths []string) ([]FileDiff, error) {
+	args := []string{"-C", repoPath, "diff", "--no-color", "--no-ext-diff", "-M"}
+	if contextLines >= 0 {
+		args = append(args, "-U"+strconv.Itoa(contextLines))
+	}
+	args = append(args, revs...)
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff: %w", err)
+	}
+	return ParsePatch(string(out)), nil
+}
+
+// DiffStats returns per-file change counts between two tree-ish objects.
+func DiffStats(repoPath, from, to string, paths ...string) ([]FileStat, error) {
+	args := []string{"-C", repoPath, "diff", "--no-color", "-M", "--numstat", "-z", from, to}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	numstat, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff --numstat: %w", err)
+	}
+	args[5] = "--name-status"
+	nameStatus, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff --name-status: %w", err)
+	}
+
+	stats := parseNumstat(string(numstat))
+	statuses := parseNameStatus(string(nameStatus))
+	for i := range stats {
+		stats[i].Status = statuses[stats[i].Path]
+	}
+	return stats, nil
+}
+
+// parseNumstat parses `git diff --numstat -z` output. Renames are reported
+// as "added\tdeleted\t\0old\0new\0".
+func parseNumstat(out string) []FileStat {
+	fields := strings.Split(out, "\x00")
+	stats := []FileStat{}
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		fs := FileStat{Path: parts[2]}
+		if parts[0] == "-" && parts[1] == "-" {
+			fs.Binary = true
+		} else {
+			fs.Additions, _ = strconv.Atoi(parts[0])
+			fs.Deletions, _ = strconv.Atoi(parts[1])
+		}
+		if fs.Path == "" && i+2 < len(fields) {
+			fs.OldPath = fields[i+1]
+			fs.Path = fields[i+2]
+			i += 2
+		}
+		stats = append(stats, fs)
+	}
+	return stats
+}
+
+// parseNameStatus parses `git diff --name-status -z` output into a map from
+// new path to status.
+func parseNameStatus(out string) map[string]string {
+	fields := strings.Split(out, "\x00")
+	statuses := map[string]string{}
+	for i := 0; i+1 < len(fields); i++ {
+		code := fields[i]
+		if code == "" {
+			continue
+		}
+		path := fields[i+1]
+		i++
+		if (code[0] == 'R' || code[0] == 'C') && i+1 < len(fields) {
+			path = fields[i+1]
+			i++
+		}
+		statuses[path] = statusName(code[0])
+	}
+	return statuses
+}
+
+func statusName(code byte) string {
+	switch code {
+	case 'A':
+		return "added"
+	case 'D':
+		return "deleted"
+	case 'R':
+		return "renamed"
+	case 'C':
+		return "copied"
+	case 'T':
+		return "type_changed"
+	default:
+		return "modified"
+	}
+}
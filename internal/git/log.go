@@ -0,0 +1,83 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit is one entry of a git log.
+type Commit struct {
+	Hash        string    `json:"hash"`
+	ShortHash   string    `json:"short_hash"`
+	Parents     []string  `json:"parents"`
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email"`
+	AuthorDate  time.Time `json:"author_date"`
+	Subject     string    `json:"subject"`
+	Body        string    `json:"body"`
+}
+
+// logFormat separates fields with \x1f; records end with \x1e.
+const logFormat = "%H%x1f%h%x1f%P%x1f%an%x1f%ae%x1f%aI%x1f%s%x1f%b%x1e"
+
+// Log returns up to limit commits reachable from rev, newest first. rev may
+// be a range such as "base..HEAD".
+func Log(repoPath, rev string, limit int) ([]Commit, error) {
+	args := []string{"-C", repoPath, "log", "--format=" + logFormat}
+	if limit > 0 {
+		args = append(args, "-n", strconv.Itoa(limit))
+	}
+	args = append(args, rev, "--")
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log: %w", err)
+	}
+	return parseLog(string(out)), nil
+}
+
+// Show returns a commit and its changes against its first parent.
+func Show(repoPath, rev string) (Commit, []FileDiff, error) {
+	out, err := exec.Command("git", "-C", repoPath, "show", "--no-color", "--no-ext-diff", "-M",
+		"--format="+logFormat, rev, "--").Output()
+	if err != nil {
+		return Commit{}, nil, fmt.Errorf("git show %s: %w", rev, err)
+	}
+	header, patch, _ := strings.Cut(string(out), "\x1e")
+	commits := parseLog(header + "\x1e")
+	if len(commits) == 0 {
+		return Commit{}, nil, fmt.Errorf("git show %s: no commit", rev)
+	}
+	return commits[0], ParsePatch(strings.TrimLeft(patch, "\n")), nil
+}
+
+func parseLog(out string) []Commit {
+	commits := []Commit{}
+	for _, rec := range strings.Split(out, "\x1e") {
+		rec = strings.TrimLeft(rec, "\n")
+		if rec == "" {
+			continue
+		}
+		f := strings.Split(rec, "\x1f")
+		if len(f) != 8 {
+			continue
+		}
+		c := Commit{
+			Hash:        f[0],
+			ShortHash:   f[1],
+			Parents:     strings.Fields(f[2]),
+			AuthorName:  f[3],
+			AuthorEmail: f[4],
+			Subject:     f[6],
+			Body:        strings.TrimSpace(f[7]),
+		}
+		c.AuthorDate, _ = time.Parse(time.RFC3339, f[5])
+		if c.Parents == nil {
+			c.Parents = []string{}
+		}
+		commits = append(commits, c)
+	}
+	return commits
+}
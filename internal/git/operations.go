@@ -1,10 +1,13 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/peterje/superposition/internal/db"
@@ -26,9 +29,30 @@ func WorktreesDir() (string, error) {
 	return filepath.Join(dataDir, "worktrees"), nil
 }
 
-// CloneBare clones a repo as a bare repository.
-// For private repos, the PAT is embedded in the URL.
-func CloneBare(cloneURL, pat, owner, name string) (string, error) {
+// CloneOptions limit what a clone downloads. Filter is a partial clone
+// filter such as "blob:none", whose missing objects git fetches on demand,
+// and Depth > 0 makes a shallow clone of every branch.
+type CloneOptions struct {
+	Filter string
+	Depth  int
+}
+
+func (o CloneOptions) args() []string {
+	var args []string
+	if o.Filter != "" {
+		args = append(args, "--filter="+o.Filter)
+	}
+	if o.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(o.Depth), "--no-single-branch")
+	}
+	return args
+}
+
+// CloneBare clones a repo as a bare repository under owner/name.git in the
+// repos directory. HTTPS credentials come from the credential helper.
+// Progress is reported to progress if it isn't nil; cancelling ctx stops
+// the clone and removes it.
+func CloneBare(ctx context.Context, cloneURL string, auth Auth, owner, name string, opts CloneOptions, progress func(CloneProgress)) (string, error) {
 	reposDir, err := ReposDir()
 	if err != nil {
 		return "", err
@@ -43,17 +67,17 @@ func CloneBare(cloneURL, pat, owner, name string) (string, error) {
 
 	// If already exists, just fetch
 	if _, err := os.Stat(localPath); err == nil {
-		return localPath, Fetch(localPath, pat)
+		return localPath, Fetch(localPath, auth)
 	}
 
-	authURL := cloneURL
-	if pat != "" {
-		authURL = strings.Replace(cloneURL, "https://", "https://x-access-token:"+pat+"@", 1)
+	args := append(credentialArgs(), "clone", "--bare", "--progress")
+	args = append(args, opts.args()...)
+	cmd := auth.commandContext(ctx, append(args, cloneURL, localPath)...)
+	if err := runClone(ctx, cmd, localPath, progress); err != nil {
+		return "", err
 	}
-
-	cmd := exec.Command("git", "clone", "--bare", authURL, localPath)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("git clone: %s: %w", string(out), err)
+	if err := ConfigureCredentials(localPath); err != nil {
+		return "", fmt.Errorf("configure credentials: %w", err)
 	}
 
 	// git clone --bare doesn't set a fetch refspec. Configure it to fetch into
@@ -64,8 +88,11 @@ func CloneBare(cloneURL, pat, owner, name string) (string, error) {
 }
 
 // CloneBareLocal clones a local git repo as a bare repository.
-// No PAT needed — uses direct filesystem path as origin.
-func CloneBareLocal(sourcePath, name string) (string, error) {
+// No PAT needed — uses direct filesystem path as origin. With clone options
+// it clones from a file:// URL instead, as git ignores them for plain paths;
+// filters also need uploadpack.allowFilter in the source repo. Progress and
+// cancellation work as for CloneBare.
+func CloneBareLocal(ctx context.Context, sourcePath, name string, opts CloneOptions, progress func(CloneProgress)) (string, error) {
 	// Validate that sourcePath is a git repo
 	cmd := exec.Command("git", "-C", sourcePath, "rev-parse", "--git-dir")
 	if out, err := cmd.CombinedOutput(); err != nil {
@@ -90,16 +117,21 @@ func CloneBareLocal(sourcePath, name string) (string, error) {
 		out, err := originCmd.Output()
 		if err == nil {
 			existingOrigin := strings.TrimSpace(string(out))
-			if existingOrigin != sourcePath {
+			if existingOrigin != sourcePath && existingOrigin != "file://"+sourcePath {
 				return "", fmt.Errorf("bare repo already exists with different origin: %s", existingOrigin)
 			}
 		}
-		return localPath, Fetch(localPath, "")
+		return localPath, Fetch(localPath, Auth{})
 	}
 
-	cloneCmd := exec.Command("git", "clone", "--bare", sourcePath, localPath)
-	if out, err := cloneCmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("git clone: %s: %w", string(out), err)
+	origin := sourcePath
+	if opts != (CloneOptions{}) {
+		origin = "file://" + sourcePath
+	}
+	cloneArgs := append([]string{"clone", "--bare", "--progress"}, opts.args()...)
+	cloneCmd := exec.CommandContext(ctx, "git", append(cloneArgs, origin, localPath)...)
+	if err := runClone(ctx, cloneCmd, localPath, progress); err != nil {
+		return "", err
 	}
 
 	// Configure fetch refspec for bare clone
@@ -108,44 +140,91 @@ func CloneBareLocal(sourcePath, name string) (string, error) {
 	return localPath, nil
 }
 
-func Fetch(barePath, pat string) error {
+func Fetch(barePath string, auth Auth) error {
+	_, err := FetchBranches(barePath, auth)
+	return err
+}
+
+// FetchResult lists the local branches a fetch fast-forwarded to their
+// remote's commit, those it left behind because a worktree has them checked
+// out, and those it left alone because they have commits the remote's
+// doesn't.
+type FetchResult struct {
+	Updated  []string `json:"updated"`
+	Skipped  []string `json:"skipped"`
+	Diverged []string `json:"diverged"`
+}
+
+// FetchBranches is Fetch, reporting which local branches it updated and
+// which it skipped.
+func FetchBranches(barePath string, auth Auth) (FetchResult, error) {
+	result := FetchResult{Updated: []string{}, Skipped: []string{}, Diverged: []string{}}
+
 	// Fetch into a remote-tracking namespace to avoid conflicts with branches
 	// checked out in worktrees. We then fast-forward local branches that
 	// aren't currently checked out.
 	exec.Command("git", "-C", barePath, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*").Run()
 
-	cmd := exec.Command("git", "-C", barePath, "fetch", "--all", "--prune")
-	if pat != "" {
-		cmd.Env = append(os.Environ(),
-			fmt.Sprintf("GIT_ASKPASS=echo"),
-			fmt.Sprintf("GIT_TERMINAL_PROMPT=0"),
-		)
-		// Set the remote URL with auth for fetch
-		setURL := exec.Command("git", "-C", barePath, "remote", "set-url", "origin",
-			getAuthURL(barePath, pat))
-		setURL.Run() // best effort
-	}
+	cmd := auth.command("-C", barePath, "fetch", "--all", "--prune")
 	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git fetch: %s: %w", string(out), err)
+		return result, fmt.Errorf("git fetch: %s: %w", string(out), err)
 	}
 
 	// Update local branches from remote-tracking refs, skipping any that are
 	// checked out in a worktree.
 	checkedOut := worktreeBranches(barePath)
-	remotes, _ := exec.Command("git", "-C", barePath, "for-each-ref", "--format=%(refname:short)", "refs/remotes/origin/").Output()
-	for _, line := range strings.Split(strings.TrimSpace(string(remotes)), "\n") {
-		branch := strings.TrimPrefix(line, "origin/")
-		if branch == "" || branch == "HEAD" {
+	local := refCommits(barePath, "refs/heads/")
+	for ref, commit := range refCommits(barePath, "refs/remotes/origin/") {
+		branch := strings.TrimPrefix(ref, "refs/remotes/origin/")
+		if branch == "HEAD" || local["refs/heads/"+branch] == commit {
 			continue
 		}
 		if checkedOut[branch] {
+			result.Skipped = append(result.Skipped, branch)
 			continue
 		}
-		// Fast-forward the local branch to match the remote-tracking ref
-		exec.Command("git", "-C", barePath, "update-ref", "refs/heads/"+branch, "refs/remotes/origin/"+branch).Run()
+		// Only fast-forward: a local branch with commits the remote doesn't
+		// have (such as a stopped session's unpushed work) is left alone.
+		old, exists := local["refs/heads/"+branch]
+		if exists && !IsAncestor(barePath, old, commit) {
+			result.Diverged = append(result.Diverged, branch)
+			continue
+		}
+		if exec.Command("git", "-C", barePath, "update-ref", "refs/heads/"+branch, commit, old).Run() == nil {
+			result.Updated = append(result.Updated, branch)
+		}
 	}
+	sort.Strings(result.Updated)
+	sort.Strings(result.Skipped)
+	sort.Strings(result.Diverged)
+	return result, nil
+}
 
-	return nil
+// refCommits maps the refs under prefix to the commits they point at.
+func refCommits(repoPath, prefix string) map[string]string {
+	refs := map[string]string{}
+	out, _ := exec.Command("git", "-C", repoPath, "for-each-ref", "--format=%(refname) %(objectname)", prefix).Output()
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if ref, commit, ok := strings.Cut(line, " "); ok {
+			refs[ref] = commit
+		}
+	}
+	return refs
+}
+
+// Divergence counts the commits branch has that sourceBranch doesn't
+// (ahead) and the commits sourceBranch has that branch doesn't (behind),
+// using origin's copy of sourceBranch when there is one.
+func Divergence(barePath, branch, sourceBranch string) (ahead, behind int, err error) {
+	out, err := exec.Command("git", "-C", barePath, "rev-list", "--left-right", "--count",
+		"refs/heads/"+branch+"..."+resolveBase(barePath, sourceBranch)).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("git rev-list %s...%s: %w", branch, sourceBranch, err)
+	}
+	if _, err := fmt.Sscan(string(out), &ahead, &behind); err != nil {
+		return 0, 0, fmt.Errorf("git rev-list: unexpected output %q", out)
+	}
+	return ahead, behind, nil
 }
 
 // worktreeBranches returns the set of branch names currently checked out in any worktree.
@@ -163,43 +242,108 @@ func worktreeBranches(barePath string) map[string]bool {
 	return branches
 }
 
-func getAuthURL(barePath, pat string) string {
-	cmd := exec.Command("git", "-C", barePath, "remote", "get-url", "origin")
-	out, err := cmd.Output()
-	if err != nil {
-		return ""
+// AddWorktree creates a new worktree with a new branch based off a source branch.
+// newBranch is the name of the branch to create, sourceBranch is the branch to base it on.
+// With sparse paths only those directories (and top-level files) are checked out.
+func AddWorktree(barePath, worktreePath, newBranch, sourceBranch string, sparse []string) error {
+	if err := os.MkdirAll(filepath.Dir(worktreePath), 0755); err != nil {
+		return fmt.Errorf("create worktree parent: %w", err)
 	}
-	url := strings.TrimSpace(string(out))
-	// Strip any existing credentials
-	url = strings.Replace(url, "x-access-token:"+pat+"@", "", 1)
-	// Re-add our token
-	if pat != "" {
-		url = strings.Replace(url, "https://", "https://x-access-token:"+pat+"@", 1)
+
+	base := resolveBase(barePath, sourceBranch)
+	args := []string{"-C", barePath, "worktree", "add"}
+	if len(sparse) > 0 {
+		args = append(args, "--no-checkout")
 	}
-	return url
+	cmd := exec.Command("git", append(args, "-b", newBranch, worktreePath, base)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git worktree add: %s: %w", string(out), err)
+	}
+	return sparseCheckout(worktreePath, sparse)
 }
 
-// AddWorktree creates a new worktree with a new branch based off a source branch.
-// newBranch is the name of the branch to create, sourceBranch is the branch to base it on.
-func AddWorktree(barePath, worktreePath, newBranch, sourceBranch string) error {
+// AddWorktreeForBranch checks out an existing branch in a new worktree,
+// creating the local branch from origin's if it only exists there. sparse
+// is as for AddWorktree.
+func AddWorktreeForBranch(barePath, worktreePath, branch string, sparse []string) error {
 	if err := os.MkdirAll(filepath.Dir(worktreePath), 0755); err != nil {
 		return fmt.Errorf("create worktree parent: %w", err)
 	}
 
-	// Prefer the remote-tracking ref so we always base off the latest fetched
-	// state, and fall back to the local branch ref.
-	base := sourceBranch
-	if err := exec.Command("git", "-C", barePath, "rev-parse", "--verify", "refs/remotes/origin/"+sourceBranch).Run(); err == nil {
-		base = "refs/remotes/origin/" + sourceBranch
+	args := []string{"-C", barePath, "worktree", "add"}
+	if len(sparse) > 0 {
+		args = append(args, "--no-checkout")
+	}
+	if err := exec.Command("git", "-C", barePath, "rev-parse", "--verify", "refs/heads/"+branch).Run(); err != nil {
+		args = append(args, "-b", branch, worktreePath, "refs/remotes/origin/"+branch)
+	} else {
+		args = append(args, worktreePath, branch)
 	}
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git worktree add: %s: %w", string(out), err)
+	}
+	return sparseCheckout(worktreePath, sparse)
+}
 
-	cmd := exec.Command("git", "-C", barePath, "worktree", "add", "-b", newBranch, worktreePath, base)
+// sparseCheckout limits a worktree added with --no-checkout to the given
+// directories (cone mode, so top-level files are included too) and checks
+// them out. Without paths the worktree is left as it is.
+func sparseCheckout(worktreePath string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	args := append([]string{"-C", worktreePath, "sparse-checkout", "set", "--"}, paths...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git sparse-checkout: %s: %w", string(out), err)
+	}
+	if out, err := exec.Command("git", "-C", worktreePath, "checkout").CombinedOutput(); err != nil {
+		return fmt.Errorf("git checkout: %s: %w", string(out), err)
+	}
+	return nil
+}
+
+// AddDetachedWorktree checks out branch at worktreePath without creating a
+// new branch. Used for throwaway checkouts such as workflow shell steps.
+func AddDetachedWorktree(barePath, worktreePath, branch string) error {
+	if err := os.MkdirAll(filepath.Dir(worktreePath), 0755); err != nil {
+		return fmt.Errorf("create worktree parent: %w", err)
+	}
+
+	base := resolveBase(barePath, branch)
+	cmd := exec.Command("git", "-C", barePath, "worktree", "add", "--detach", worktreePath, base)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("git worktree add: %s: %w", string(out), err)
 	}
 	return nil
 }
 
+// resolveBase prefers the remote-tracking ref for branch so we always base off
+// the latest fetched state, and falls back to the local branch ref.
+func resolveBase(barePath, branch string) string {
+	if err := exec.Command("git", "-C", barePath, "rev-parse", "--verify", "refs/remotes/origin/"+branch).Run(); err == nil {
+		return "refs/remotes/origin/" + branch
+	}
+	return branch
+}
+
+// PruneWorktrees removes the bare repo's records of worktrees whose
+// directories no longer exist.
+func PruneWorktrees(barePath string) error {
+	if out, err := exec.Command("git", "-C", barePath, "worktree", "prune").CombinedOutput(); err != nil {
+		return fmt.Errorf("git worktree prune: %s: %w", string(out), err)
+	}
+	return nil
+}
+
+// GC runs git gc in a repository, packing loose objects and pruning
+// unreachable ones past git's default expiry.
+func GC(repoPath string) error {
+	if out, err := exec.Command("git", "-C", repoPath, "gc", "--quiet").CombinedOutput(); err != nil {
+		return fmt.Errorf("git gc: %s: %w", string(out), err)
+	}
+	return nil
+}
+
 func RemoveWorktree(barePath, worktreePath string) error {
 	cmd := exec.Command("git", "-C", barePath, "worktree", "remove", "--force", worktreePath)
 	if out, err := cmd.CombinedOutput(); err != nil {
@@ -208,6 +352,83 @@ func RemoveWorktree(barePath, worktreePath string) error {
 	return nil
 }
 
+// BackupRefPrefix is the namespace BackupWorktree writes backup refs under.
+const BackupRefPrefix = "refs/superposition/backups/"
+
+// BackupWorktree commits everything in a worktree, including untracked (but
+// not ignored) files, on top of HEAD without touching the branch, index or
+// files, and points ref at the commit. It returns the commit ID.
+func BackupWorktree(worktreePath, ref, message string) (string, error) {
+	tree, err := SnapshotTree(worktreePath)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command("git", "-C", worktreePath, "commit-tree", tree, "-p", "HEAD", "-m", message)
+	cmd.Env = backupIdentityEnv()
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git commit-tree: %w", err)
+	}
+	commit := strings.TrimSpace(string(out))
+	if out, err := exec.Command("git", "-C", worktreePath, "update-ref", ref, commit).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git update-ref: %s: %w", string(out), err)
+	}
+	return commit, nil
+}
+
+// LatestBackup returns the newest backup ref under prefix (e.g.
+// BackupRefPrefix+sessionID+"/"), or "" if there is none.
+func LatestBackup(barePath, prefix string) string {
+	out, err := exec.Command("git", "-C", barePath, "for-each-ref", "--sort=-committerdate", "--count=1",
+		"--format=%(refname)", prefix).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// ApplyBackup re-applies the changes saved by BackupWorktree in ref to a
+// worktree's files, leaving them uncommitted. Paths matching an exclude
+// pattern are skipped.
+func ApplyBackup(worktreePath, ref string, exclude ...string) error {
+	diff, err := exec.Command("git", "-C", worktreePath, "diff", "--binary", ref+"^", ref).Output()
+	if err != nil {
+		return fmt.Errorf("git diff: %w", err)
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	args := []string{"-C", worktreePath, "apply"}
+	for _, pattern := range exclude {
+		args = append(args, "--exclude="+pattern)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(string(diff))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git apply: %s: %w", string(out), err)
+	}
+	return nil
+}
+
+// backupIdentityEnv sets the identity of backup commits, which are made
+// whether or not the repository has a user configured.
+func backupIdentityEnv() []string {
+	return append(os.Environ(),
+		"GIT_AUTHOR_NAME=superposition", "GIT_AUTHOR_EMAIL=superposition@localhost",
+		"GIT_COMMITTER_NAME=superposition", "GIT_COMMITTER_EMAIL=superposition@localhost")
+}
+
+// StashWorktree stashes every change in a worktree, including untracked
+// files. Worktrees share their repository's stash list.
+func StashWorktree(worktreePath, message string) error {
+	cmd := exec.Command("git", "-C", worktreePath, "stash", "push", "--include-untracked", "-m", message)
+	cmd.Env = backupIdentityEnv()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git stash: %s: %w", string(out), err)
+	}
+	return nil
+}
+
 func RemoveBranch(barePath, branch string) error {
 	cmd := exec.Command("git", "-C", barePath, "branch", "-D", branch)
 	if out, err := cmd.CombinedOutput(); err != nil {
@@ -231,3 +452,91 @@ func ListBranches(barePath string) ([]string, error) {
 	}
 	return branches, nil
 }
+
+// NewestBranch returns the most recently committed-to branch matching the
+// glob pattern, or "" if none match.
+func NewestBranch(barePath, pattern string) (string, error) {
+	cmd := exec.Command("git", "-C", barePath, "for-each-ref", "--sort=-committerdate", "--count=1",
+		"--format=%(refname:short)", "refs/heads/"+pattern)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git for-each-ref: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// CommitAll stages every change in a worktree and commits it with message.
+// It reports false without committing when the worktree is clean.
+func CommitAll(worktreePath, message string) (bool, error) {
+	return CommitChanges(worktreePath, message, true)
+}
+
+// CommitChanges commits a worktree's staged changes with message, first staging
+// every change when all is set. It reports false without committing when
+// there is nothing staged.
+func CommitChanges(worktreePath, message string, all bool) (bool, error) {
+	if all {
+		if out, err := exec.Command("git", "-C", worktreePath, "add", "-A").CombinedOutput(); err != nil {
+			return false, fmt.Errorf("git add: %s: %w", string(out), err)
+		}
+	}
+
+	// Nothing staged means nothing to commit; git commit would exit non-zero.
+	if err := exec.Command("git", "-C", worktreePath, "diff", "--cached", "--quiet").Run(); err == nil {
+		return false, nil
+	}
+
+	cmd := exec.Command("git", "-C", worktreePath, "commit", "-m", message)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return false, fmt.Errorf("git commit: %s: %w", string(out), err)
+	}
+	return true, nil
+}
+
+// Push pushes a worktree's branch to origin, authenticating with auth, and
+// updates the remote-tracking ref to match. force uses --force-with-lease so
+// it won't overwrite commits it hasn't seen.
+func Push(worktreePath, branch string, auth Auth, force bool) error {
+	args := []string{"-C", worktreePath, "push"}
+	if force {
+		args = append(args, "--force-with-lease=refs/heads/"+branch+":refs/remotes/origin/"+branch)
+	}
+	args = append(args, "origin", "refs/heads/"+branch+":refs/heads/"+branch)
+	cmd := auth.command(args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git push: %s: %w", string(out), err)
+	}
+
+	// Local repos fetch straight into refs/heads, so the push doesn't update
+	// refs/remotes/origin; do it here to keep ahead/behind accurate.
+	exec.Command("git", "-C", worktreePath, "update-ref", "refs/remotes/origin/"+branch, "refs/heads/"+branch).Run()
+	return nil
+}
+
+// ListFiles returns the paths of all files under dir on branch, read directly
+// from the bare repository without a checkout.
+func ListFiles(barePath, branch, dir string) ([]string, error) {
+	cmd := exec.Command("git", "-C", barePath, "ls-tree", "-r", "--name-only", resolveBase(barePath, branch), "--", dir)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-tree: %w", err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// ReadFile returns the contents of path on branch.
+func ReadFile(barePath, branch, path string) ([]byte, error) {
+	cmd := exec.Command("git", "-C", barePath, "cat-file", "blob", resolveBase(barePath, branch)+":"+path)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file %s: %w", path, err)
+	}
+	return out, nil
+}
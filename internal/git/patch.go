@@ -0,0 +1,232 @@
+package git
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FileDiff is one file's section of a unified diff.
+type FileDiff struct {
+	FileStat
+	OldMode string `json:"old_mode,omitempty"`
+	NewMode string `json:"new_mode,omitempty"`
+	Hunks   []Hunk `json:"hunks"`
+}
+
+// Hunk is one @@ section of a file diff.
+type Hunk struct {
+	Header   string     `json:"header"`
+	OldStart int        `json:"old_start"`
+	OldLines int        `json:"old_lines"`
+	NewStart int        `json:"new_start"`
+	NewLines int        `json:"new_lines"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// DiffLine is a single line of a hunk. OldLine and NewLine are 0 when the
+// line doesn't exist on that side.
+type DiffLine struct {
+	Type    string `json:"type"` // context, add, delete
+	Content string `json:"content"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+	// NoNewline marks a line lacking a trailing newline at end of file.
+	NoNewline bool `json:"no_newline,omitempty"`
+}
+
+// ParsePatch parses `git diff` output into per-file, per-hunk structures.
+func ParsePatch(patch string) []FileDiff {
+	files := []FileDiff{}
+	var file *FileDiff
+	var hunk *Hunk
+	oldLine, newLine := 0, 0
+
+	flush := func() {
+		if file != nil {
+			if file.Status == "" {
+				file.Status = "modified"
+			}
+			if file.Hunks == nil {
+				file.Hunks = []Hunk{}
+			}
+			files = append(files, *file)
+		}
+		file, hunk = nil, nil
+	}
+
+	lines := strings.Split(patch, "\n")
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "diff --git ") {
+			flush()
+			oldPath, newPath := parseDiffGitLine(strings.TrimPrefix(line, "diff --git "))
+			file = &FileDiff{FileStat: FileStat{Path: newPath}}
+			if oldPath != newPath {
+				file.OldPath = oldPath
+			}
+			continue
+		}
+		if file == nil {
+			continue
+		}
+
+		if hunk != nil {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				hunk.Lines = append(hunk.Lines, DiffLine{Type: "add", Content: line[1:], NewLine: newLine})
+				newLine++
+				file.Additions++
+				continue
+			case strings.HasPrefix(line, "-"):
+				hunk.Lines = append(hunk.Lines, DiffLine{Type: "delete", Content: line[1:], OldLine: oldLine})
+				oldLine++
+				file.Deletions++
+				continue
+			case strings.HasPrefix(line, " ") || line == "":
+				content := ""
+				if line != "" {
+					content = line[1:]
+				}
+				hunk.Lines = append(hunk.Lines, DiffLine{Type: "context", Content: content, OldLine: oldLine, NewLine: newLine})
+				oldLine++
+				newLine++
+				continue
+			case strings.HasPrefix(line, `\`):
+				if n := len(hunk.Lines); n > 0 {
+					hunk.Lines[n-1].NoNewline = true
+				}
+				continue
+			}
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@@ "):
+			h, ok := parseHunkHeader(line)
+			if !ok {
+				continue
+			}
+			file.Hunks = append(file.Hunks, h)
+			hunk = &file.Hunks[len(file.Hunks)-1]
+			oldLine, newLine = h.OldStart, h.NewStart
+		case strings.HasPrefix(line, "new file mode "):
+			file.Status = "added"
+			file.NewMode = strings.TrimPrefix(line, "new file mode ")
+		case strings.HasPrefix(line, "deleted file mode "):
+			file.Status = "deleted"
+			file.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+		case strings.HasPrefix(line, "old mode "):
+			file.OldMode = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			file.NewMode = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "rename from "):
+			file.Status = "renamed"
+			file.OldPath = unquotePath(strings.TrimPrefix(line, "rename from "))
+		case strings.HasPrefix(line, "rename to "):
+			file.Path = unquotePath(strings.TrimPrefix(line, "rename to "))
+		case strings.HasPrefix(line, "copy from "):
+			file.Status = "copied"
+			file.OldPath = unquotePath(strings.TrimPrefix(line, "copy from "))
+		case strings.HasPrefix(line, "copy to "):
+			file.Path = unquotePath(strings.TrimPrefix(line, "copy to "))
+		case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+			file.Binary = true
+		// Paths containing spaces are followed by a tab on ---/+++ lines.
+		case strings.HasPrefix(line, "--- "):
+			if p := strings.TrimSuffix(strings.TrimPrefix(line, "--- "), "\t"); p != "/dev/null" {
+				file.OldPath = strings.TrimPrefix(unquotePath(p), "a/")
+			}
+		case strings.HasPrefix(line, "+++ "):
+			if p := strings.TrimSuffix(strings.TrimPrefix(line, "+++ "), "\t"); p != "/dev/null" {
+				file.Path = strings.TrimPrefix(unquotePath(p), "b/")
+			}
+		}
+	}
+	flush()
+
+	for i := range files {
+		if files[i].OldPath == files[i].Path || files[i].Status == "added" {
+			files[i].OldPath = ""
+		}
+		if files[i].Status == "deleted" && files[i].OldPath != "" {
+			files[i].Path = files[i].OldPath
+			files[i].OldPath = ""
+		}
+	}
+	return files
+}
+
+// parseDiffGitLine extracts the old and new paths from the rest of a
+// "diff --git a/x b/y" line.
+func parseDiffGitLine(s string) (string, string) {
+	if strings.HasPrefix(s, `"`) {
+		// Quoted paths: "a/x" "b/y", either of which may be quoted.
+		if end := closingQuote(s); end > 0 {
+			oldPath := unquotePath(s[:end+1])
+			newPath := unquotePath(strings.TrimSpace(s[end+1:]))
+			return strings.TrimPrefix(oldPath, "a/"), strings.TrimPrefix(newPath, "b/")
+		}
+	}
+	// Unrenamed files repeat the same path, so split in the middle.
+	if len(s)%2 == 1 {
+		half := (len(s) - 1) / 2
+		if s[half] == ' ' && strings.HasPrefix(s, "a/") && s[half+1:half+3] == "b/" && s[2:half] == s[half+3:] {
+			return s[2:half], s[half+3:]
+		}
+	}
+	if i := strings.LastIndex(s, " b/"); i >= 0 {
+		return strings.TrimPrefix(s[:i], "a/"), unquotePath(s[i+3:])
+	}
+	return s, s
+}
+
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// unquotePath undoes git's C-style quoting of unusual paths.
+func unquotePath(p string) string {
+	if len(p) >= 2 && p[0] == '"' && p[len(p)-1] == '"' {
+		if u, err := strconv.Unquote(p); err == nil {
+			return u
+		}
+	}
+	return p
+}
+
+// parseHunkHeader parses "@@ -a,b +c,d @@ section".
+func parseHunkHeader(line string) (Hunk, bool) {
+	h := Hunk{Lines: []DiffLine{}}
+	rest := strings.TrimPrefix(line, "@@ ")
+	end := strings.Index(rest, " @@")
+	if end < 0 {
+		return h, false
+	}
+	ranges := strings.Fields(rest[:end])
+	if len(ranges) != 2 || !strings.HasPrefix(ranges[0], "-") || !strings.HasPrefix(ranges[1], "+") {
+		return h, false
+	}
+	h.OldStart, h.OldLines = parseRange(ranges[0][1:])
+	h.NewStart, h.NewLines = parseRange(ranges[1][1:])
+	h.Header = strings.TrimSpace(rest[end+3:])
+	return h, true
+}
+
+func parseRange(r string) (int, int) {
+	start, count, found := strings.Cut(r, ",")
+	s, _ := strconv.Atoi(start)
+	if !found {
+		return s, 1
+	}
+	c, _ := strconv.Atoi(count)
+	return s, c
+}
@@ -0,0 +1,138 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Conflict is a path a rebase or merge couldn't resolve. Status is one of
+// "both_modified", "both_added", "both_deleted", "added_by_us",
+// "added_by_them", "deleted_by_us" or "deleted_by_them".
+type Conflict struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+// ConflictError is returned when a rebase or merge stops on conflicts.
+// Commit is the commit that failed to apply during a rebase. Aborted
+// reports whether the operation was rolled back; otherwise it is still in
+// progress in the worktree.
+type ConflictError struct {
+	Op        string     `json:"op"`
+	Commit    string     `json:"commit,omitempty"`
+	Conflicts []Conflict `json:"conflicts"`
+	Aborted   bool       `json:"aborted"`
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s stopped on conflicts in %d files", e.Op, len(e.Conflicts))
+}
+
+var conflictStatuses = map[string]string{
+	"UU": "both_modified",
+	"AA": "both_added",
+	"DD": "both_deleted",
+	"AU": "added_by_us",
+	"UA": "added_by_them",
+	"DU": "deleted_by_us",
+	"UD": "deleted_by_them",
+}
+
+// Conflicts lists the unmerged paths of a worktree.
+func Conflicts(worktreePath string) ([]Conflict, error) {
+	out, err := exec.Command("git", "-C", worktreePath, "status", "--porcelain=v2", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status: %w", err)
+	}
+	conflicts := []Conflict{}
+	for _, f := range strings.Split(string(out), "\x00") {
+		// u XY sub m1 m2 m3 mW h1 h2 h3 path
+		if parts := strings.SplitN(f, " ", 11); len(parts) == 11 && parts[0] == "u" {
+			conflicts = append(conflicts, Conflict{Path: parts[10], Status: conflictStatuses[parts[1]]})
+		}
+	}
+	return conflicts, nil
+}
+
+// OperationInProgress returns "rebase" or "merge" if one was left stopped
+// in a worktree, or "".
+func OperationInProgress(worktreePath string) string {
+	gitPath := func(name string) string {
+		out, _ := exec.Command("git", "-C", worktreePath, "rev-parse", "--path-format=absolute", "--git-path", name).Output()
+		return strings.TrimSpace(string(out))
+	}
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		if _, err := os.Stat(gitPath(dir)); err == nil {
+			return "rebase"
+		}
+	}
+	if _, err := os.Stat(gitPath("MERGE_HEAD")); err == nil {
+		return "merge"
+	}
+	return ""
+}
+
+// Rebase rebases a worktree's branch onto onto. When it stops on conflicts
+// it returns a *ConflictError, aborting the rebase first if abort is set.
+func Rebase(worktreePath, onto string, abort bool) error {
+	out, err := exec.Command("git", "-C", worktreePath, "rebase", onto).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if OperationInProgress(worktreePath) != "rebase" {
+		return fmt.Errorf("git rebase: %s: %w", string(out), err)
+	}
+	cerr := &ConflictError{Op: "rebase"}
+	if head, err := RevParse(worktreePath, "REBASE_HEAD"); err == nil {
+		cerr.Commit = head
+	}
+	if cerr.Conflicts, err = Conflicts(worktreePath); err != nil || len(cerr.Conflicts) == 0 {
+		// Stopped for another reason, such as a missing committer identity.
+		exec.Command("git", "-C", worktreePath, "rebase", "--abort").Run()
+		return fmt.Errorf("git rebase: %s", string(out))
+	}
+	if abort {
+		if out, err := exec.Command("git", "-C", worktreePath, "rebase", "--abort").CombinedOutput(); err != nil {
+			return fmt.Errorf("git rebase --abort: %s: %w", string(out), err)
+		}
+		cerr.Aborted = true
+	}
+	return cerr
+}
+
+// Merge merges rev into a worktree's branch with message, creating a merge
+// commit unless it can fast-forward. Conflicts are handled as by Rebase.
+func Merge(worktreePath, rev, message string, abort bool) error {
+	out, err := exec.Command("git", "-C", worktreePath, "merge", "--no-edit", "-m", message, rev).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if OperationInProgress(worktreePath) != "merge" {
+		return fmt.Errorf("git merge: %s: %w", string(out), err)
+	}
+	cerr := &ConflictError{Op: "merge"}
+	if cerr.Conflicts, err = Conflicts(worktreePath); err != nil || len(cerr.Conflicts) == 0 {
+		exec.Command("git", "-C", worktreePath, "merge", "--abort").Run()
+		return fmt.Errorf("git merge: %s", string(out))
+	}
+	if abort {
+		if out, err := exec.Command("git", "-C", worktreePath, "merge", "--abort").CombinedOutput(); err != nil {
+			return fmt.Errorf("git merge --abort: %s: %w", string(out), err)
+		}
+		cerr.Aborted = true
+	}
+	return cerr
+}
+
+// IsAncestor reports whether commit is an ancestor of (or equal to) rev.
+func IsAncestor(repoPath, commit, rev string) bool {
+	return exec.Command("git", "-C", repoPath, "merge-base", "--is-ancestor", commit, rev).Run() == nil
+}
+
+// SourceRef returns the ref sessions of a bare repo base their branches on
+// for sourceBranch: origin's copy when there is one.
+func SourceRef(barePath, sourceBranch string) string {
+	return resolveBase(barePath, sourceBranch)
+}
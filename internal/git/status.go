@@ -0,0 +1,94 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// StatusResult is the state of a worktree as reported by git status.
+type StatusResult struct {
+	Branch   string       `json:"branch"`
+	Head     string       `json:"head"`
+	Upstream string       `json:"upstream,omitempty"`
+	Ahead    int          `json:"ahead"`
+	Behind   int          `json:"behind"`
+	Clean    bool         `json:"clean"`
+	Files    []StatusFile `json:"files"`
+}
+
+// StatusFile is one changed path. Staged and Unstaged hold the change in the
+// index and in the working tree ("modified", "added", "deleted", "renamed",
+// "copied", "type_changed", "unmerged", "untracked" or "" for none).
+type StatusFile struct {
+	Path     string `json:"path"`
+	OldPath  string `json:"old_path,omitempty"`
+	Staged   string `json:"staged"`
+	Unstaged string `json:"unstaged"`
+}
+
+// Status returns the branch and changed files of a worktree.
+func Status(worktreePath string) (StatusResult, error) {
+	res := StatusResult{Files: []StatusFile{}}
+	out, err := exec.Command("git", "-C", worktreePath, "status", "--porcelain=v2", "--branch", "-z").Output()
+	if err != nil {
+		return res, fmt.Errorf("git status: %w", err)
+	}
+
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case strings.HasPrefix(f, "# branch.oid "):
+			res.Head = strings.TrimPrefix(f, "# branch.oid ")
+		case strings.HasPrefix(f, "# branch.head "):
+			res.Branch = strings.TrimPrefix(f, "# branch.head ")
+		case strings.HasPrefix(f, "# branch.upstream "):
+			res.Upstream = strings.TrimPrefix(f, "# branch.upstream ")
+		case strings.HasPrefix(f, "# branch.ab "):
+			parts := strings.Fields(strings.TrimPrefix(f, "# branch.ab "))
+			if len(parts) == 2 {
+				res.Ahead, _ = strconv.Atoi(strings.TrimPrefix(parts[0], "+"))
+				res.Behind, _ = strconv.Atoi(strings.TrimPrefix(parts[1], "-"))
+			}
+		case strings.HasPrefix(f, "1 "):
+			// 1 XY sub mH mI mW hH hI path
+			parts := strings.SplitN(f, " ", 9)
+			if len(parts) == 9 {
+				res.Files = append(res.Files, statusFile(parts[1], parts[8], ""))
+			}
+		case strings.HasPrefix(f, "2 "):
+			// 2 XY sub mH mI mW hH hI Xscore path, followed by the original path
+			parts := strings.SplitN(f, " ", 10)
+			if len(parts) == 10 && i+1 < len(fields) {
+				res.Files = append(res.Files, statusFile(parts[1], parts[9], fields[i+1]))
+				i++
+			}
+		case strings.HasPrefix(f, "u "):
+			// u XY sub m1 m2 m3 mW h1 h2 h3 path
+			parts := strings.SplitN(f, " ", 11)
+			if len(parts) == 11 {
+				res.Files = append(res.Files, StatusFile{Path: parts[10], Staged: "unmerged", Unstaged: "unmerged"})
+			}
+		case strings.HasPrefix(f, "? "):
+			res.Files = append(res.Files, StatusFile{Path: strings.TrimPrefix(f, "? "), Unstaged: "untracked"})
+		}
+	}
+	res.Clean = len(res.Files) == 0
+	return res, nil
+}
+
+func statusFile(xy, path, oldPath string) StatusFile {
+	return StatusFile{Path: path, OldPath: oldPath, Staged: statusCode(xy[0]), Unstaged: statusCode(xy[1])}
+}
+
+func statusCode(c byte) string {
+	if c == '.' {
+		return ""
+	}
+	if c == 'M' {
+		return "modified"
+	}
+	return statusName(c)
+}
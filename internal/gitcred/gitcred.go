@@ -0,0 +1,68 @@
+// Package gitcred implements "superposition git-credential", the git
+// credential helper configured in every bare repository. It looks up the
+// token for a remote in the database when git asks for it, so tokens never
+// appear in remote URLs, .git/config or process listings.
+package gitcred
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/peterje/superposition/internal/api"
+	"github.com/peterje/superposition/internal/db"
+	gitops "github.com/peterje/superposition/internal/git"
+)
+
+// Run handles one credential helper invocation. args[0] is the operation
+// git requests: "get" is answered from the database, "store" and "erase"
+// are ignored since credentials are managed through superposition.
+func Run(args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: superposition git-credential get|store|erase")
+	}
+	attrs := readAttributes(in)
+	if args[0] != "get" {
+		return nil
+	}
+	// Only answer git commands run by superposition itself; see
+	// gitops.CredentialsEnv.
+	if !gitops.ValidCredentialsNonce(os.Getenv(gitops.CredentialsEnv)) {
+		return nil
+	}
+	if attrs["protocol"] != "https" && attrs["protocol"] != "http" {
+		return nil
+	}
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	username, token, ok := api.GitCredential(database, attrs["host"], attrs["path"])
+	if !ok {
+		return nil
+	}
+	fmt.Fprintf(out, "username=%s\npassword=%s\n", username, token)
+	return nil
+}
+
+// readAttributes parses the key=value lines git writes to the helper,
+// terminated by a blank line or EOF.
+func readAttributes(in io.Reader) map[string]string {
+	attrs := map[string]string{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,64 @@
+package github
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// CheckRun is one CI check on a commit.
+type CheckRun struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`     // queued, in_progress, completed
+	Conclusion string `json:"conclusion"` // success, failure, neutral, cancelled, skipped, timed_out, action_required
+	HTMLURL    string `json:"html_url"`
+}
+
+// CheckStatus summarises the check runs on a commit. State is "failure" if
+// any completed run failed, "pending" while any run is incomplete, "success"
+// otherwise, and "none" when there are no runs.
+type CheckStatus struct {
+	Ref   string     `json:"ref"`
+	State string     `json:"state"`
+	Runs  []CheckRun `json:"runs"`
+}
+
+// GetCheckStatus returns the check runs for ref (a commit SHA, branch or tag).
+func (c *Client) GetCheckStatus(owner, repo, ref string) (CheckStatus, error) {
+	status := CheckStatus{Ref: ref, Runs: []CheckRun{}}
+	err := c.getAll(repoPath(owner, repo)+"/commits/"+url.PathEscape(ref)+"/check-runs?per_page=100", func(page []byte) error {
+		var resp struct {
+			CheckRuns []CheckRun `json:"check_runs"`
+		}
+		if err := json.Unmarshal(page, &resp); err != nil {
+			return err
+		}
+		status.Runs = append(status.Runs, resp.CheckRuns...)
+		return nil
+	})
+	if err != nil {
+		return status, err
+	}
+	status.State = checkState(status.Runs)
+	return status, nil
+}
+
+func checkState(runs []CheckRun) string {
+	if len(runs) == 0 {
+		return "none"
+	}
+	pending := false
+	for _, r := range runs {
+		if r.Status != "completed" {
+			pending = true
+			continue
+		}
+		switch r.Conclusion {
+		case "failure", "cancelled", "timed_out", "action_required":
+			return "failure"
+		}
+	}
+	if pending {
+		return "pending"
+	}
+	return "success"
+}
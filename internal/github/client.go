@@ -1,132 +1,313 @@
 package github
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-type Repo struct {
-	FullName      string `json:"full_name"`
-	HTMLURL       string `json:"html_url"`
-	CloneURL      string `json:"clone_url"`
-	Owner         string `json:"owner_login"`
-	Name          string `json:"name"`
-	Private       bool   `json:"private"`
-	DefaultBranch string `json:"default_branch"`
-	Description   string `json:"description"`
-}
-
-type ghRepo struct {
-	FullName      string `json:"full_name"`
-	HTMLURL       string `json:"html_url"`
-	CloneURL      string `json:"clone_url"`
-	Private       bool   `json:"private"`
-	DefaultBranch string `json:"default_branch"`
-	Description   string `json:"description"`
-	Owner         struct {
-		Login string `json:"login"`
-	} `json:"owner"`
-	Name string `json:"name"`
-}
-
-type ghOrg struct {
-	Login string `json:"login"`
-}
-
-func convertRepos(ghRepos []ghRepo) []Repo {
-	repos := make([]Repo, 0, len(ghRepos))
-	for _, r := range ghRepos {
-		repos = append(repos, Repo{
-			FullName:      r.FullName,
-			HTMLURL:       r.HTMLURL,
-			CloneURL:      r.CloneURL,
-			Owner:         r.Owner.Login,
-			Name:          r.Name,
-			Private:       r.Private,
-			DefaultBranch: r.DefaultBranch,
-			Description:   r.Description,
-		})
-	}
-	return repos
-}
-
-func ghRequest(pat, url string, target interface{}) error {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
+// DefaultBaseURL is the public GitHub REST API.
+const DefaultBaseURL = "https://api.github.com"
+
+const (
+	// maxRateLimitWait is the longest a request waits for a rate limit to
+	// reset before giving up with a RateLimitError.
+	maxRateLimitWait = time.Minute
+	maxCacheEntries  = 512
+)
+
+// Client talks to the GitHub REST API with a personal access token. GET
+// responses are cached by ETag so repeated polling is served by 304s, which
+// don't count against the rate limit.
+type Client struct {
+	baseURL string
+	pat     string
+	http    *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedResponse
+	rate  RateLimit
+}
+
+type cachedResponse struct {
+	etag string
+	body []byte
+	link string
+}
+
+// RateLimit is the most recently reported API rate limit.
+type RateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// RateLimitError is returned when the rate limit is exhausted and won't
+// reset soon enough to wait for.
+type RateLimitError struct {
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("github API rate limit exceeded until %s", e.Reset.Format(time.RFC3339))
+}
+
+// APIError is a non-2xx response from the API.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("github API error %d: %s", e.StatusCode, e.Message)
 	}
-	req.Header.Set("Authorization", "Bearer "+pat)
-	req.Header.Set("Accept", "application/vnd.github+json")
+	return fmt.Sprintf("github API error %d: %s", e.StatusCode, e.Body)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("github API request: %w", err)
+// IsNotFound reports whether err is a 404 from the API.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// NewClient returns a client for the API at baseURL (DefaultBaseURL if
+// empty), authenticating with pat.
+func NewClient(baseURL, pat string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		pat:     pat,
+		http:    &http.Client{Timeout: 30 * time.Second},
+		cache:   map[string]cachedResponse{},
 	}
-	defer resp.Body.Close()
+}
+
+// BaseURL returns the API base URL the client talks to.
+func (c *Client) BaseURL() string { return c.baseURL }
+
+// RateLimit returns the rate limit reported by the last response.
+func (c *Client) RateLimit() RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rate
+}
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("github API error %d: %s", resp.StatusCode, string(body))
+// url resolves path against the base URL. Absolute URLs, which come from
+// Link headers, must have the base URL's scheme and host so that the token
+// is never sent anywhere else.
+func (c *Client) url(path string) (string, error) {
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		return c.baseURL + path, nil
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("github API link %q: %w", path, err)
+	}
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", fmt.Errorf("github API base URL: %w", err)
 	}
+	if u.Scheme != base.Scheme || !strings.EqualFold(u.Host, base.Host) {
+		return "", fmt.Errorf("github API link %q is not on %s", path, c.baseURL)
+	}
+	return path, nil
+}
 
-	return json.NewDecoder(resp.Body).Decode(target)
+// get fetches path and decodes the JSON response into target.
+func (c *Client) get(path string, target any) error {
+	_, err := c.do("GET", path, nil, target)
+	return err
 }
 
-// paginateRepos fetches all pages from a paginated GitHub repos endpoint.
-func paginateRepos(pat, baseURL string) ([]Repo, error) {
-	var all []ghRepo
-	page := 1
-	for {
-		url := fmt.Sprintf("%s&page=%d", baseURL, page)
-		var repos []ghRepo
-		if err := ghRequest(pat, url, &repos); err != nil {
-			return nil, err
+// getAll follows Link: rel="next" pagination from path, passing each page's
+// body to add.
+func (c *Client) getAll(path string, add func(page []byte) error) error {
+	next := path
+	for next != "" {
+		var page json.RawMessage
+		link, err := c.do("GET", next, nil, &page)
+		if err != nil {
+			return err
 		}
-		all = append(all, repos...)
-		if len(repos) < 100 {
-			break
+		if err := add(page); err != nil {
+			return err
 		}
-		page++
+		next = nextLink(link)
 	}
-	return convertRepos(all), nil
+	return nil
 }
 
-// ListAllRepos returns all repos the user has access to: their own repos
-// plus repos from all orgs they belong to, fully paginated and deduplicated.
-func ListAllRepos(pat string) ([]Repo, error) {
-	// Fetch all user repos (owned, collaborator, org member)
-	allRepos, err := paginateRepos(pat, "https://api.github.com/user/repos?per_page=100&sort=updated&type=all")
+// do sends a request and decodes the response into target when non-nil. It
+// returns the response's Link header for pagination.
+func (c *Client) do(method, path string, body, target any) (string, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return "", err
+		}
+	}
+	reqURL, err := c.url(path)
 	if err != nil {
-		return nil, fmt.Errorf("listing user repos: %w", err)
+		return "", err
 	}
 
-	// Fetch user's orgs
-	var orgs []ghOrg
-	if err := ghRequest(pat, "https://api.github.com/user/orgs?per_page=100", &orgs); err != nil {
-		// Non-fatal: we still have user repos
-		return allRepos, nil
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, reqURL, bytes.NewReader(payload))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.pat)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		var cached cachedResponse
+		var haveCached bool
+		if method == "GET" {
+			c.mu.Lock()
+			cached, haveCached = c.cache[reqURL]
+			c.mu.Unlock()
+			if haveCached {
+				req.Header.Set("If-None-Match", cached.etag)
+			}
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("github API request: %w", err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("github API response: %w", err)
+		}
+		c.recordRateLimit(resp.Header)
+
+		switch {
+		case resp.StatusCode == http.StatusNotModified && haveCached:
+			return cached.link, decode(cached.body, target)
+		case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+			if method == "GET" {
+				c.store(reqURL, resp.Header, data)
+			}
+			return resp.Header.Get("Link"), decode(data, target)
+		}
+
+		if wait, limited := rateLimitWait(resp); limited {
+			if attempt == 0 && wait <= maxRateLimitWait {
+				time.Sleep(wait)
+				continue
+			}
+			return "", &RateLimitError{Reset: time.Now().Add(wait)}
+		}
+		return "", newAPIError(resp.StatusCode, data)
 	}
+}
 
-	// Fetch repos for each org
-	seen := make(map[string]bool, len(allRepos))
-	for _, r := range allRepos {
-		seen[r.FullName] = true
+func decode(data []byte, target any) error {
+	if target == nil || len(data) == 0 {
+		return nil
+	}
+	if raw, ok := target.(*json.RawMessage); ok {
+		*raw = append((*raw)[:0], data...)
+		return nil
 	}
+	return json.Unmarshal(data, target)
+}
 
-	for _, org := range orgs {
-		orgRepos, err := paginateRepos(pat, fmt.Sprintf("https://api.github.com/orgs/%s/repos?per_page=100&sort=updated", org.Login))
-		if err != nil {
-			continue // skip orgs that fail (permissions, etc.)
+func newAPIError(status int, body []byte) *APIError {
+	var msg struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	json.Unmarshal(body, &msg)
+	text := msg.Message
+	for _, e := range msg.Errors {
+		if e.Message != "" {
+			text += ": " + e.Message
+		}
+	}
+	return &APIError{StatusCode: status, Message: text, Body: string(body)}
+}
+
+func (c *Client) store(reqURL string, header http.Header, body []byte) {
+	etag := header.Get("ETag")
+	if etag == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= maxCacheEntries {
+		c.cache = map[string]cachedResponse{}
+	}
+	c.cache[reqURL] = cachedResponse{etag: etag, body: body, link: header.Get("Link")}
+}
+
+func (c *Client) recordRateLimit(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	c.mu.Lock()
+	c.rate = RateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+	c.mu.Unlock()
+}
+
+// rateLimitWait reports whether resp is a primary or secondary rate limit
+// response and how long to wait before retrying.
+func rateLimitWait(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			return time.Duration(secs) * time.Second, true
 		}
-		for _, r := range orgRepos {
-			if !seen[r.FullName] {
-				seen[r.FullName] = true
-				allRepos = append(allRepos, r)
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err == nil {
+			return max(time.Until(time.Unix(reset, 0)), 0) + time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// nextLink returns the rel="next" URL of a Link header, or "".
+func nextLink(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segs := strings.Split(part, ";")
+		if len(segs) < 2 {
+			continue
+		}
+		for _, s := range segs[1:] {
+			if strings.TrimSpace(s) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(segs[0]), "<>")
 			}
 		}
 	}
+	return ""
+}
 
-	return allRepos, nil
+func repoPath(owner, repo string) string {
+	return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
 }
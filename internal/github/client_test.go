@@ -0,0 +1,191 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientETagCache(t *testing.T) {
+	var requests, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"name":"repo"}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "token")
+	for i := 0; i < 3; i++ {
+		var got struct{ Name string }
+		if err := c.get("/repos/o/repo", &got); err != nil {
+			t.Fatalf("get %d: %v", i, err)
+		}
+		if got.Name != "repo" {
+			t.Fatalf("get %d: name = %q, want repo", i, got.Name)
+		}
+	}
+	if requests.Load() != 3 || notModified.Load() != 2 {
+		t.Errorf("requests = %d, 304s = %d; want 3 and 2", requests.Load(), notModified.Load())
+	}
+}
+
+func TestClientRateLimitWait(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "token")
+	start := time.Now()
+	if err := c.get("/rate", nil); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("requests = %d, want 2", requests.Load())
+	}
+	if waited := time.Since(start); waited < 500*time.Millisecond {
+		t.Errorf("retried after %s, want a wait for the reset", waited)
+	}
+	if rl := c.RateLimit(); rl.Remaining != 4999 || rl.Limit != 5000 {
+		t.Errorf("RateLimit() = %+v", rl)
+	}
+}
+
+func TestClientRateLimitError(t *testing.T) {
+	var requests atomic.Int32
+	reset := time.Now().Add(time.Hour).Unix()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	err := NewClient(srv.URL, "token").get("/rate", nil)
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) {
+		t.Fatalf("err = %v, want a RateLimitError", err)
+	}
+	if rlErr.Reset.Before(time.Unix(reset, 0)) {
+		t.Errorf("Reset = %s, want at least %s", rlErr.Reset, time.Unix(reset, 0))
+	}
+	if requests.Load() != 1 {
+		t.Errorf("requests = %d, want 1", requests.Load())
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"Not Found"}`)
+	}))
+	defer srv.Close()
+
+	err := NewClient(srv.URL, "token").get("/repos/o/missing", nil)
+	if !IsNotFound(err) {
+		t.Fatalf("err = %v, want a 404 APIError", err)
+	}
+}
+
+func TestClientPagination(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page < 3 {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/items?page=%d>; rel="next", <%s/items?page=3>; rel="last"`, srv.URL, page+1, srv.URL))
+		}
+		fmt.Fprintf(w, `[%d, %d]`, page*10, page*10+1)
+	}))
+	defer srv.Close()
+
+	var all []int
+	err := NewClient(srv.URL, "token").getAll("/items", func(page []byte) error {
+		var items []int
+		if err := json.Unmarshal(page, &items); err != nil {
+			return err
+		}
+		all = append(all, items...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("getAll: %v", err)
+	}
+	want := []int{10, 11, 20, 21, 30, 31}
+	if fmt.Sprint(all) != fmt.Sprint(want) {
+		t.Errorf("items = %v, want %v", all, want)
+	}
+}
+
+func TestClientPaginationOtherHost(t *testing.T) {
+	var leaked atomic.Int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			leaked.Add(1)
+		}
+		fmt.Fprint(w, `[3]`)
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s/items?page=2>; rel="next"`, other.URL))
+		fmt.Fprint(w, `[1, 2]`)
+	}))
+	defer srv.Close()
+
+	pages := 0
+	err := NewClient(srv.URL, "token").getAll("/items", func(page []byte) error {
+		pages++
+		return nil
+	})
+	if err == nil {
+		t.Error("getAll followed a next link to another host")
+	}
+	if pages != 1 {
+		t.Errorf("pages = %d, want 1", pages)
+	}
+	if leaked.Load() != 0 {
+		t.Error("the other host received the token")
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct{ link, want string }{
+		{"", ""},
+		{`<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`, "https://api.github.com/x?page=2"},
+		{`<https://api.github.com/x?page=1>; rel="prev"`, ""},
+	}
+	for _, tt := range tests {
+		if got := nextLink(tt.link); got != tt.want {
+			t.Errorf("nextLink(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Issue is a GitHub issue. Pull requests are issues too; IsPullRequest is
+// set for them.
+type Issue struct {
+	Number        int       `json:"number"`
+	HTMLURL       string    `json:"html_url"`
+	State         string    `json:"state"`
+	Title         string    `json:"title"`
+	Body          string    `json:"body"`
+	User          string    `json:"user"`
+	Labels        []string  `json:"labels"`
+	Comments      int       `json:"comments"`
+	IsPullRequest bool      `json:"is_pull_request"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type ghIssue struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	User    ghUser `json:"user"`
+	Labels  []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Comments    int       `json:"comments"`
+	PullRequest *struct{} `json:"pull_request"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Comment is a comment on an issue or pull request conversation.
+type Comment struct {
+	ID        int64     `json:"id"`
+	HTMLURL   string    `json:"html_url"`
+	User      string    `json:"user"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ghComment struct {
+	ID        int64     `json:"id"`
+	HTMLURL   string    `json:"html_url"`
+	User      ghUser    `json:"user"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func convertComment(c ghComment) Comment {
+	return Comment{ID: c.ID, HTMLURL: c.HTMLURL, User: c.User.Login, Body: c.Body, CreatedAt: c.CreatedAt}
+}
+
+// GetIssue returns a single issue.
+func (c *Client) GetIssue(owner, repo string, number int) (Issue, error) {
+	var out ghIssue
+	if err := c.get(fmt.Sprintf("%s/issues/%d", repoPath(owner, repo), number), &out); err != nil {
+		return Issue{}, err
+	}
+	issue := Issue{
+		Number:        out.Number,
+		HTMLURL:       out.HTMLURL,
+		State:         out.State,
+		Title:         out.Title,
+		Body:          out.Body,
+		User:          out.User.Login,
+		Labels:        []string{},
+		Comments:      out.Comments,
+		IsPullRequest: out.PullRequest != nil,
+		CreatedAt:     out.CreatedAt,
+	}
+	for _, l := range out.Labels {
+		issue.Labels = append(issue.Labels, l.Name)
+	}
+	return issue, nil
+}
+
+// ListIssueComments returns all comments on an issue or pull request
+// conversation, oldest first.
+func (c *Client) ListIssueComments(owner, repo string, number int) ([]Comment, error) {
+	comments := []Comment{}
+	err := c.getAll(fmt.Sprintf("%s/issues/%d/comments?per_page=100", repoPath(owner, repo), number), func(page []byte) error {
+		var items []ghComment
+		if err := json.Unmarshal(page, &items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			comments = append(comments, convertComment(item))
+		}
+		return nil
+	})
+	return comments, err
+}
+
+// CreateIssueComment posts a comment on an issue or pull request.
+func (c *Client) CreateIssueComment(owner, repo string, number int, body string) (Comment, error) {
+	var out ghComment
+	path := fmt.Sprintf("%s/issues/%d/comments", repoPath(owner, repo), number)
+	if _, err := c.do("POST", path, map[string]string{"body": body}, &out); err != nil {
+		return Comment{}, err
+	}
+	return convertComment(out), nil
+}
@@ -0,0 +1,141 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// PullRequest is a GitHub pull request.
+type PullRequest struct {
+	Number    int       `json:"number"`
+	HTMLURL   string    `json:"html_url"`
+	State     string    `json:"state"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Draft     bool      `json:"draft"`
+	Merged    bool      `json:"merged"`
+	Head      string    `json:"head"`
+	HeadSHA   string    `json:"head_sha"`
+	HeadRepo  string    `json:"head_repo"` // full name; differs from the base repo for forks
+	Base      string    `json:"base"`
+	User      string    `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ghPullRequest struct {
+	Number   int        `json:"number"`
+	HTMLURL  string     `json:"html_url"`
+	State    string     `json:"state"`
+	Title    string     `json:"title"`
+	Body     string     `json:"body"`
+	Draft    bool       `json:"draft"`
+	MergedAt *time.Time `json:"merged_at"`
+	Head     struct {
+		Ref  string `json:"ref"`
+		SHA  string `json:"sha"`
+		Repo *struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	User      ghUser    `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ghUser struct {
+	Login string `json:"login"`
+}
+
+func convertPullRequest(pr ghPullRequest) PullRequest {
+	var headRepo string
+	if pr.Head.Repo != nil {
+		headRepo = pr.Head.Repo.FullName
+	}
+	return PullRequest{
+		Number:    pr.Number,
+		HTMLURL:   pr.HTMLURL,
+		State:     pr.State,
+		Title:     pr.Title,
+		Body:      pr.Body,
+		Draft:     pr.Draft,
+		Merged:    pr.MergedAt != nil,
+		Head:      pr.Head.Ref,
+		HeadSHA:   pr.Head.SHA,
+		HeadRepo:  headRepo,
+		Base:      pr.Base.Ref,
+		User:      pr.User.Login,
+		CreatedAt: pr.CreatedAt,
+		UpdatedAt: pr.UpdatedAt,
+	}
+}
+
+// NewPullRequest describes a pull request to open from Head into Base.
+type NewPullRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body,omitempty"`
+	Head  string `json:"head"`
+	Base  string `json:"base"`
+	Draft bool   `json:"draft,omitempty"`
+}
+
+// PullRequestUpdate changes the fields of a pull request that are non-nil.
+type PullRequestUpdate struct {
+	Title *string `json:"title,omitempty"`
+	Body  *string `json:"body,omitempty"`
+	Base  *string `json:"base,omitempty"`
+	State *string `json:"state,omitempty"` // "open" or "closed"
+}
+
+// CreatePullRequest opens a pull request.
+func (c *Client) CreatePullRequest(owner, repo string, pr NewPullRequest) (PullRequest, error) {
+	var out ghPullRequest
+	if _, err := c.do("POST", repoPath(owner, repo)+"/pulls", pr, &out); err != nil {
+		return PullRequest{}, err
+	}
+	return convertPullRequest(out), nil
+}
+
+// UpdatePullRequest edits a pull request.
+func (c *Client) UpdatePullRequest(owner, repo string, number int, update PullRequestUpdate) (PullRequest, error) {
+	var out ghPullRequest
+	if _, err := c.do("PATCH", fmt.Sprintf("%s/pulls/%d", repoPath(owner, repo), number), update, &out); err != nil {
+		return PullRequest{}, err
+	}
+	return convertPullRequest(out), nil
+}
+
+// GetPullRequest returns a single pull request.
+func (c *Client) GetPullRequest(owner, repo string, number int) (PullRequest, error) {
+	var out ghPullRequest
+	if err := c.get(fmt.Sprintf("%s/pulls/%d", repoPath(owner, repo), number), &out); err != nil {
+		return PullRequest{}, err
+	}
+	return convertPullRequest(out), nil
+}
+
+// ListPullRequestsForBranch returns the pull requests whose head is branch
+// in owner's repo. state is "open", "closed" or "all".
+func (c *Client) ListPullRequestsForBranch(owner, repo, branch, state string) ([]PullRequest, error) {
+	if state == "" {
+		state = "open"
+	}
+	q := url.Values{"head": {owner + ":" + branch}, "state": {state}, "per_page": {"100"}}
+	prs := []PullRequest{}
+	err := c.getAll(repoPath(owner, repo)+"/pulls?"+q.Encode(), func(page []byte) error {
+		var items []ghPullRequest
+		if err := json.Unmarshal(page, &items); err != nil {
+			return err
+		}
+		for _, pr := range items {
+			prs = append(prs, convertPullRequest(pr))
+		}
+		return nil
+	})
+	return prs, err
+}
@@ -0,0 +1,107 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+type Repo struct {
+	FullName      string `json:"full_name"`
+	HTMLURL       string `json:"html_url"`
+	CloneURL      string `json:"clone_url"`
+	Owner         string `json:"owner_login"`
+	Name          string `json:"name"`
+	Private       bool   `json:"private"`
+	DefaultBranch string `json:"default_branch"`
+	Description   string `json:"description"`
+}
+
+type ghRepo struct {
+	FullName      string `json:"full_name"`
+	HTMLURL       string `json:"html_url"`
+	CloneURL      string `json:"clone_url"`
+	Private       bool   `json:"private"`
+	DefaultBranch string `json:"default_branch"`
+	Description   string `json:"description"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	Name string `json:"name"`
+}
+
+type ghOrg struct {
+	Login string `json:"login"`
+}
+
+func convertRepos(ghRepos []ghRepo) []Repo {
+	repos := make([]Repo, 0, len(ghRepos))
+	for _, r := range ghRepos {
+		repos = append(repos, Repo{
+			FullName:      r.FullName,
+			HTMLURL:       r.HTMLURL,
+			CloneURL:      r.CloneURL,
+			Owner:         r.Owner.Login,
+			Name:          r.Name,
+			Private:       r.Private,
+			DefaultBranch: r.DefaultBranch,
+			Description:   r.Description,
+		})
+	}
+	return repos
+}
+
+// paginateRepos fetches all pages from a paginated GitHub repos endpoint.
+func (c *Client) paginateRepos(path string) ([]Repo, error) {
+	var all []ghRepo
+	err := c.getAll(path, func(page []byte) error {
+		var repos []ghRepo
+		if err := json.Unmarshal(page, &repos); err != nil {
+			return err
+		}
+		all = append(all, repos...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertRepos(all), nil
+}
+
+// ListAllRepos returns all repos the user has access to: their own repos
+// plus repos from all orgs they belong to, fully paginated and deduplicated.
+func (c *Client) ListAllRepos() ([]Repo, error) {
+	// Fetch all user repos (owned, collaborator, org member)
+	allRepos, err := c.paginateRepos("/user/repos?per_page=100&sort=updated&type=all")
+	if err != nil {
+		return nil, fmt.Errorf("listing user repos: %w", err)
+	}
+
+	// Fetch user's orgs
+	var orgs []ghOrg
+	if err := c.get("/user/orgs?per_page=100", &orgs); err != nil {
+		// Non-fatal: we still have user repos
+		return allRepos, nil
+	}
+
+	// Fetch repos for each org
+	seen := make(map[string]bool, len(allRepos))
+	for _, r := range allRepos {
+		seen[r.FullName] = true
+	}
+
+	for _, org := range orgs {
+		orgRepos, err := c.paginateRepos(fmt.Sprintf("/orgs/%s/repos?per_page=100&sort=updated", url.PathEscape(org.Login)))
+		if err != nil {
+			continue // skip orgs that fail (permissions, etc.)
+		}
+		for _, r := range orgRepos {
+			if !seen[r.FullName] {
+				seen[r.FullName] = true
+				allRepos = append(allRepos, r)
+			}
+		}
+	}
+
+	return allRepos, nil
+}
@@ -0,0 +1,128 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReviewThread is a thread of review comments on a line of a pull request.
+type ReviewThread struct {
+	Path       string          `json:"path"`
+	Line       int             `json:"line"`
+	IsResolved bool            `json:"is_resolved"`
+	IsOutdated bool            `json:"is_outdated"`
+	Comments   []ReviewComment `json:"comments"`
+}
+
+// ReviewComment is one comment in a review thread.
+type ReviewComment struct {
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	DiffHunk  string    `json:"diff_hunk"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const reviewThreadsQuery = `query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 50, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          path
+          line
+          isResolved
+          isOutdated
+          comments(first: 50) {
+            nodes { author { login } body diffHunk createdAt }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// graphqlURL returns the GraphQL endpoint for the client's REST base URL.
+// GitHub Enterprise serves REST under /api/v3 and GraphQL at /api/graphql.
+func (c *Client) graphqlURL() string {
+	if base, ok := strings.CutSuffix(c.baseURL, "/api/v3"); ok {
+		return base + "/api/graphql"
+	}
+	return c.baseURL + "/graphql"
+}
+
+// ListReviewThreads returns the review threads of a pull request. Review
+// thread resolution is only exposed by the GraphQL API.
+func (c *Client) ListReviewThreads(owner, repo string, number int) ([]ReviewThread, error) {
+	threads := []ReviewThread{}
+	var cursor *string
+	for {
+		var resp struct {
+			Data struct {
+				Repository struct {
+					PullRequest *struct {
+						ReviewThreads struct {
+							PageInfo struct {
+								HasNextPage bool   `json:"hasNextPage"`
+								EndCursor   string `json:"endCursor"`
+							} `json:"pageInfo"`
+							Nodes []struct {
+								Path       string `json:"path"`
+								Line       int    `json:"line"`
+								IsResolved bool   `json:"isResolved"`
+								IsOutdated bool   `json:"isOutdated"`
+								Comments   struct {
+									Nodes []struct {
+										Author *struct {
+											Login string `json:"login"`
+										} `json:"author"`
+										Body      string    `json:"body"`
+										DiffHunk  string    `json:"diffHunk"`
+										CreatedAt time.Time `json:"createdAt"`
+									} `json:"nodes"`
+								} `json:"comments"`
+							} `json:"nodes"`
+						} `json:"reviewThreads"`
+					} `json:"pullRequest"`
+				} `json:"repository"`
+			} `json:"data"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		req := map[string]any{
+			"query": reviewThreadsQuery,
+			"variables": map[string]any{
+				"owner": owner, "name": repo, "number": number, "cursor": cursor,
+			},
+		}
+		if _, err := c.do("POST", c.graphqlURL(), req, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Errors) > 0 {
+			return nil, fmt.Errorf("github GraphQL error: %s", resp.Errors[0].Message)
+		}
+		pr := resp.Data.Repository.PullRequest
+		if pr == nil {
+			return nil, fmt.Errorf("pull request #%d not found", number)
+		}
+
+		for _, n := range pr.ReviewThreads.Nodes {
+			t := ReviewThread{Path: n.Path, Line: n.Line, IsResolved: n.IsResolved, IsOutdated: n.IsOutdated, Comments: []ReviewComment{}}
+			for _, cm := range n.Comments.Nodes {
+				rc := ReviewComment{Body: cm.Body, DiffHunk: cm.DiffHunk, CreatedAt: cm.CreatedAt}
+				if cm.Author != nil {
+					rc.Author = cm.Author.Login
+				}
+				t.Comments = append(t.Comments, rc)
+			}
+			threads = append(threads, t)
+		}
+
+		if !pr.ReviewThreads.PageInfo.HasNextPage {
+			return threads, nil
+		}
+		end := pr.ReviewThreads.PageInfo.EndCursor
+		cursor = &end
+	}
+}
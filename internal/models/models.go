@@ -1,10 +1,14 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Setting struct {
 	Key       string    `json:"key"`
 	Value     string    `json:"value"`
+	Secret    bool      `json:"secret"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
@@ -15,11 +19,21 @@ type Repository struct {
 	Name          string     `json:"name"`
 	LocalPath     string     `json:"local_path"`
 	CloneStatus   string     `json:"clone_status"`
+	CloneError    string     `json:"clone_error"`
 	DefaultBranch string     `json:"default_branch"`
 	LastSynced    *time.Time `json:"last_synced"`
 	CreatedAt     time.Time  `json:"created_at"`
 	SourcePath    *string    `json:"source_path"`
 	RepoType      string     `json:"repo_type"`
+	CloneURL      string     `json:"clone_url"`
+	CloneFilter   string     `json:"clone_filter"`
+	CloneDepth    int        `json:"clone_depth"`
+	SparsePaths   []string   `json:"sparse_paths"`
+
+	SyncIntervalMinutes *int            `json:"sync_interval_minutes"`
+	LastSyncAt          *time.Time      `json:"last_sync_at"`
+	LastSyncError       string          `json:"last_sync_error"`
+	LastSyncResult      json.RawMessage `json:"last_sync_result,omitempty"`
 }
 
 type Session struct {
@@ -30,6 +44,7 @@ type Session struct {
 	CLIType      string    `json:"cli_type"`
 	Status       string    `json:"status"`
 	PID          *int      `json:"pid"`
+	BatchID      *string   `json:"batch_id"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
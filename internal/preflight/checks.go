@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/peterje/superposition/internal/models"
+	"github.com/peterje/superposition/internal/secrets"
 )
 
 func CheckAll(db *sql.DB) ([]models.CLIStatus, bool) {
@@ -46,6 +47,10 @@ func checkCLI(name string, db *sql.DB) models.CLIStatus {
 	if db != nil {
 		var val string
 		err := db.QueryRow(`SELECT value FROM settings WHERE key = ?`, "cli_command."+name).Scan(&val)
+		if err == nil {
+			// The setting may have been marked secret.
+			val, err = secrets.Decrypt(val)
+		}
 		if err == nil && val != "" {
 			override = val
 		}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/peterje/superposition/internal/github"
+)
+
+// restClient is a minimal JSON API client shared by the GitLab and Gitea
+// providers. Errors are returned as *github.APIError so github.IsNotFound
+// works for every provider.
+type restClient struct {
+	name       string
+	baseURL    string
+	authHeader string
+	authValue  string
+	http       *http.Client
+}
+
+func newRESTClient(name, baseURL, authHeader, authValue string) restClient {
+	return restClient{
+		name:       name,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		authHeader: authHeader,
+		authValue:  authValue,
+		http:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends a request and decodes the JSON response into target when non-nil.
+// It returns the response headers for pagination.
+func (c restClient) do(method, path string, body, target any) (http.Header, error) {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(c.authHeader, c.authValue)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s API request: %w", c.name, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s API response: %w", c.name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var msg struct {
+			Message any    `json:"message"`
+			Error   string `json:"error"`
+		}
+		json.Unmarshal(data, &msg)
+		text := msg.Error
+		if msg.Message != nil {
+			text = fmt.Sprint(msg.Message)
+		}
+		return nil, &github.APIError{StatusCode: resp.StatusCode, Message: text, Body: string(data)}
+	}
+	if target != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, target); err != nil {
+			return nil, fmt.Errorf("%s API response: %w", c.name, err)
+		}
+	}
+	return resp.Header, nil
+}
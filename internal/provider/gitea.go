@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peterje/superposition/internal/github"
+)
+
+const giteaPageSize = 50
+
+// GiteaClient talks to the Gitea (or Forgejo) REST API with an access token.
+type GiteaClient struct {
+	rest restClient
+}
+
+// NewGitea returns a client for the Gitea instance at baseURL, e.g.
+// "https://gitea.example.com".
+func NewGitea(baseURL, token string) *GiteaClient {
+	return &GiteaClient{rest: newRESTClient("gitea", strings.TrimSuffix(baseURL, "/")+"/api/v1", "Authorization", "token "+token)}
+}
+
+type giteaRepo struct {
+	FullName      string `json:"full_name"`
+	Name          string `json:"name"`
+	HTMLURL       string `json:"html_url"`
+	CloneURL      string `json:"clone_url"`
+	Private       bool   `json:"private"`
+	DefaultBranch string `json:"default_branch"`
+	Description   string `json:"description"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+type giteaPullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Draft   bool   `json:"draft"`
+	Merged  bool   `json:"merged"`
+	Head    struct {
+		Ref  string `json:"ref"`
+		SHA  string `json:"sha"`
+		Repo *struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (pr giteaPullRequest) convert() github.PullRequest {
+	var headRepo string
+	if pr.Head.Repo != nil {
+		headRepo = pr.Head.Repo.FullName
+	}
+	return github.PullRequest{
+		Number:    pr.Number,
+		HTMLURL:   pr.HTMLURL,
+		State:     pr.State,
+		Title:     pr.Title,
+		Body:      pr.Body,
+		Draft:     pr.Draft,
+		Merged:    pr.Merged,
+		Head:      pr.Head.Ref,
+		HeadSHA:   pr.Head.SHA,
+		HeadRepo:  headRepo,
+		Base:      pr.Base.Ref,
+		User:      pr.User.Login,
+		CreatedAt: pr.CreatedAt,
+		UpdatedAt: pr.UpdatedAt,
+	}
+}
+
+// ListAllRepos returns the repositories the token's user can access.
+func (c *GiteaClient) ListAllRepos() ([]github.Repo, error) {
+	repos := []github.Repo{}
+	for page := 1; ; page++ {
+		var items []giteaRepo
+		path := "/user/repos?limit=" + strconv.Itoa(giteaPageSize) + "&page=" + strconv.Itoa(page)
+		if _, err := c.rest.do("GET", path, nil, &items); err != nil {
+			return nil, fmt.Errorf("listing gitea repos: %w", err)
+		}
+		for _, r := range items {
+			repos = append(repos, github.Repo{
+				FullName:      r.FullName,
+				HTMLURL:       r.HTMLURL,
+				CloneURL:      r.CloneURL,
+				Owner:         r.Owner.Login,
+				Name:          r.Name,
+				Private:       r.Private,
+				DefaultBranch: r.DefaultBranch,
+				Description:   r.Description,
+			})
+		}
+		if len(items) < giteaPageSize {
+			return repos, nil
+		}
+	}
+}
+
+// ListPullRequestsForBranch returns the pull requests whose head is branch
+// in the repo itself. Gitea can't filter by head, so every pull request in
+// the given state is scanned.
+func (c *GiteaClient) ListPullRequestsForBranch(owner, repo, branch, state string) ([]github.PullRequest, error) {
+	if state == "" {
+		state = "open"
+	}
+	fullName := owner + "/" + repo
+	prs := []github.PullRequest{}
+	for page := 1; ; page++ {
+		var items []giteaPullRequest
+		path := fmt.Sprintf("%s/pulls?state=%s&limit=%d&page=%d", giteaRepoPath(owner, repo), state, giteaPageSize, page)
+		if _, err := c.rest.do("GET", path, nil, &items); err != nil {
+			return nil, err
+		}
+		for _, pr := range items {
+			p := pr.convert()
+			if p.Head == branch && (p.HeadRepo == "" || strings.EqualFold(p.HeadRepo, fullName)) {
+				prs = append(prs, p)
+			}
+		}
+		if len(items) < giteaPageSize {
+			return prs, nil
+		}
+	}
+}
+
+// CreatePullRequest opens a pull request. Drafts are marked with Gitea's
+// "WIP:" title prefix.
+func (c *GiteaClient) CreatePullRequest(owner, repo string, pr github.NewPullRequest) (github.PullRequest, error) {
+	title := pr.Title
+	if pr.Draft && !strings.HasPrefix(title, "WIP:") {
+		title = "WIP: " + title
+	}
+	body := map[string]string{"head": pr.Head, "base": pr.Base, "title": title, "body": pr.Body}
+	var out giteaPullRequest
+	if _, err := c.rest.do("POST", giteaRepoPath(owner, repo)+"/pulls", body, &out); err != nil {
+		return github.PullRequest{}, err
+	}
+	return out.convert(), nil
+}
+
+func giteaRepoPath(owner, repo string) string {
+	return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
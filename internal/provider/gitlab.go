@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/peterje/superposition/internal/github"
+)
+
+// DefaultGitLabURL is gitlab.com; self-managed instances set their own.
+const DefaultGitLabURL = "https://gitlab.com"
+
+// GitLabClient talks to the GitLab REST API (v4) with a personal access
+// token.
+type GitLabClient struct {
+	rest restClient
+}
+
+// NewGitLab returns a client for the GitLab instance at baseURL
+// (DefaultGitLabURL if empty), e.g. "https://gitlab.example.com".
+func NewGitLab(baseURL, token string) *GitLabClient {
+	if baseURL == "" {
+		baseURL = DefaultGitLabURL
+	}
+	return &GitLabClient{rest: newRESTClient("gitlab", strings.TrimSuffix(baseURL, "/")+"/api/v4", "PRIVATE-TOKEN", token)}
+}
+
+type glProject struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	Path              string `json:"path"`
+	WebURL            string `json:"web_url"`
+	HTTPURLToRepo     string `json:"http_url_to_repo"`
+	Visibility        string `json:"visibility"`
+	DefaultBranch     string `json:"default_branch"`
+	Description       string `json:"description"`
+	Namespace         struct {
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+}
+
+type glMergeRequest struct {
+	IID          int       `json:"iid"`
+	WebURL       string    `json:"web_url"`
+	State        string    `json:"state"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Draft        bool      `json:"draft"`
+	SourceBranch string    `json:"source_branch"`
+	TargetBranch string    `json:"target_branch"`
+	SHA          string    `json:"sha"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Author       struct {
+		Username string `json:"username"`
+	} `json:"author"`
+}
+
+// convert reports a merge request as a pull request. GitLab's "opened" and
+// "merged" states map to GitHub's "open" and "closed".
+func (mr glMergeRequest) convert(fullName string) github.PullRequest {
+	state := mr.State
+	switch state {
+	case "opened":
+		state = "open"
+	case "merged", "locked":
+		state = "closed"
+	}
+	return github.PullRequest{
+		Number:    mr.IID,
+		HTMLURL:   mr.WebURL,
+		State:     state,
+		Title:     mr.Title,
+		Body:      mr.Description,
+		Draft:     mr.Draft,
+		Merged:    mr.State == "merged",
+		Head:      mr.SourceBranch,
+		HeadSHA:   mr.SHA,
+		HeadRepo:  fullName,
+		Base:      mr.TargetBranch,
+		User:      mr.Author.Username,
+		CreatedAt: mr.CreatedAt,
+		UpdatedAt: mr.UpdatedAt,
+	}
+}
+
+func glProjectPath(owner, repo string) string {
+	return "/projects/" + url.PathEscape(owner+"/"+repo)
+}
+
+// ListAllRepos returns the projects the token's user is a member of.
+func (c *GitLabClient) ListAllRepos() ([]github.Repo, error) {
+	repos := []github.Repo{}
+	for page := "1"; page != ""; {
+		var projects []glProject
+		header, err := c.rest.do("GET", "/projects?membership=true&simple=true&per_page=100&order_by=last_activity_at&page="+page, nil, &projects)
+		if err != nil {
+			return nil, fmt.Errorf("listing gitlab projects: %w", err)
+		}
+		for _, p := range projects {
+			repos = append(repos, github.Repo{
+				FullName:      p.PathWithNamespace,
+				HTMLURL:       p.WebURL,
+				CloneURL:      p.HTTPURLToRepo,
+				Owner:         p.Namespace.FullPath,
+				Name:          p.Path,
+				Private:       p.Visibility != "public",
+				DefaultBranch: p.DefaultBranch,
+				Description:   p.Description,
+			})
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return repos, nil
+}
+
+// ListPullRequestsForBranch returns the merge requests from branch. state is
+// "open", "closed" or "all".
+func (c *GitLabClient) ListPullRequestsForBranch(owner, repo, branch, state string) ([]github.PullRequest, error) {
+	q := url.Values{"source_branch": {branch}, "per_page": {"100"}}
+	if state == "" || state == "open" {
+		q.Set("state", "opened")
+	}
+	var mrs []glMergeRequest
+	if _, err := c.rest.do("GET", glProjectPath(owner, repo)+"/merge_requests?"+q.Encode(), nil, &mrs); err != nil {
+		return nil, err
+	}
+	prs := []github.PullRequest{}
+	for _, mr := range mrs {
+		if state == "closed" && mr.State == "opened" {
+			continue
+		}
+		prs = append(prs, mr.convert(owner+"/"+repo))
+	}
+	return prs, nil
+}
+
+// CreatePullRequest opens a merge request. Drafts are marked with GitLab's
+// "Draft:" title prefix.
+func (c *GitLabClient) CreatePullRequest(owner, repo string, pr github.NewPullRequest) (github.PullRequest, error) {
+	title := pr.Title
+	if pr.Draft && !strings.HasPrefix(title, "Draft:") {
+		title = "Draft: " + title
+	}
+	body := map[string]any{
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+		"title":         title,
+		"description":   pr.Body,
+	}
+	var mr glMergeRequest
+	if _, err := c.rest.do("POST", glProjectPath(owner, repo)+"/merge_requests", body, &mr); err != nil {
+		return github.PullRequest{}, err
+	}
+	return mr.convert(owner + "/" + repo), nil
+}
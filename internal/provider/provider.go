@@ -0,0 +1,45 @@
+// Package provider abstracts the code hosting services repositories can be
+// cloned from and pull requests opened on. GitHub is served by
+// internal/github; GitLab and Gitea are implemented here against their REST
+// APIs and report results using the same types.
+package provider
+
+import (
+	"github.com/peterje/superposition/internal/github"
+)
+
+// Names of the supported providers, as stored in repositories.repo_type.
+// Repositories of type "git" are plain remotes without an API, and "local"
+// ones are cloned from a path on disk.
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+	Gitea  = "gitea"
+	Git    = "git"
+	Local  = "local"
+)
+
+// Provider is a hosting service API. Merge requests are reported as pull
+// requests; repos are identified by owner (a namespace path on GitLab) and
+// name.
+type Provider interface {
+	ListAllRepos() ([]github.Repo, error)
+	ListPullRequestsForBranch(owner, repo, branch, state string) ([]github.PullRequest, error)
+	CreatePullRequest(owner, repo string, pr github.NewPullRequest) (github.PullRequest, error)
+}
+
+var _ Provider = (*github.Client)(nil)
+
+// HasAPI reports whether repositories of the given type have a provider API.
+func HasAPI(repoType string) bool {
+	return repoType == GitHub || repoType == GitLab || repoType == Gitea
+}
+
+// GitUsername is the username sent with a provider token over HTTPS.
+func GitUsername(repoType string) string {
+	switch repoType {
+	case GitLab, Gitea:
+		return "oauth2"
+	}
+	return "x-access-token"
+}
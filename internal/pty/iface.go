@@ -11,6 +11,10 @@ type SessionHandle interface {
 // SessionManager manages PTY session lifecycles.
 type SessionManager interface {
 	Start(id, cliType, workDir string, env map[string]string) (SessionHandle, int /* pid */, error)
+	// StartWithHistory is Start for a session whose previous process has
+	// been stopped: history is put in front of the new process's replay
+	// buffer, so reconnecting clients see the earlier output too.
+	StartWithHistory(id, cliType, workDir string, env map[string]string, history []byte) (SessionHandle, int, error)
 	Stop(id string) error
 	Get(id string) SessionHandle
 	Resize(id string, rows, cols uint16) error
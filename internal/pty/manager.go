@@ -98,6 +98,10 @@ func NewManager() *Manager {
 }
 
 func (m *Manager) Start(id, cliType, workDir string, env map[string]string) (SessionHandle, int, error) {
+	return m.StartWithHistory(id, cliType, workDir, env, nil)
+}
+
+func (m *Manager) StartWithHistory(id, cliType, workDir string, env map[string]string, history []byte) (SessionHandle, int, error) {
 	args := strings.Fields(cliType)
 	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Dir = workDir
@@ -118,6 +122,7 @@ func (m *Manager) Start(id, cliType, workDir string, env map[string]string) (Ses
 		done:        make(chan struct{}),
 		subscribers: make(map[chan []byte]struct{}),
 	}
+	sess.appendReplay(history)
 
 	// Read from PTY, fan out to replay buffer + subscribers
 	go func() {
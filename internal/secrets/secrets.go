@@ -0,0 +1,146 @@
+// Package secrets encrypts sensitive values stored in the database (tokens,
+// webhook secrets, env vars) with a key kept outside it, so backups of
+// superposition.db don't contain usable credentials.
+//
+// The key is read from the file named by SUPERPOSITION_SECRET_KEY_FILE, or
+// ~/.superposition/secret.key, which is created on first use.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/peterje/superposition/internal/db"
+)
+
+// prefix marks encrypted values. Values without it are plaintext written
+// before encryption was added and are returned as-is by Decrypt.
+const prefix = "enc:v1:"
+
+const keySize = 32 // AES-256
+
+var keyState struct {
+	once sync.Once
+	aead cipher.AEAD
+	err  error
+}
+
+func keyPath() (string, error) {
+	if p := os.Getenv("SUPERPOSITION_SECRET_KEY_FILE"); p != "" {
+		return p, nil
+	}
+	dir, err := db.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "secret.key"), nil
+}
+
+// loadKey reads the hex-encoded key file, generating it if it doesn't exist.
+func loadKey() ([]byte, error) {
+	path, err := keyPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		// O_EXCL so two processes starting at once can't both write a key.
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			return loadKey()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("create secret key: %w", err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+			return nil, fmt.Errorf("write secret key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read secret key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("secret key %s must be %d hex-encoded bytes", path, keySize)
+	}
+	return key, nil
+}
+
+func aead() (cipher.AEAD, error) {
+	keyState.once.Do(func() {
+		key, err := loadKey()
+		if err != nil {
+			keyState.err = err
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			keyState.err = err
+			return
+		}
+		keyState.aead, keyState.err = cipher.NewGCM(block)
+	})
+	return keyState.aead, keyState.err
+}
+
+// IsEncrypted reports whether value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt encrypts plaintext for storage. The empty string stays empty so
+// "not set" checks keep working on stored values.
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	gcm, err := aead()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of a stored value. Values that aren't
+// encrypted are returned unchanged.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	gcm, err := aead()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt: wrong secret key or corrupted value")
+	}
+	return string(plaintext), nil
+}
@@ -36,13 +36,18 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) routes(spaHandler http.Handler) {
 	settings := api.NewSettingsHandler(s.db)
-	repos := api.NewReposHandler(s.db)
+	secrets := api.NewSecretsHandler(s.db)
 	webhooks := api.NewWebhooksHandler(s.db, s.PtyMgr)
+	repos := api.NewReposHandler(s.db, webhooks)
+	usage := api.NewUsageHandler(s.db)
+	githubWebhook := api.NewGitHubWebhookHandler(s.db, s.PtyMgr, webhooks)
 	sessions := api.NewSessionsHandler(s.db, s.PtyMgr, webhooks)
+	sessionTemplates := api.NewSessionTemplatesHandler(s.db)
 	notes := api.NewNotesHandler(s.db)
 	upload := api.NewUploadHandler(s.db)
 	files := api.NewFilesHandler(s.db)
-	envvars := api.NewEnvVarsHandler(s.db)
+	envvars := api.NewEnvVarsHandler(s.db, s.PtyMgr, webhooks)
+	envProfiles := api.NewEnvProfilesHandler(s.db)
 	sessionUI := api.NewSessionUIHandler(s.db)
 	orchestrator := api.NewOrchestratorHandler(s.db, s.PtyMgr)
 	sessionInput := api.NewSessionInputHandler(s.PtyMgr)
@@ -51,27 +56,72 @@ func (s *Server) routes(spaHandler http.Handler) {
 	// Health
 	s.mux.HandleFunc("GET /api/health", s.handleHealth)
 
+	// Disk usage
+	s.mux.HandleFunc("GET /api/usage", usage.HandleGet)
+	s.mux.HandleFunc("POST /api/maintenance", usage.HandleMaintenance)
+
 	// Settings
 	s.mux.HandleFunc("GET /api/settings", settings.ServeHTTP)
 	s.mux.HandleFunc("GET /api/settings/{key}", settings.ServeHTTP)
 	s.mux.HandleFunc("PUT /api/settings/{key}", settings.ServeHTTP)
 	s.mux.HandleFunc("DELETE /api/settings/{key}", settings.ServeHTTP)
 
+	// Secrets
+	s.mux.HandleFunc("GET /api/secrets", secrets.HandleList)
+	s.mux.HandleFunc("PUT /api/secrets/{name}", secrets.HandlePut)
+	s.mux.HandleFunc("DELETE /api/secrets/{name}", secrets.HandleDelete)
+
 	// GitHub
 	s.mux.HandleFunc("GET /api/github/repos", repos.HandleGitHubRepos)
+	s.mux.HandleFunc("GET /api/providers/{provider}/repos", repos.HandleProviderRepos)
+	s.mux.HandleFunc("POST /api/github/webhook", githubWebhook.HandleWebhook)
 
 	// Repos
 	s.mux.HandleFunc("GET /api/repos", repos.HandleList)
 	s.mux.HandleFunc("POST /api/repos", repos.HandleCreate)
+	s.mux.HandleFunc("PATCH /api/repos/{id}", repos.HandleUpdate)
 	s.mux.HandleFunc("DELETE /api/repos/{id}", repos.HandleDelete)
 	s.mux.HandleFunc("POST /api/repos/{id}/sync", repos.HandleSync)
+	s.mux.HandleFunc("GET /api/repos/{id}/clone/events", repos.HandleCloneEvents)
 	s.mux.HandleFunc("GET /api/repos/{id}/branches", repos.HandleBranches)
+	s.mux.HandleFunc("GET /api/repos/{id}/config", repos.HandleGetConfig)
+	s.mux.HandleFunc("PUT /api/repos/{id}/config", repos.HandlePutConfig)
 
 	// Sessions
 	s.mux.HandleFunc("GET /api/sessions", sessions.HandleList)
 	s.mux.HandleFunc("POST /api/sessions", sessions.HandleCreate)
+	s.mux.HandleFunc("POST /api/sessions/batch", sessions.HandleBatch)
+	s.mux.HandleFunc("POST /api/sessions/from-issue", sessions.HandleCreateFromIssue)
+	s.mux.HandleFunc("POST /api/sessions/from-pr", sessions.HandleCreateFromPR)
 	s.mux.HandleFunc("GET /api/sessions/{id}/replay", sessions.HandleReplay)
+	s.mux.HandleFunc("POST /api/sessions/{id}/restart", sessions.HandleRestart)
+	s.mux.HandleFunc("POST /api/sessions/{id}/archive", sessions.HandleArchive)
+	s.mux.HandleFunc("POST /api/sessions/{id}/restore", sessions.HandleRestore)
+	s.mux.HandleFunc("GET /api/archives", sessions.HandleListArchives)
+	s.mux.HandleFunc("DELETE /api/archives/{id}", sessions.HandleDeleteArchive)
 	s.mux.HandleFunc("DELETE /api/sessions/{id}", sessions.HandleDelete)
+	s.mux.HandleFunc("GET /api/sessions/{id}/setup", sessions.HandleGetSetup)
+	s.mux.HandleFunc("GET /api/sessions/{id}/diff", sessions.HandleDiff)
+	s.mux.HandleFunc("GET /api/sessions/compare", sessions.HandleCompare)
+	s.mux.HandleFunc("GET /api/sessions/{id}/git/status", sessions.HandleGitStatus)
+	s.mux.HandleFunc("GET /api/sessions/{id}/git/diff", sessions.HandleGitDiff)
+	s.mux.HandleFunc("GET /api/sessions/{id}/git/log", sessions.HandleGitLog)
+	s.mux.HandleFunc("GET /api/sessions/{id}/git/show", sessions.HandleGitShow)
+	s.mux.HandleFunc("POST /api/sessions/{id}/git/commit", sessions.HandleGitCommit)
+	s.mux.HandleFunc("POST /api/sessions/{id}/git/push", sessions.HandleGitPush)
+	s.mux.HandleFunc("POST /api/sessions/{id}/git/rebase", sessions.HandleGitRebase)
+	s.mux.HandleFunc("POST /api/sessions/{id}/git/merge-base-update", sessions.HandleGitMergeBaseUpdate)
+	s.mux.HandleFunc("POST /api/sessions/{id}/pull-request", sessions.HandlePullRequest)
+	s.mux.HandleFunc("GET /api/sessions/{id}/pull-request", sessions.HandleGetPullRequest)
+	s.mux.HandleFunc("PATCH /api/sessions/{id}/pull-request", sessions.HandleUpdatePullRequest)
+	s.mux.HandleFunc("POST /api/sessions/{id}/pull-request/comments", sessions.HandlePullRequestComment)
+
+	// Session templates
+	s.mux.HandleFunc("GET /api/session-templates", sessionTemplates.HandleList)
+	s.mux.HandleFunc("POST /api/session-templates", sessionTemplates.HandleCreate)
+	s.mux.HandleFunc("GET /api/session-templates/{id}", sessionTemplates.HandleGet)
+	s.mux.HandleFunc("PUT /api/session-templates/{id}", sessionTemplates.HandleUpdate)
+	s.mux.HandleFunc("DELETE /api/session-templates/{id}", sessionTemplates.HandleDelete)
 
 	// Session Notes
 	s.mux.HandleFunc("GET /api/sessions/{id}/notes", notes.HandleGet)
@@ -93,6 +143,13 @@ func (s *Server) routes(spaHandler http.Handler) {
 	s.mux.HandleFunc("GET /api/sessions/{id}/env", envvars.HandleGet)
 	s.mux.HandleFunc("PUT /api/sessions/{id}/env", envvars.HandlePut)
 
+	// Env Profiles
+	s.mux.HandleFunc("GET /api/env-profiles", envProfiles.HandleList)
+	s.mux.HandleFunc("POST /api/env-profiles", envProfiles.HandleCreate)
+	s.mux.HandleFunc("GET /api/env-profiles/{id}", envProfiles.HandleGet)
+	s.mux.HandleFunc("PUT /api/env-profiles/{id}", envProfiles.HandleUpdate)
+	s.mux.HandleFunc("DELETE /api/env-profiles/{id}", envProfiles.HandleDelete)
+
 	// Session UI (A2UI)
 	s.mux.HandleFunc("GET /api/sessions/{id}/ui", sessionUI.HandleGet)
 	s.mux.HandleFunc("PUT /api/sessions/{id}/ui", sessionUI.HandlePut)
@@ -110,6 +167,10 @@ func (s *Server) routes(spaHandler http.Handler) {
 	s.mux.HandleFunc("POST /api/workflows", workflows.HandleCreate)
 	s.mux.HandleFunc("DELETE /api/workflows/{id}", workflows.HandleDelete)
 	s.mux.HandleFunc("POST /api/workflows/{id}/run", workflows.HandleRun)
+	s.mux.HandleFunc("GET /api/workflows/{id}/runs", workflows.HandleListRuns)
+	s.mux.HandleFunc("GET /api/workflow-runs/{id}", workflows.HandleGetRun)
+	s.mux.HandleFunc("GET /api/workflow-runs/{id}/events", workflows.HandleRunEvents)
+	s.mux.HandleFunc("POST /api/workflow-runs/{id}/cancel", workflows.HandleCancelRun)
 
 	// Triggers
 	triggers := api.NewTriggersHandler(s.db)
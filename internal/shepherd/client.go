@@ -85,6 +85,11 @@ func (c *Client) ListSessions() ([]string, error) {
 
 // Start implements ptymgr.SessionManager.
 func (c *Client) Start(id, cliType, workDir string, env map[string]string) (ptymgr.SessionHandle, int, error) {
+	return c.StartWithHistory(id, cliType, workDir, env, nil)
+}
+
+// StartWithHistory implements ptymgr.SessionManager.
+func (c *Client) StartWithHistory(id, cliType, workDir string, env map[string]string, history []byte) (ptymgr.SessionHandle, int, error) {
 	// Pre-create done channel so we don't miss exit events
 	c.sessionMu.Lock()
 	c.sessionDone[id] = make(chan struct{})
@@ -96,6 +101,7 @@ func (c *Client) Start(id, cliType, workDir string, env map[string]string) (ptym
 		CLIType:   cliType,
 		WorkDir:   workDir,
 		Env:       env,
+		History:   history,
 	})
 	if err != nil {
 		c.sessionMu.Lock()
@@ -48,6 +48,7 @@ type Request struct {
 	CLIType   string            `json:"cli_type,omitempty"`
 	WorkDir   string            `json:"work_dir,omitempty"`
 	Env       map[string]string `json:"env,omitempty"`
+	History   []byte            `json:"history,omitempty"` // seeds the replay buffer
 
 	// Resize fields
 	Rows uint16 `json:"rows,omitempty"`
@@ -277,6 +277,7 @@ func (s *Shepherd) handleStart(cw *connWriter, req Request) {
 		done:        make(chan struct{}),
 		subscribers: make(map[chan []byte]struct{}),
 	}
+	sess.appendReplay(req.History)
 
 	// Read PTY output → replay buffer + subscribers
 	go func() {
@@ -309,13 +310,20 @@ func (s *Shepherd) handleStart(cw *connWriter, req Request) {
 		sess.mu.Unlock()
 		close(sess.done)
 
-		// Notify all connected clients
-		s.broadcastExit(req.SessionID)
-
-		// Remove from sessions map
+		// Remove from sessions map, unless the session was stopped and its
+		// ID reused by a restart: the new process owns the entry then, and
+		// clients already know this one is gone.
 		s.mu.Lock()
-		delete(s.sessions, req.SessionID)
+		current := s.sessions[req.SessionID] == sess
+		if current {
+			delete(s.sessions, req.SessionID)
+		}
 		s.mu.Unlock()
+
+		// Notify all connected clients
+		if current {
+			s.broadcastExit(req.SessionID)
+		}
 	}()
 
 	s.mu.Lock()
@@ -7,6 +7,7 @@ import (
 	"embed"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
@@ -21,8 +22,10 @@ import (
 	"github.com/peterje/superposition/internal/db"
 	"github.com/peterje/superposition/internal/gateway"
 	gitops "github.com/peterje/superposition/internal/git"
+	"github.com/peterje/superposition/internal/gitcred"
 	"github.com/peterje/superposition/internal/preflight"
 	ptymgr "github.com/peterje/superposition/internal/pty"
+	"github.com/peterje/superposition/internal/secrets"
 	"github.com/peterje/superposition/internal/server"
 	"github.com/peterje/superposition/internal/shepherd"
 	"github.com/peterje/superposition/internal/tunnel"
@@ -41,6 +44,12 @@ func main() {
 				log.Fatalf("Shepherd failed: %v", err)
 			}
 			return
+		case "git-credential":
+			if err := gitcred.Run(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "git-credential: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "gateway":
 			cfg := gateway.ParseConfig(os.Args[2:])
 			if err := gateway.Run(cfg, web.SPAHandler()); err != nil {
@@ -66,63 +75,35 @@ func main() {
 	}
 	defer database.Close()
 
-	// Run migrations
-	migrationSQL, err := migrationsFS.ReadFile("migrations/001_initial.sql")
-	if err != nil {
-		log.Fatalf("Failed to read migrations: %v", err)
-	}
-	if err := db.Migrate(database, string(migrationSQL)); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
-	}
-	migration002, err := migrationsFS.ReadFile("migrations/002_add_gemini.sql")
-	if err != nil {
-		log.Fatalf("Failed to read migration 002: %v", err)
-	}
-	if err := db.Migrate(database, string(migration002)); err != nil {
-		log.Fatalf("Failed to run migration 002: %v", err)
-	}
-	migration003, err := migrationsFS.ReadFile("migrations/003_add_local_repos.sql")
-	if err != nil {
-		log.Fatalf("Failed to read migration 003: %v", err)
-	}
-	if err := db.Migrate(database, string(migration003)); err != nil {
-		log.Fatalf("Failed to run migration 003: %v", err)
-	}
-	migration005, err := migrationsFS.ReadFile("migrations/005_session_notes.sql")
-	if err != nil {
-		log.Fatalf("Failed to read migration 005: %v", err)
-	}
-	if err := db.Migrate(database, string(migration005)); err != nil {
-		log.Fatalf("Failed to run migration 005: %v", err)
-	}
-	migration006, err := migrationsFS.ReadFile("migrations/006_session_env.sql")
-	if err != nil {
-		log.Fatalf("Failed to read migration 006: %v", err)
-	}
-	if err := db.Migrate(database, string(migration006)); err != nil {
-		log.Fatalf("Failed to run migration 006: %v", err)
-	}
-	migration007, err := migrationsFS.ReadFile("migrations/007_webhooks.sql")
-	if err != nil {
-		log.Fatalf("Failed to read migration 007: %v", err)
-	}
-	if err := db.Migrate(database, string(migration007)); err != nil {
-		log.Fatalf("Failed to run migration 007: %v", err)
-	}
-	migration008, err := migrationsFS.ReadFile("migrations/008_session_ui.sql")
+	// Run migrations in filename order; each is applied once.
+	migrations, err := fs.Glob(migrationsFS, "migrations/*.sql")
 	if err != nil {
-		log.Fatalf("Failed to read migration 008: %v", err)
+		log.Fatalf("Failed to list migrations: %v", err)
 	}
-	if err := db.Migrate(database, string(migration008)); err != nil {
-		log.Fatalf("Failed to run migration 008: %v", err)
+	for _, path := range migrations {
+		migrationSQL, err := migrationsFS.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read migration %s: %v", path, err)
+		}
+		if err := db.Migrate(database, filepath.Base(path), string(migrationSQL)); err != nil {
+			log.Fatalf("Failed to run migration %s: %v", path, err)
+		}
 	}
-	migration009, err := migrationsFS.ReadFile("migrations/009_orchestrator.sql")
-	if err != nil {
-		log.Fatalf("Failed to read migration 009: %v", err)
+
+	// Encrypt secrets written in plaintext by older versions. This creates
+	// the key file on first run.
+	if err := encryptPlaintextSecrets(database); err != nil {
+		log.Fatalf("Failed to encrypt stored secrets: %v", err)
 	}
-	if err := db.Migrate(database, string(migration009)); err != nil {
-		log.Fatalf("Failed to run migration 009: %v", err)
+
+	// Serve HTTPS credentials to git through this binary, and strip tokens
+	// that older versions stored in remote URLs.
+	if exe, err := os.Executable(); err != nil {
+		log.Printf("Failed to locate executable for git credential helper: %v", err)
+	} else if err := gitops.SetCredentialHelper(exe); err != nil {
+		log.Fatalf("Failed to set up git credential helper: %v", err)
 	}
+	configureRepoCredentials(database)
 
 	// Preflight checks (after DB init so overrides can be read)
 	fmt.Println("Running preflight checks...")
@@ -146,6 +127,15 @@ func main() {
 	// Reconcile DB with shepherd's active sessions
 	reconcileSessions(database, mgr, shepherdClient)
 	reconcileOrchestratorSessions(database, mgr, shepherdClient)
+	cleanupStaleWorkflowRuns(database)
+	cleanupStaleSessionSetup(database)
+	cleanupStaleClones(database)
+
+	// Stopped sessions keep their worktrees until they expire or the
+	// session is deleted
+	go api.RunWorktreeJanitor(database)
+	go api.RunRepoMaintenance(database)
+	go api.RunRepoSync(database, api.NewWebhooksHandler(database, mgr))
 
 	// Start server
 	srv := server.New(database, cliStatus, gitOk, web.SPAHandler(), mgr)
@@ -263,7 +253,7 @@ func reconcileSessions(database *sql.DB, mgr ptymgr.SessionManager, client *shep
 	}
 
 	// Get all running sessions from DB
-	rows, err := database.Query(`SELECT id, worktree_path FROM sessions WHERE status IN ('running', 'starting')`)
+	rows, err := database.Query(`SELECT id, worktree_path, COALESCE(pid, 0) FROM sessions WHERE status IN ('running', 'starting')`)
 	if err != nil {
 		log.Printf("Failed to query sessions: %v", err)
 		return
@@ -273,12 +263,13 @@ func reconcileSessions(database *sql.DB, mgr ptymgr.SessionManager, client *shep
 	type sessionInfo struct {
 		id           string
 		worktreePath string
+		pid          int
 	}
 	var orphanIDs []string
 	var alive []sessionInfo
 	for rows.Next() {
 		var si sessionInfo
-		if err := rows.Scan(&si.id, &si.worktreePath); err != nil {
+		if err := rows.Scan(&si.id, &si.worktreePath, &si.pid); err != nil {
 			continue
 		}
 		if _, ok := activeSet[si.id]; ok {
@@ -290,7 +281,7 @@ func reconcileSessions(database *sql.DB, mgr ptymgr.SessionManager, client *shep
 
 	// Mark orphaned sessions as stopped
 	for _, id := range orphanIDs {
-		database.Exec(`UPDATE sessions SET status = 'stopped' WHERE id = ?`, id)
+		database.Exec(`UPDATE sessions SET status = 'stopped', stopped_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
 	}
 	if len(orphanIDs) > 0 {
 		log.Printf("Marked %d orphaned sessions as stopped", len(orphanIDs))
@@ -298,30 +289,32 @@ func reconcileSessions(database *sql.DB, mgr ptymgr.SessionManager, client *shep
 
 	// Re-adopt alive sessions: refresh MCP config, register done channels
 	for _, si := range alive {
-		sessionID := si.id
+		sessionID, pid := si.id, si.pid
 		// Refresh .mcp.json so new MCP tools are available on reconnect
 		if si.worktreePath != "" {
 			api.WriteSessionMCPConfig(sessionID, si.worktreePath)
 		}
 		// Register the session in the client's done tracking
 		_ = client.Get(sessionID)
-		// Monitor for exit
+		// Monitor for exit, unless the CLI has been restarted since
 		go func() {
 			<-client.Done(sessionID)
-			database.Exec(`UPDATE sessions SET status = 'stopped' WHERE id = ?`, sessionID)
-			log.Printf("Session %s stopped (detected via shepherd)", sessionID)
+			res, err := database.Exec(`UPDATE sessions SET status = 'stopped', stopped_at = CURRENT_TIMESTAMP WHERE id = ? AND COALESCE(pid, 0) = ?`, sessionID, pid)
+			if err != nil {
+				return
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				log.Printf("Session %s stopped (detected via shepherd)", sessionID)
+			}
 		}()
 	}
 	if len(alive) > 0 {
 		log.Printf("Re-adopted %d sessions from shepherd", len(alive))
 	}
-
-	// Clean up worktrees for stopped sessions
-	cleanupWorktrees(database)
 }
 
 func cleanupStaleSessions(database *sql.DB) {
-	result, err := database.Exec(`UPDATE sessions SET status = 'stopped' WHERE status IN ('running', 'starting')`)
+	result, err := database.Exec(`UPDATE sessions SET status = 'stopped', stopped_at = CURRENT_TIMESTAMP WHERE status IN ('running', 'starting')`)
 	if err != nil {
 		log.Printf("Failed to clean up stale sessions: %v", err)
 		return
@@ -330,29 +323,93 @@ func cleanupStaleSessions(database *sql.DB) {
 	if rows > 0 {
 		log.Printf("Cleaned up %d stale sessions", rows)
 	}
+}
 
-	// Remove orphaned worktrees
-	cleanupWorktrees(database)
+// cleanupStaleWorkflowRuns marks runs interrupted by a server restart as failed.
+func cleanupStaleWorkflowRuns(database *sql.DB) {
+	result, err := database.Exec(`UPDATE workflow_runs SET status = 'failed', error = 'interrupted by server restart', finished_at = CURRENT_TIMESTAMP WHERE status = 'running'`)
+	if err != nil {
+		log.Printf("Failed to clean up stale workflow runs: %v", err)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		log.Printf("Marked %d interrupted workflow runs as failed", rows)
+	}
+}
+
+// cleanupStaleClones fails repository clones interrupted by a server restart.
+func cleanupStaleClones(database *sql.DB) {
+	database.Exec(`UPDATE repositories SET clone_status = 'error', clone_error = 'interrupted by server restart' WHERE clone_status = 'cloning'`)
 }
 
-func cleanupWorktrees(database *sql.DB) {
-	rows, err := database.Query(`SELECT s.worktree_path, r.local_path FROM sessions s JOIN repositories r ON s.repo_id = r.id WHERE s.status = 'stopped' AND s.worktree_path != ''`)
+// cleanupStaleSessionSetup fails session setups interrupted by a server restart.
+func cleanupStaleSessionSetup(database *sql.DB) {
+	database.Exec(`UPDATE session_setup SET status = 'failed', error = 'interrupted by server restart' WHERE status = 'running'`)
+	database.Exec(`UPDATE sessions SET status = 'setup_failed' WHERE id IN (SELECT session_id FROM session_setup WHERE status = 'failed') AND status = 'stopped'`)
+}
+
+// configureRepoCredentials points every cloned repo at the credential
+// helper, removing credentials embedded in its origin URL.
+func configureRepoCredentials(database *sql.DB) {
+	rows, err := database.Query(`SELECT local_path FROM repositories WHERE repo_type != 'local' AND local_path != ''`)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var wtPath, repoPath string
-		if err := rows.Scan(&wtPath, &repoPath); err != nil {
+		var repoPath string
+		if err := rows.Scan(&repoPath); err != nil {
 			continue
 		}
-		if _, err := os.Stat(wtPath); err == nil {
-			if err := gitops.RemoveWorktree(repoPath, wtPath); err != nil {
-				log.Printf("Failed to remove worktree %s: %v", wtPath, err)
+		if err := gitops.ConfigureCredentials(repoPath); err != nil {
+			log.Printf("Failed to configure credentials for %s: %v", repoPath, err)
+		}
+	}
+}
+
+// encryptPlaintextSecrets encrypts stored secret values that aren't
+// encrypted yet: secret settings, session env vars, webhook secrets,
+// repository tokens, session template env vars and repository configs.
+func encryptPlaintextSecrets(database *sql.DB) error {
+	columns := []struct{ table, column, where string }{
+		{"settings", "value", "secret = 1"},
+		{"session_env", "value", "1"},
+		{"webhooks", "secret", "1"},
+		{"repositories", "auth_token", "1"},
+		{"secrets", "value", "1"},
+		{"session_templates", "env", "1"},
+		{"repo_config", "config", "1"},
+	}
+	for _, c := range columns {
+		rows, err := database.Query(fmt.Sprintf(`SELECT rowid, %s FROM %s WHERE %s AND %s != ''`, c.column, c.table, c.where, c.column))
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.table, err)
+		}
+		plaintext := map[int64]string{}
+		for rows.Next() {
+			var rowid int64
+			var value string
+			if err := rows.Scan(&rowid, &value); err == nil && !secrets.IsEncrypted(value) {
+				plaintext[rowid] = value
+			}
+		}
+		rows.Close()
+
+		for rowid, value := range plaintext {
+			enc, err := secrets.Encrypt(value)
+			if err != nil {
+				return err
+			}
+			if _, err := database.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, c.table, c.column), enc, rowid); err != nil {
+				return fmt.Errorf("%s: %w", c.table, err)
 			}
 		}
+		if len(plaintext) > 0 {
+			log.Printf("Encrypted %d %s.%s value(s)", len(plaintext), c.table, c.column)
+		}
 	}
+	return nil
 }
 
 // reconcileOrchestratorSessions reconciles orchestrator_sessions with the shepherd.
@@ -453,6 +510,13 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Implement http.Flusher so server-sent event streams work through the middleware.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // Implement http.Hijacker so WebSocket upgrades work through the middleware.
 func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hj, ok := rw.ResponseWriter.(http.Hijacker); ok {
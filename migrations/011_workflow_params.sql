@@ -0,0 +1,2 @@
+ALTER TABLE workflows ADD COLUMN params TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE workflow_runs ADD COLUMN params TEXT NOT NULL DEFAULT '{}';
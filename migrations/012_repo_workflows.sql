@@ -0,0 +1,7 @@
+-- Workflows discovered from .superposition/workflows/*.yaml in a repository.
+-- repo_id is NULL for workflows created through the API.
+ALTER TABLE workflows ADD COLUMN repo_id INTEGER REFERENCES repositories(id) ON DELETE CASCADE;
+ALTER TABLE workflows ADD COLUMN path TEXT NOT NULL DEFAULT '';
+ALTER TABLE workflows ADD COLUMN error TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workflows_repo_path ON workflows(repo_id, path) WHERE repo_id IS NOT NULL;
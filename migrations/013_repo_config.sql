@@ -0,0 +1,16 @@
+-- Per-repository session defaults and setup hooks, overriding the repo's
+-- checked-in .superposition.yaml.
+CREATE TABLE IF NOT EXISTS repo_config (
+    repo_id INTEGER PRIMARY KEY REFERENCES repositories(id) ON DELETE CASCADE,
+    config TEXT NOT NULL DEFAULT '{}',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Output of a session's setup commands, run in the worktree before the CLI starts.
+CREATE TABLE IF NOT EXISTS session_setup (
+    session_id TEXT PRIMARY KEY REFERENCES sessions(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'running',
+    log TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,14 @@
+-- Saved session setups that can be launched repeatedly: repo, branches, CLI,
+-- env, MCP servers and an initial prompt typed in once the CLI is ready.
+CREATE TABLE IF NOT EXISTS session_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    repo_id INTEGER REFERENCES repositories(id) ON DELETE CASCADE,
+    source_branch TEXT NOT NULL DEFAULT '',
+    branch_pattern TEXT NOT NULL DEFAULT '',
+    cli_type TEXT NOT NULL DEFAULT '',
+    env TEXT NOT NULL DEFAULT '{}',
+    mcp_servers TEXT NOT NULL DEFAULT '{}',
+    prompt TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- Sessions created together by POST /api/sessions/batch share a batch ID.
+ALTER TABLE sessions ADD COLUMN batch_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_sessions_batch_id ON sessions(batch_id);
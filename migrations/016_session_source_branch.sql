@@ -0,0 +1,3 @@
+-- The branch a session's worktree was created from, used as the base for
+-- its diffs. Empty for sessions created before this was recorded.
+ALTER TABLE sessions ADD COLUMN source_branch TEXT NOT NULL DEFAULT '';
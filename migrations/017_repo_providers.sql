@@ -0,0 +1,13 @@
+-- Repositories from GitLab, Gitea and plain git remotes. clone_url is the
+-- remote as given (HTTPS or SSH). auth_username/auth_token are credentials
+-- for a plain HTTPS remote and ssh_key_path the private key for an SSH
+-- remote; provider repos use the provider's token setting instead.
+ALTER TABLE repositories ADD COLUMN clone_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN auth_username TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN auth_token TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN ssh_key_path TEXT NOT NULL DEFAULT '';
+
+UPDATE repositories SET clone_url = 'https://github.com/' || owner || '/' || name || '.git'
+    WHERE repo_type = 'github';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_repositories_clone_url ON repositories(clone_url) WHERE clone_url != '';
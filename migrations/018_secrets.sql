@@ -0,0 +1,14 @@
+-- Secret settings are encrypted at rest and redacted by the settings API.
+-- Existing values are encrypted at startup, since that needs the key.
+ALTER TABLE settings ADD COLUMN secret BOOLEAN NOT NULL DEFAULT 0;
+UPDATE settings SET secret = 1
+    WHERE key IN ('github_pat', 'gitlab_token', 'gitea_token', 'github_webhook_secret');
+
+-- Named secrets that env vars can reference as ${secret:NAME}. Values are
+-- encrypted.
+CREATE TABLE IF NOT EXISTS secrets (
+    name TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,11 @@
+-- Named sets of env vars applied to every session (repo_id NULL) or to every
+-- session of one repository. env is a JSON object, encrypted.
+CREATE TABLE IF NOT EXISTS env_profiles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    repo_id INTEGER REFERENCES repositories(id) ON DELETE CASCADE,
+    env TEXT NOT NULL DEFAULT '{}',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_env_profiles_name ON env_profiles(COALESCE(repo_id, 0), name);
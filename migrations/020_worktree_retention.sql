@@ -0,0 +1,4 @@
+-- When a session last stopped, used to expire its worktree. Sessions stopped
+-- before this migration count from now.
+ALTER TABLE sessions ADD COLUMN stopped_at DATETIME;
+UPDATE sessions SET stopped_at = CURRENT_TIMESTAMP WHERE status NOT IN ('running', 'starting');
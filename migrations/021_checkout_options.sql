@@ -0,0 +1,9 @@
+-- Options for large repositories. clone_filter is a partial clone filter
+-- (e.g. blob:none) and clone_depth a shallow clone depth, applied when the
+-- repository is cloned. sparse_paths is a JSON array of directories to check
+-- out in session worktrees (empty for all); sessions record the paths they
+-- were created with, which may override the repository's.
+ALTER TABLE repositories ADD COLUMN clone_filter TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN clone_depth INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE repositories ADD COLUMN sparse_paths TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE sessions ADD COLUMN sparse_paths TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,12 @@
+-- Background repository sync. sync_interval_minutes overrides the
+-- repo_sync_interval_minutes setting (NULL uses it, 0 disables syncing).
+-- last_sync_at is the last attempt, whose error (or '') is last_sync_error;
+-- last_sync_result is the JSON report of the last successful sync.
+ALTER TABLE repositories ADD COLUMN sync_interval_minutes INTEGER;
+ALTER TABLE repositories ADD COLUMN last_sync_at DATETIME;
+ALTER TABLE repositories ADD COLUMN last_sync_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN last_sync_result TEXT NOT NULL DEFAULT '';
+
+-- Commits the session's source branch has that its branch doesn't, as of
+-- the last sync.
+ALTER TABLE sessions ADD COLUMN source_behind INTEGER NOT NULL DEFAULT 0;
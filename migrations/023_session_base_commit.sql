@@ -0,0 +1,4 @@
+-- The source branch commit a session's branch is based on: where it forked
+-- when the session was created, moved by rebasing or merging the source
+-- branch into it. Older sessions leave it empty.
+ALTER TABLE sessions ADD COLUMN base_commit TEXT NOT NULL DEFAULT '';
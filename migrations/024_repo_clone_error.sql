@@ -0,0 +1,2 @@
+-- Why a repository's clone failed, shown alongside clone_status 'error'.
+ALTER TABLE repositories ADD COLUMN clone_error TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,140 @@
+import { useState, useEffect, useCallback } from "react";
+import { api, type DiskUsage } from "../lib/api";
+import { useToast } from "./Toast";
+
+function formatSize(bytes: number): string {
+  if (bytes < 1024) return `${bytes} B`;
+  if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+  if (bytes < 1024 * 1024 * 1024) return `${(bytes / (1024 * 1024)).toFixed(1)} MB`;
+  return `${(bytes / (1024 * 1024 * 1024)).toFixed(2)} GB`;
+}
+
+export default function DiskUsagePanel() {
+  const [usage, setUsage] = useState<DiskUsage | null>(null);
+  const [quota, setQuota] = useState("");
+  const [busy, setBusy] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+  const { toast } = useToast();
+
+  const load = useCallback((refresh = false) => {
+    setError(null);
+    api
+      .getDiskUsage(refresh)
+      .then(setUsage)
+      .catch((err: unknown) =>
+        setError(err instanceof Error ? err.message : "Failed to load"),
+      );
+  }, []);
+
+  useEffect(() => {
+    load();
+    api
+      .getSetting("disk_quota_gb")
+      .then((s) => setQuota(s.value))
+      .catch(() => {});
+  }, [load]);
+
+  const saveQuota = async () => {
+    try {
+      if (quota.trim()) {
+        await api.putSetting("disk_quota_gb", quota.trim());
+      } else {
+        await api.deleteSetting("disk_quota_gb").catch(() => {});
+      }
+      toast("Quota saved", "success");
+      load();
+    } catch (e: any) {
+      toast(e.message, "error");
+    }
+  };
+
+  const runMaintenance = async () => {
+    setBusy(true);
+    try {
+      const results = await api.runMaintenance();
+      const freed = results.reduce((n, r) => n + r.size_before - r.size_after, 0);
+      const failed = results.filter((r) => r.error).length;
+      toast(
+        `Maintained ${results.length} repositories${freed > 0 ? `, freed ${formatSize(freed)}` : ""}${failed ? `, ${failed} failed` : ""}`,
+        failed ? "error" : "success",
+      );
+      load(true);
+    } catch (e: any) {
+      toast(e.message, "error");
+    } finally {
+      setBusy(false);
+    }
+  };
+
+  const largest = usage
+    ? [...usage.sessions].sort((a, b) => b.size - a.size).slice(0, 5)
+    : [];
+
+  return (
+    <div className="space-y-4">
+      {error && <p className="text-xs text-red-400">{error}</p>}
+      {usage && (
+        <div className="space-y-3">
+          <p className={`text-sm ${usage.over_quota ? "text-red-400" : "text-zinc-300"}`}>
+            {formatSize(usage.total)} used
+            {usage.quota > 0 && ` of ${formatSize(usage.quota)}`}
+            {usage.over_quota && " — new sessions and repositories are blocked"}
+          </p>
+          <div className="grid grid-cols-2 gap-x-4 gap-y-1 text-xs text-zinc-400">
+            {Object.entries(usage.dirs)
+              .sort(([, a], [, b]) => b - a)
+              .map(([name, size]) => (
+                <div key={name} className="flex justify-between">
+                  <span className="font-mono">{name}</span>
+                  <span>{formatSize(size)}</span>
+                </div>
+              ))}
+          </div>
+          {largest.length > 0 && (
+            <div>
+              <p className="text-[10px] uppercase tracking-wider text-zinc-500 mb-1">
+                Largest worktrees
+              </p>
+              {largest.map((s) => (
+                <div key={s.id} className="flex justify-between text-xs text-zinc-400">
+                  <span className="truncate">
+                    {s.branch} <span className="text-zinc-600">({s.status})</span>
+                  </span>
+                  <span>{formatSize(s.size)}</span>
+                </div>
+              ))}
+            </div>
+          )}
+        </div>
+      )}
+
+      <div className="flex items-end gap-2">
+        <div className="flex-1">
+          <label className="block text-xs text-zinc-500 mb-1">Quota (GB)</label>
+          <input
+            type="number"
+            min={0}
+            step="any"
+            value={quota}
+            onChange={(e) => setQuota(e.target.value)}
+            placeholder="No quota"
+            className="w-full bg-zinc-900 border border-zinc-700 rounded-lg px-3 py-2 text-sm focus:outline-none focus:border-zinc-500"
+          />
+        </div>
+        <button
+          onClick={saveQuota}
+          className="px-4 py-2 text-sm bg-zinc-800 hover:bg-zinc-700 rounded-lg transition-colors"
+        >
+          Save
+        </button>
+        <button
+          onClick={runMaintenance}
+          disabled={busy}
+          className="px-4 py-2 text-sm bg-zinc-800 hover:bg-zinc-700 disabled:opacity-40 rounded-lg transition-colors"
+        >
+          {busy ? "Running..." : "Run git gc"}
+        </button>
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,249 @@
+import { useState, useEffect, useCallback } from "react";
+import { api, type EnvProfile } from "../lib/api";
+
+// Env vars are edited as KEY=value lines.
+function formatEnv(env: Record<string, string>): string {
+  return Object.entries(env)
+    .map(([k, v]) => `${k}=${v}`)
+    .join("\n");
+}
+
+function parseEnv(text: string): Record<string, string> {
+  const env: Record<string, string> = {};
+  for (const line of text.split("\n")) {
+    const trimmed = line.trim();
+    if (!trimmed || trimmed.startsWith("#")) continue;
+    const eq = trimmed.indexOf("=");
+    if (eq <= 0) continue;
+    env[trimmed.slice(0, eq).trim()] = trimmed.slice(eq + 1);
+  }
+  return env;
+}
+
+interface ProfileFormProps {
+  initial?: EnvProfile;
+  repos: { id: number; owner: string; name: string }[];
+  onSave: (data: Partial<EnvProfile>) => Promise<void>;
+  onCancel: () => void;
+}
+
+function ProfileForm({ initial, repos, onSave, onCancel }: ProfileFormProps) {
+  const [name, setName] = useState(initial?.name ?? "");
+  const [repoId, setRepoId] = useState<number | null>(initial?.repo_id ?? null);
+  const [envText, setEnvText] = useState(formatEnv(initial?.env ?? {}));
+  const [saving, setSaving] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+
+  const handleSubmit = async () => {
+    if (!name.trim()) return;
+    setSaving(true);
+    setError(null);
+    try {
+      await onSave({ name: name.trim(), repo_id: repoId, env: parseEnv(envText) });
+    } catch (err: unknown) {
+      setError(err instanceof Error ? err.message : "Failed to save");
+    } finally {
+      setSaving(false);
+    }
+  };
+
+  return (
+    <div className="border border-zinc-700 rounded-lg p-3 space-y-3">
+      <div className="flex gap-2">
+        <div className="flex-1">
+          <label className="block text-[10px] uppercase tracking-wider text-zinc-500 mb-1">
+            Name
+          </label>
+          <input
+            value={name}
+            onChange={(e) => setName(e.target.value)}
+            placeholder="proxy"
+            className="w-full bg-zinc-900 border border-zinc-700 rounded px-2 py-1 text-xs text-zinc-200 focus:outline-none focus:border-zinc-500"
+          />
+        </div>
+        <div className="flex-1">
+          <label className="block text-[10px] uppercase tracking-wider text-zinc-500 mb-1">
+            Applies to
+          </label>
+          <select
+            value={repoId ?? ""}
+            onChange={(e) =>
+              setRepoId(e.target.value ? Number(e.target.value) : null)
+            }
+            className="w-full bg-zinc-900 border border-zinc-700 rounded px-2 py-1 text-xs text-zinc-200 focus:outline-none focus:border-zinc-500"
+          >
+            <option value="">All sessions</option>
+            {repos.map((r) => (
+              <option key={r.id} value={r.id}>
+                {r.owner}/{r.name}
+              </option>
+            ))}
+          </select>
+        </div>
+      </div>
+
+      <div>
+        <label className="block text-[10px] uppercase tracking-wider text-zinc-500 mb-1">
+          Variables
+        </label>
+        <textarea
+          value={envText}
+          onChange={(e) => setEnvText(e.target.value)}
+          rows={5}
+          placeholder={"HTTPS_PROXY=http://proxy:3128\nOPENAI_API_KEY=${secret:OPENAI_API_KEY}"}
+          className="w-full bg-zinc-900 border border-zinc-700 rounded px-2 py-1 text-xs text-zinc-200 font-mono focus:outline-none focus:border-zinc-500"
+        />
+        {initial && (
+          <p className="text-[10px] text-zinc-600 mt-1">
+            Saved values are shown as &lt;redacted&gt; and kept unless you
+            replace them.
+          </p>
+        )}
+      </div>
+
+      {error && <p className="text-[10px] text-red-400">{error}</p>}
+
+      <div className="flex gap-2 pt-1">
+        <button
+          onClick={handleSubmit}
+          disabled={!name.trim() || saving}
+          className="px-3 py-1 text-xs bg-blue-600 hover:bg-blue-500 disabled:opacity-40 disabled:cursor-not-allowed text-white rounded transition-colors"
+        >
+          {saving ? "Saving..." : initial ? "Save" : "Add"}
+        </button>
+        <button
+          onClick={onCancel}
+          className="px-3 py-1 text-xs text-zinc-400 hover:text-zinc-200 transition-colors"
+        >
+          Cancel
+        </button>
+      </div>
+    </div>
+  );
+}
+
+export default function EnvProfileManager() {
+  const [profiles, setProfiles] = useState<EnvProfile[]>([]);
+  const [repos, setRepos] = useState<{ id: number; owner: string; name: string }[]>([]);
+  const [loading, setLoading] = useState(true);
+  const [error, setError] = useState<string | null>(null);
+  const [editingId, setEditingId] = useState<number | null>(null);
+  const [showAddForm, setShowAddForm] = useState(false);
+
+  const load = useCallback(() => {
+    setLoading(true);
+    setError(null);
+    Promise.all([api.getEnvProfiles(), api.getRepos()])
+      .then(([p, r]) => {
+        setProfiles(p);
+        setRepos(r);
+      })
+      .catch((err: unknown) =>
+        setError(err instanceof Error ? err.message : "Failed to load"),
+      )
+      .finally(() => setLoading(false));
+  }, []);
+
+  useEffect(() => {
+    load();
+  }, [load]);
+
+  const repoName = (id: number | null) => {
+    if (id === null) return "All sessions";
+    const r = repos.find((r) => r.id === id);
+    return r ? `${r.owner}/${r.name}` : `repo ${id}`;
+  };
+
+  const handleCreate = async (data: Partial<EnvProfile>) => {
+    await api.createEnvProfile(data);
+    setShowAddForm(false);
+    load();
+  };
+
+  const handleUpdate = async (id: number, data: Partial<EnvProfile>) => {
+    await api.updateEnvProfile(id, data);
+    setEditingId(null);
+    load();
+  };
+
+  const handleDelete = async (id: number) => {
+    try {
+      await api.deleteEnvProfile(id);
+      setProfiles((prev) => prev.filter((p) => p.id !== id));
+    } catch (err: unknown) {
+      setError(err instanceof Error ? err.message : "Delete failed");
+    }
+  };
+
+  if (loading) {
+    return <p className="text-xs text-zinc-500">Loading...</p>;
+  }
+
+  return (
+    <div className="space-y-2">
+      {error && <p className="text-xs text-red-400">{error}</p>}
+
+      {profiles.length === 0 && !showAddForm && (
+        <p className="text-xs text-zinc-600">No env profiles.</p>
+      )}
+
+      {profiles.map((p) =>
+        editingId === p.id ? (
+          <ProfileForm
+            key={p.id}
+            initial={p}
+            repos={repos}
+            onSave={(data) => handleUpdate(p.id, data)}
+            onCancel={() => setEditingId(null)}
+          />
+        ) : (
+          <div
+            key={p.id}
+            className="border border-zinc-800 rounded-lg px-3 py-2 flex items-start justify-between gap-2"
+          >
+            <div className="min-w-0">
+              <div className="text-sm text-zinc-200">
+                {p.name}{" "}
+                <span className="text-[10px] text-zinc-500">
+                  {repoName(p.repo_id)}
+                </span>
+              </div>
+              <div className="text-[10px] text-zinc-500 font-mono truncate">
+                {Object.keys(p.env).join(", ") || "no variables"}
+              </div>
+            </div>
+            <div className="flex gap-2 shrink-0">
+              <button
+                onClick={() => setEditingId(p.id)}
+                className="text-[10px] text-zinc-500 hover:text-zinc-300"
+              >
+                Edit
+              </button>
+              <button
+                onClick={() => handleDelete(p.id)}
+                className="text-[10px] text-zinc-500 hover:text-red-400"
+              >
+                Delete
+              </button>
+            </div>
+          </div>
+        ),
+      )}
+
+      {showAddForm ? (
+        <ProfileForm
+          repos={repos}
+          onSave={handleCreate}
+          onCancel={() => setShowAddForm(false)}
+        />
+      ) : (
+        <button
+          onClick={() => setShowAddForm(true)}
+          className="text-xs text-zinc-500 hover:text-zinc-300"
+        >
+          + Add env profile
+        </button>
+      )}
+    </div>
+  );
+}
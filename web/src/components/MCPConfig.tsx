@@ -3,6 +3,8 @@ import { api, type MCPConfig as MCPConfigType, type MCPServerConfig } from "../l
 
 interface MCPConfigProps {
   sessionId: string;
+  // Called after the session's CLI is restarted to apply new env vars.
+  onRestarted?: () => void;
 }
 
 interface EditingServer {
@@ -147,7 +149,7 @@ function ServerForm({
   );
 }
 
-export default function MCPConfig({ sessionId }: MCPConfigProps) {
+export default function MCPConfig({ sessionId, onRestarted }: MCPConfigProps) {
   const [config, setConfig] = useState<MCPConfigType | null>(null);
   const [loading, setLoading] = useState(true);
   const [saving, setSaving] = useState(false);
@@ -159,6 +161,8 @@ export default function MCPConfig({ sessionId }: MCPConfigProps) {
   const [envPairs, setEnvPairs] = useState<[string, string][]>([["", ""]]);
   const [editingEnv, setEditingEnv] = useState(false);
   const [savingEnv, setSavingEnv] = useState(false);
+  // Set after saving env vars, until the CLI is restarted to pick them up.
+  const [envNeedsRestart, setEnvNeedsRestart] = useState(false);
 
   const loadConfig = useCallback(() => {
     setLoading(true);
@@ -233,6 +237,7 @@ export default function MCPConfig({ sessionId }: MCPConfigProps) {
       const saved = await api.updateSessionEnv(sessionId, newEnv);
       setEnvVars(saved);
       setEditingEnv(false);
+      setEnvNeedsRestart(true);
     } catch (err: unknown) {
       setError(err instanceof Error ? err.message : "Save failed");
     } finally {
@@ -240,6 +245,19 @@ export default function MCPConfig({ sessionId }: MCPConfigProps) {
     }
   }, [sessionId, envPairs]);
 
+  const handleRestartWithEnv = useCallback(async () => {
+    setSavingEnv(true);
+    try {
+      await api.updateSessionEnv(sessionId, envVars, true);
+      setEnvNeedsRestart(false);
+      onRestarted?.();
+    } catch (err: unknown) {
+      setError(err instanceof Error ? err.message : "Restart failed");
+    } finally {
+      setSavingEnv(false);
+    }
+  }, [sessionId, envVars, onRestarted]);
+
   const servers = config ? Object.entries(config.mcpServers) : [];
 
   return (
@@ -378,6 +396,29 @@ export default function MCPConfig({ sessionId }: MCPConfigProps) {
               )}
             </div>
 
+            {envNeedsRestart && !editingEnv && (
+              <div className="flex items-center justify-between gap-2 mb-2 px-2 py-1.5 rounded bg-zinc-900 border border-zinc-800">
+                <span className="text-[10px] text-zinc-400">
+                  The running CLI still has the old environment.
+                </span>
+                <div className="flex gap-2 shrink-0">
+                  <button
+                    onClick={handleRestartWithEnv}
+                    disabled={savingEnv}
+                    className="text-[10px] text-blue-400 hover:text-blue-300 disabled:opacity-40"
+                  >
+                    {savingEnv ? "Restarting..." : "Restart CLI"}
+                  </button>
+                  <button
+                    onClick={() => setEnvNeedsRestart(false)}
+                    className="text-[10px] text-zinc-500 hover:text-zinc-300"
+                  >
+                    Later
+                  </button>
+                </div>
+              </div>
+            )}
+
             {!editingEnv ? (
               Object.keys(envVars).length === 0 ? (
                 <p className="text-xs text-zinc-600 py-1">
@@ -7,6 +7,7 @@ interface Repo {
   name: string;
   clone_status: string;
   default_branch: string;
+  sparse_paths: string[] | null;
 }
 
 interface Props {
@@ -21,6 +22,7 @@ export default function NewSessionModal({ open, onClose, onCreated }: Props) {
   const [sourceBranch, setSourceBranch] = useState("");
   const [newBranch, setNewBranch] = useState("");
   const [branches, setBranches] = useState<string[]>([]);
+  const [sparsePaths, setSparsePaths] = useState("");
   const [cliType, setCliType] = useState<"claude" | "codex" | "gemini">(
     "claude",
   );
@@ -60,6 +62,7 @@ export default function NewSessionModal({ open, onClose, onCreated }: Props) {
           "main";
         setSourceBranch(defaultBranch);
         setNewBranch(autoBranchName);
+        setSparsePaths((repo?.sparse_paths ?? []).join(", "));
       });
     }
   }, [repoId, repos]);
@@ -76,6 +79,10 @@ export default function NewSessionModal({ open, onClose, onCreated }: Props) {
         sourceBranch,
         newBranch.trim(),
         cliType,
+        sparsePaths
+          .split(/[\s,]+/)
+          .map((p) => p.trim())
+          .filter(Boolean),
       );
       onCreated(session);
       onClose();
@@ -158,6 +165,23 @@ export default function NewSessionModal({ open, onClose, onCreated }: Props) {
             />
           </div>
 
+          <div>
+            <label className="block text-sm font-medium mb-1">
+              Sparse Checkout Paths
+            </label>
+            <input
+              type="text"
+              value={sparsePaths}
+              onChange={(e) => setSparsePaths(e.target.value)}
+              placeholder="Everything"
+              className="w-full px-3 py-2.5 bg-zinc-800 border border-zinc-700 rounded-md text-sm placeholder-zinc-600 focus:outline-none focus:ring-1 focus:ring-blue-500"
+            />
+            <p className="text-xs text-zinc-500 mt-1">
+              Directories to check out, comma separated. Leave empty for the
+              whole repo.
+            </p>
+          </div>
+
           <div>
             <label className="block text-sm font-medium mb-1">CLI</label>
             <div className="flex gap-2">
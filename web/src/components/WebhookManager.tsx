@@ -4,8 +4,14 @@ import { api, type Webhook } from "../lib/api";
 const ALL_EVENTS = [
   "session.created",
   "session.stopped",
+  "session.restarted",
+  "session.archived",
+  "session.restored",
+  "session.base_updated",
   "session.error",
   "session.idle",
+  "repo.synced",
+  "repo.sync_failed",
 ];
 
 function generateSecret(): string {
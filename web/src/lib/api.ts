@@ -57,6 +57,18 @@ export const api = {
   deleteSetting: (key: string) =>
     request<void>(`/api/settings/${key}`, { method: "DELETE" }),
 
+  // Secrets (values are write-only; env vars reference them as ${secret:NAME})
+  getSecrets: () => request<SecretInfo[]>("/api/secrets"),
+  putSecret: (name: string, value: string) =>
+    request<SecretInfo>(`/api/secrets/${encodeURIComponent(name)}`, {
+      method: "PUT",
+      body: JSON.stringify({ value }),
+    }),
+  deleteSecret: (name: string) =>
+    request<void>(`/api/secrets/${encodeURIComponent(name)}`, {
+      method: "DELETE",
+    }),
+
   // GitHub repos
   getGitHubRepos: (query?: string, refresh?: boolean) => {
     const params = new URLSearchParams();
@@ -65,18 +77,39 @@ export const api = {
     const qs = params.toString();
     return request<any[]>(`/api/github/repos${qs ? `?${qs}` : ""}`);
   },
+  getProviderRepos: (
+    provider: "github" | "gitlab" | "gitea",
+    query?: string,
+    refresh?: boolean,
+  ) => {
+    const params = new URLSearchParams();
+    if (query) params.set("q", query);
+    if (refresh) params.set("refresh", "true");
+    const qs = params.toString();
+    return request<any[]>(`/api/providers/${provider}/repos${qs ? `?${qs}` : ""}`);
+  },
 
   // Repos
   getRepos: () => request<any[]>("/api/repos"),
-  addRepo: (githubUrl: string) =>
+  addRepo: (githubUrl: string, opts?: CheckoutOptions) =>
     request<any>("/api/repos", {
       method: "POST",
-      body: JSON.stringify({ github_url: githubUrl }),
+      body: JSON.stringify({ github_url: githubUrl, ...opts }),
     }),
-  addLocalRepo: (path: string) =>
+  addRemoteRepo: (remote: RemoteRepo) =>
     request<any>("/api/repos", {
       method: "POST",
-      body: JSON.stringify({ local_path: path }),
+      body: JSON.stringify(remote),
+    }),
+  addLocalRepo: (path: string, opts?: CheckoutOptions) =>
+    request<any>("/api/repos", {
+      method: "POST",
+      body: JSON.stringify({ local_path: path, ...opts }),
+    }),
+  updateRepo: (id: number, update: { sync_interval_minutes: number | null }) =>
+    request<any>(`/api/repos/${id}`, {
+      method: "PATCH",
+      body: JSON.stringify(update),
     }),
   deleteRepo: (id: number) =>
     request<void>(`/api/repos/${id}`, { method: "DELETE" }),
@@ -84,6 +117,13 @@ export const api = {
     request<any>(`/api/repos/${id}/sync`, { method: "POST" }),
   getRepoBranches: (id: number) =>
     request<string[]>(`/api/repos/${id}/branches`),
+  getRepoConfig: (id: number) =>
+    request<RepoConfigResponse>(`/api/repos/${id}/config`),
+  updateRepoConfig: (id: number, config: RepoConfig) =>
+    request<RepoConfig>(`/api/repos/${id}/config`, {
+      method: "PUT",
+      body: JSON.stringify(config),
+    }),
 
   // Sessions
   getSessions: () => request<any[]>("/api/sessions"),
@@ -92,6 +132,7 @@ export const api = {
     sourceBranch: string,
     newBranch: string,
     cliType: string,
+    sparsePaths?: string[],
   ) =>
     request<any>("/api/sessions", {
       method: "POST",
@@ -100,12 +141,172 @@ export const api = {
         source_branch: sourceBranch,
         new_branch: newBranch,
         cli_type: cliType,
+        sparse_paths: sparsePaths,
       }),
     }),
-  deleteSession: (id: string, deleteLocal = true) =>
-    request<void>(`/api/sessions/${id}?delete_local=${deleteLocal}`, {
-      method: "DELETE",
+  createSessionFromTemplate: (
+    templateId: number,
+    overrides: {
+      repo_id?: number;
+      source_branch?: string;
+      new_branch?: string;
+      cli_type?: string;
+      prompt?: string;
+    } = {},
+  ) =>
+    request<any>("/api/sessions", {
+      method: "POST",
+      body: JSON.stringify({ template_id: templateId, ...overrides }),
+    }),
+  createSessionBatch: (batch: SessionBatchRequest) =>
+    request<SessionBatchResponse>("/api/sessions/batch", {
+      method: "POST",
+      body: JSON.stringify(batch),
+    }),
+  createSessionFromIssue: (
+    repoId: number,
+    issueNumber: number,
+    opts: {
+      cli_type?: string;
+      source_branch?: string;
+      new_branch?: string;
+      template_id?: number;
+    } = {},
+  ) =>
+    request<{ session: any; issue: Issue }>("/api/sessions/from-issue", {
+      method: "POST",
+      body: JSON.stringify({ repo_id: repoId, issue_number: issueNumber, ...opts }),
+    }),
+  createSessionFromPR: (repoId: number, prNumber: number, cliType?: string) =>
+    request<{ session: any; pull_request: PullRequest; threads: ReviewThread[] }>(
+      "/api/sessions/from-pr",
+      {
+        method: "POST",
+        body: JSON.stringify({ repo_id: repoId, pr_number: prNumber, cli_type: cliType }),
+      },
+    ),
+  getSessionDiff: (id: string, path?: string) =>
+    request<SessionDiff>(
+      `/api/sessions/${id}/diff${path ? `?path=${encodeURIComponent(path)}` : ""}`,
+    ),
+  compareSessions: (a: string, b: string, path?: string) =>
+    request<SessionComparison>(
+      `/api/sessions/compare?a=${a}&b=${b}${path ? `&path=${encodeURIComponent(path)}` : ""}`,
+    ),
+  getSessionGitStatus: (id: string) =>
+    request<GitStatus>(`/api/sessions/${id}/git/status`),
+  getSessionGitDiff: (
+    id: string,
+    opts: { mode?: "worktree" | "staged" | "unstaged" | "base"; path?: string; context?: number } = {},
+  ) => {
+    const params = new URLSearchParams();
+    if (opts.mode) params.set("mode", opts.mode);
+    if (opts.path) params.set("path", opts.path);
+    if (opts.context !== undefined) params.set("context", String(opts.context));
+    return request<GitDiff>(`/api/sessions/${id}/git/diff?${params}`);
+  },
+  getSessionGitLog: (id: string, limit = 50, sinceBase = false) =>
+    request<GitCommit[]>(
+      `/api/sessions/${id}/git/log?limit=${limit}${sinceBase ? "&since_base=true" : ""}`,
+    ),
+  getSessionGitShow: (id: string, rev: string) =>
+    request<{ commit: GitCommit; files: GitFileDiff[]; truncated: boolean }>(
+      `/api/sessions/${id}/git/show?rev=${encodeURIComponent(rev)}`,
+    ),
+  commitSession: (id: string, message: string, all = true) =>
+    request<{ committed: boolean; commit?: GitCommit }>(
+      `/api/sessions/${id}/git/commit`,
+      { method: "POST", body: JSON.stringify({ message, all }) },
+    ),
+  pushSession: (id: string, force = false) =>
+    request<{ branch: string; commit: string }>(`/api/sessions/${id}/git/push`, {
+      method: "POST",
+      body: JSON.stringify({ force }),
+    }),
+  // Rebase the session's branch onto its source branch, or merge the source
+  // branch into it. Conflicts fail with 409; leaveConflicts keeps the
+  // operation in progress for the session's CLI to resolve.
+  updateSessionBase: (
+    id: string,
+    method: "rebase" | "merge",
+    leaveConflicts = false,
+  ) =>
+    request<BaseUpdate>(
+      `/api/sessions/${id}/git/${method === "rebase" ? "rebase" : "merge-base-update"}`,
+      {
+        method: "POST",
+        body: JSON.stringify({ leave_conflicts: leaveConflicts }),
+      },
+    ),
+  openPullRequest: (
+    id: string,
+    pr: { title: string; body?: string; base?: string; draft?: boolean },
+  ) =>
+    request<PullRequest>(`/api/sessions/${id}/pull-request`, {
+      method: "POST",
+      body: JSON.stringify(pr),
     }),
+  getSessionPullRequest: (id: string) =>
+    request<{ pull_request: PullRequest | null; checks: CheckStatus | null }>(
+      `/api/sessions/${id}/pull-request`,
+    ),
+  updateSessionPullRequest: (
+    id: string,
+    update: { title?: string; body?: string; base?: string; state?: "open" | "closed" },
+  ) =>
+    request<PullRequest>(`/api/sessions/${id}/pull-request`, {
+      method: "PATCH",
+      body: JSON.stringify(update),
+    }),
+  commentOnSessionPullRequest: (id: string, body: string) =>
+    request<any>(`/api/sessions/${id}/pull-request/comments`, {
+      method: "POST",
+      body: JSON.stringify({ body }),
+    }),
+  getSessionSetup: (id: string) =>
+    request<SessionSetup>(`/api/sessions/${id}/setup`),
+  // Session templates
+  getSessionTemplates: () =>
+    request<SessionTemplate[]>("/api/session-templates"),
+  createSessionTemplate: (template: SessionTemplateInput) =>
+    request<SessionTemplate>("/api/session-templates", {
+      method: "POST",
+      body: JSON.stringify(template),
+    }),
+  updateSessionTemplate: (id: number, template: SessionTemplateInput) =>
+    request<SessionTemplate>(`/api/session-templates/${id}`, {
+      method: "PUT",
+      body: JSON.stringify(template),
+    }),
+  deleteSessionTemplate: (id: number) =>
+    request<void>(`/api/session-templates/${id}`, { method: "DELETE" }),
+  restartSession: (
+    id: string,
+    opts: { cli_type?: string; resume?: boolean } = {},
+  ) =>
+    request<any>(`/api/sessions/${id}/restart`, {
+      method: "POST",
+      body: JSON.stringify(opts),
+    }),
+  archiveSession: (id: string) =>
+    request<SessionArchive>(`/api/sessions/${id}/archive`, { method: "POST" }),
+  restoreSession: (id: string, start = false) =>
+    request<any>(`/api/sessions/${id}/restore`, {
+      method: "POST",
+      body: JSON.stringify({ start }),
+    }),
+  getDiskUsage: (refresh = false) =>
+    request<DiskUsage>(`/api/usage${refresh ? "?refresh=true" : ""}`),
+  runMaintenance: () =>
+    request<MaintenanceResult[]>("/api/maintenance", { method: "POST" }),
+  getArchives: () => request<SessionArchive[]>("/api/archives"),
+  deleteArchive: (id: string) =>
+    request<void>(`/api/archives/${id}`, { method: "DELETE" }),
+  deleteSession: (id: string, deleteLocal = true, force = false) =>
+    request<void>(
+      `/api/sessions/${id}?delete_local=${deleteLocal}&force=${force}`,
+      { method: "DELETE" },
+    ),
   getSessionReplay: (id: string): Promise<ArrayBuffer> =>
     fetch(`/api/sessions/${id}/replay`).then((res) => {
       if (res.status === 401) {
@@ -180,11 +381,36 @@ export const api = {
   // Session Env Vars
   getSessionEnv: (sessionId: string) =>
     request<Record<string, string>>(`/api/sessions/${sessionId}/env`),
-  updateSessionEnv: (sessionId: string, env: Record<string, string>) =>
-    request<Record<string, string>>(`/api/sessions/${sessionId}/env`, {
+  updateSessionEnv: (
+    sessionId: string,
+    env: Record<string, string>,
+    restart?: boolean,
+  ) =>
+    request<Record<string, string>>(
+      `/api/sessions/${sessionId}/env${restart ? "?restart=true" : ""}`,
+      {
+        method: "PUT",
+        body: JSON.stringify(env),
+      },
+    ),
+
+  // Env profiles
+  getEnvProfiles: (repoId?: number) =>
+    request<EnvProfile[]>(
+      `/api/env-profiles${repoId !== undefined ? `?repo_id=${repoId}` : ""}`,
+    ),
+  createEnvProfile: (data: Partial<EnvProfile>) =>
+    request<EnvProfile>("/api/env-profiles", {
+      method: "POST",
+      body: JSON.stringify(data),
+    }),
+  updateEnvProfile: (id: number, data: Partial<EnvProfile>) =>
+    request<EnvProfile>(`/api/env-profiles/${id}`, {
       method: "PUT",
-      body: JSON.stringify(env),
+      body: JSON.stringify(data),
     }),
+  deleteEnvProfile: (id: number) =>
+    request<void>(`/api/env-profiles/${id}`, { method: "DELETE" }),
 
   // Webhooks
   getWebhooks: () => request<Webhook[]>("/api/webhooks"),
@@ -222,15 +448,29 @@ export const api = {
 
   // Workflows
   getWorkflows: () => request<Workflow[]>("/api/workflows"),
-  createWorkflow: (data: { name: string; description: string; steps: WorkflowStep[] }) =>
+  createWorkflow: (data: {
+    name: string;
+    description: string;
+    params?: WorkflowParam[];
+    steps: WorkflowStep[];
+  }) =>
     request<Workflow>("/api/workflows", {
       method: "POST",
       body: JSON.stringify(data),
     }),
   deleteWorkflow: (id: number) =>
     request<void>(`/api/workflows/${id}`, { method: "DELETE" }),
-  runWorkflow: (id: number) =>
-    request<void>(`/api/workflows/${id}/run`, { method: "POST" }),
+  runWorkflow: (id: number, params?: Record<string, unknown>) =>
+    request<WorkflowRun>(`/api/workflows/${id}/run`, {
+      method: "POST",
+      body: JSON.stringify({ params: params ?? {} }),
+    }),
+  getWorkflowRuns: (id: number) =>
+    request<WorkflowRun[]>(`/api/workflows/${id}/runs`),
+  getWorkflowRun: (runId: number) =>
+    request<WorkflowRun>(`/api/workflow-runs/${runId}`),
+  cancelWorkflowRun: (runId: number) =>
+    request<void>(`/api/workflow-runs/${runId}/cancel`, { method: "POST" }),
 
   // Triggers
   getTriggers: () => request<Trigger[]>("/api/triggers"),
@@ -266,6 +506,62 @@ export interface Webhook {
   created_at: string;
 }
 
+export interface EnvProfile {
+  id: number;
+  name: string;
+  repo_id: number | null;
+  env: Record<string, string>;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface SessionArchive {
+  id: string;
+  repo_id: number;
+  repo_owner: string;
+  repo_name: string;
+  branch: string;
+  source_branch: string;
+  cli_type: string;
+  created_at: string;
+  archived_at: string;
+  head: string;
+  backup_ref?: string;
+  size?: number;
+}
+
+export interface DiskUsage {
+  total: number;
+  quota: number;
+  over_quota: boolean;
+  dirs: Record<string, number>;
+  repos: { id: number; owner: string; name: string; local_path: string; size: number }[];
+  sessions: {
+    id: string;
+    repo_id: number;
+    branch: string;
+    status: string;
+    worktree_path: string;
+    size: number;
+  }[];
+  computed_at: string;
+}
+
+export interface MaintenanceResult {
+  repo_id: number;
+  owner: string;
+  name: string;
+  size_before: number;
+  size_after: number;
+  error?: string;
+}
+
+export interface SecretInfo {
+  name: string;
+  created_at: string;
+  updated_at: string;
+}
+
 export interface MCPServerConfig {
   type?: string;
   command: string;
@@ -277,6 +573,273 @@ export interface MCPConfig {
   mcpServers: Record<string, MCPServerConfig>;
 }
 
+export interface RepoConfig {
+  cli_type?: string;
+  source_branch?: string;
+  env?: Record<string, string>;
+  mcp_servers?: Record<string, MCPServerConfig>;
+  setup?: string[];
+}
+
+export interface RepoConfigResponse {
+  stored: RepoConfig;
+  file: RepoConfig | null;
+  file_error: string;
+  effective: RepoConfig;
+}
+
+export interface SessionTemplateInput {
+  name: string;
+  repo_id: number | null;
+  source_branch: string;
+  branch_pattern: string;
+  cli_type: string;
+  env: Record<string, string>;
+  mcp_servers: Record<string, MCPServerConfig>;
+  prompt: string;
+}
+
+export interface SessionTemplate extends SessionTemplateInput {
+  id: number;
+  created_at: string;
+}
+
+export interface SessionBatchRequest {
+  repo_id?: number;
+  repo_ids?: number[];
+  source_branch?: string;
+  cli_type?: string;
+  cli_types?: string[];
+  prompt?: string;
+  prompts?: string[];
+  template_id?: number;
+  branch_prefix?: string;
+  sessions?: {
+    repo_id?: number;
+    source_branch?: string;
+    new_branch?: string;
+    cli_type?: string;
+    prompt?: string;
+    template_id?: number;
+  }[];
+}
+
+export interface SessionBatchResponse {
+  batch_id: string;
+  created: number;
+  failed: number;
+  sessions: {
+    index: number;
+    status: "created" | "failed";
+    session?: any;
+    branch: string;
+    cli_type: string;
+    repo_id: number;
+    error?: string;
+  }[];
+}
+
+export interface DiffFileStat {
+  path: string;
+  old_path?: string;
+  status: "added" | "modified" | "deleted" | "renamed" | "copied" | "type_changed";
+  additions: number;
+  deletions: number;
+  binary: boolean;
+}
+
+export interface DiffSummary {
+  files: DiffFileStat[];
+  additions: number;
+  deletions: number;
+  patch: string;
+  truncated: boolean;
+}
+
+export interface SessionDiff extends DiffSummary {
+  session_id: string;
+  branch: string;
+  source_branch: string;
+  base_commit: string;
+}
+
+export interface SessionComparison extends DiffSummary {
+  a: { session_id: string; branch: string };
+  b: { session_id: string; branch: string };
+}
+
+export interface GitStatus {
+  branch: string;
+  head: string;
+  upstream?: string;
+  ahead: number;
+  behind: number;
+  clean: boolean;
+  files: {
+    path: string;
+    old_path?: string;
+    staged: string;
+    unstaged: string;
+  }[];
+}
+
+export interface GitDiffLine {
+  type: "context" | "add" | "delete";
+  content: string;
+  old_line?: number;
+  new_line?: number;
+  no_newline?: boolean;
+}
+
+export interface GitHunk {
+  header: string;
+  old_start: number;
+  old_lines: number;
+  new_start: number;
+  new_lines: number;
+  lines: GitDiffLine[];
+}
+
+export interface GitFileDiff extends DiffFileStat {
+  old_mode?: string;
+  new_mode?: string;
+  hunks: GitHunk[];
+}
+
+export interface GitDiff {
+  mode: string;
+  source_branch?: string;
+  base_commit?: string;
+  files: GitFileDiff[];
+  additions: number;
+  deletions: number;
+  truncated: boolean;
+}
+
+export interface GitCommit {
+  hash: string;
+  short_hash: string;
+  parents: string[];
+  author_name: string;
+  author_email: string;
+  author_date: string;
+  subject: string;
+  body: string;
+}
+
+export interface PullRequest {
+  number: number;
+  html_url: string;
+  state: string;
+  title: string;
+  body: string;
+  draft: boolean;
+  merged: boolean;
+  head: string;
+  head_sha: string;
+  head_repo: string;
+  base: string;
+  user: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface BaseUpdate {
+  method: "rebase" | "merge";
+  source_branch: string;
+  previous_base: string;
+  base_commit: string;
+  head: string;
+  up_to_date: boolean;
+}
+
+// Progress of a repository clone, as reported by git clone --progress.
+export interface CloneProgress {
+  phase: string;
+  percent: number;
+  current: number;
+  total: number;
+  bytes: number;
+}
+
+export interface RepoSyncResult {
+  synced_at: string;
+  updated: string[];
+  // Branches left behind their remote because a worktree has them checked out.
+  skipped: string[];
+  // Branches left alone because they have commits their remote doesn't.
+  // Absent from results recorded before it was added.
+  diverged?: string[];
+  sessions: {
+    session_id: string;
+    branch: string;
+    source_branch: string;
+    ahead: number;
+    behind: number;
+  }[];
+}
+
+// Options for large repos: a partial clone filter (e.g. "blob:none") and
+// shallow clone depth, and the directories to check out in sessions (all
+// when empty).
+export interface CheckoutOptions {
+  clone_filter?: string;
+  clone_depth?: number;
+  sparse_paths?: string[];
+}
+
+export interface RemoteRepo extends CheckoutOptions {
+  url: string;
+  provider?: "github" | "gitlab" | "gitea" | "git";
+  username?: string;
+  token?: string;
+  ssh_key_path?: string;
+}
+
+export interface Issue {
+  number: number;
+  html_url: string;
+  state: string;
+  title: string;
+  body: string;
+  user: string;
+  labels: string[];
+  comments: number;
+  is_pull_request: boolean;
+  created_at: string;
+}
+
+export interface ReviewThread {
+  path: string;
+  line: number;
+  is_resolved: boolean;
+  is_outdated: boolean;
+  comments: {
+    author: string;
+    body: string;
+    diff_hunk: string;
+    created_at: string;
+  }[];
+}
+
+export interface CheckStatus {
+  ref: string;
+  state: "none" | "pending" | "success" | "failure";
+  runs: {
+    name: string;
+    status: string;
+    conclusion: string;
+    html_url: string;
+  }[];
+}
+
+export interface SessionSetup {
+  status: "none" | "running" | "succeeded" | "failed";
+  log: string;
+  error: string;
+  updated_at?: string;
+}
+
 export interface OrchestratorSession {
   id: string;
   status: string;
@@ -292,23 +855,67 @@ export interface SessionSummary {
   branch: string;
   cli_type: string;
   status: string;
+  batch_id: string | null;
   snippet: string;
   created_at: string;
 }
 
 export interface WorkflowStep {
-  type: "shell" | "send_input";
+  type:
+    | "shell"
+    | "send_input"
+    | "create_session"
+    | "wait_idle"
+    | "wait_output"
+    | "capture"
+    | "git_commit"
+    | "git_push"
+    | "stop_session";
   command?: string;
   session_id?: string;
   data?: string;
+  repo_id?: number;
+  source_branch?: string;
+  new_branch?: string;
+  cli_type?: string;
+  pattern?: string;
+  idle_seconds?: number;
+  timeout?: number;
+  lines?: number;
+  message?: string;
+  push?: boolean;
+  save_as?: string;
+}
+
+export interface WorkflowParam {
+  name: string;
+  type?: "string" | "number" | "boolean";
+  default?: unknown;
+  required?: boolean;
+  description?: string;
 }
 
 export interface Workflow {
   id: number;
   name: string;
   description: string;
+  params: WorkflowParam[];
   steps: WorkflowStep[];
   created_at: string;
+  repo_id: number | null;
+  path?: string;
+  error?: string;
+}
+
+export interface WorkflowRun {
+  id: number;
+  workflow_id: number;
+  status: "running" | "succeeded" | "failed" | "cancelled";
+  error: string;
+  params: Record<string, string>;
+  log?: string;
+  started_at: string;
+  finished_at: string | null;
 }
 
 export interface Trigger {
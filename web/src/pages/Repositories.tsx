@@ -1,5 +1,11 @@
 import { useEffect, useState, useCallback, useRef } from "react";
-import { api, ForgeOfflineError } from "../lib/api";
+import {
+  api,
+  ForgeOfflineError,
+  type CheckoutOptions,
+  type CloneProgress,
+  type RepoSyncResult,
+} from "../lib/api";
 
 interface LocalRepo {
   id: number;
@@ -7,10 +13,20 @@ interface LocalRepo {
   owner: string;
   name: string;
   clone_status: string;
+  clone_error: string;
+  clone_progress?: CloneProgress;
   default_branch: string;
   last_synced: string | null;
   repo_type: string;
+  clone_url: string;
   source_path: string | null;
+  clone_filter: string;
+  clone_depth: number;
+  sparse_paths: string[] | null;
+  sync_interval_minutes: number | null;
+  last_sync_at: string | null;
+  last_sync_error: string;
+  last_sync_result?: RepoSyncResult;
 }
 
 interface GitHubRepo {
@@ -34,6 +50,9 @@ export default function Repositories() {
   const debounceRef = useRef<ReturnType<typeof setTimeout>>(undefined);
   const [localPath, setLocalPath] = useState("");
   const [localError, setLocalError] = useState("");
+  const [cloneFilter, setCloneFilter] = useState("");
+  const [cloneDepth, setCloneDepth] = useState("");
+  const [sparsePaths, setSparsePaths] = useState("");
 
   const pollDelayRef = useRef(3_000);
 
@@ -100,9 +119,18 @@ export default function Repositories() {
     return () => clearTimeout(debounceRef.current);
   }, [search, hasLoaded, searchGitHub]);
 
+  const checkoutOptions = (): CheckoutOptions => ({
+    clone_filter: cloneFilter,
+    clone_depth: Number(cloneDepth) || 0,
+    sparse_paths: sparsePaths
+      .split(/[\s,]+/)
+      .map((p) => p.trim())
+      .filter(Boolean),
+  });
+
   const addRepo = async (url: string) => {
     try {
-      await api.addRepo(url);
+      await api.addRepo(url, checkoutOptions());
       loadLocal();
     } catch (e: any) {
       setError(e.message);
@@ -114,7 +142,7 @@ export default function Repositories() {
     if (!trimmed) return;
     setLocalError("");
     try {
-      await api.addLocalRepo(trimmed);
+      await api.addLocalRepo(trimmed, checkoutOptions());
       setLocalPath("");
       loadLocal();
     } catch (e: any) {
@@ -123,15 +151,34 @@ export default function Repositories() {
   };
 
   const removeRepo = async (id: number) => {
-    await api.deleteRepo(id);
+    try {
+      await api.deleteRepo(id);
+    } catch (e: any) {
+      setError(e.message);
+    }
     loadLocal();
   };
 
   const syncRepo = async (id: number) => {
-    await api.syncRepo(id);
+    try {
+      await api.syncRepo(id);
+    } catch (e: any) {
+      setError(e.message);
+    }
     loadLocal();
   };
 
+  const setSyncInterval = async (id: number, value: string) => {
+    try {
+      await api.updateRepo(id, {
+        sync_interval_minutes: value.trim() === "" ? null : Number(value),
+      });
+      loadLocal();
+    } catch (e: any) {
+      setError(e.message);
+    }
+  };
+
   const localFullNames = new Set(localRepos.map((r) => `${r.owner}/${r.name}`));
   const filteredGh = ghRepos.filter((r) => !localFullNames.has(r.full_name));
 
@@ -169,9 +216,9 @@ export default function Repositories() {
                     {repo.repo_type === "local"
                       ? repo.name
                       : `${repo.owner}/${repo.name}`}
-                    {repo.repo_type === "local" && (
+                    {repo.repo_type !== "github" && (
                       <span className="ml-2 text-xs text-zinc-500 border border-zinc-700 px-1.5 py-0.5 rounded">
-                        local
+                        {repo.repo_type}
                       </span>
                     )}
                   </p>
@@ -184,14 +231,77 @@ export default function Repositories() {
                     {repo.clone_status === "ready"
                       ? `Ready — ${repo.default_branch}`
                       : repo.clone_status === "cloning"
-                        ? "Cloning..."
+                        ? cloneProgressText(repo.clone_progress)
                         : `Error`}
                     {repo.last_synced &&
                       ` — synced ${new Date(repo.last_synced).toLocaleString()}`}
                   </p>
+                  {(repo.clone_filter ||
+                    repo.clone_depth > 0 ||
+                    (repo.sparse_paths?.length ?? 0) > 0) && (
+                    <p className="text-xs text-zinc-600">
+                      {[
+                        repo.clone_filter && `filter ${repo.clone_filter}`,
+                        repo.clone_depth > 0 && `depth ${repo.clone_depth}`,
+                        repo.sparse_paths?.length &&
+                          `sparse: ${repo.sparse_paths.join(", ")}`,
+                      ]
+                        .filter(Boolean)
+                        .join(" — ")}
+                    </p>
+                  )}
+                  {repo.clone_status === "cloning" &&
+                    (repo.clone_progress?.total ?? 0) > 0 && (
+                      <div className="mt-1 h-1 w-48 max-w-full rounded bg-zinc-800">
+                        <div
+                          className="h-1 rounded bg-amber-500 transition-all"
+                          style={{ width: `${repo.clone_progress!.percent}%` }}
+                        />
+                      </div>
+                    )}
+                  {repo.clone_status === "error" && repo.clone_error && (
+                    <p className="text-xs text-red-400 break-all whitespace-pre-wrap">
+                      {repo.clone_error}
+                    </p>
+                  )}
+                  {repo.last_sync_error && (
+                    <p className="text-xs text-red-400 break-all">
+                      Sync failed: {repo.last_sync_error}
+                    </p>
+                  )}
+                  {(repo.last_sync_result?.skipped.length ?? 0) > 0 && (
+                    <p className="text-xs text-amber-500">
+                      Not updated (checked out in a session):{" "}
+                      {repo.last_sync_result!.skipped.join(", ")}
+                    </p>
+                  )}
+                  {(repo.last_sync_result?.diverged?.length ?? 0) > 0 && (
+                    <p className="text-xs text-amber-500">
+                      Not updated (diverged from origin):{" "}
+                      {repo.last_sync_result!.diverged!.join(", ")}
+                    </p>
+                  )}
                 </div>
                 <div className="flex flex-wrap items-center gap-2">
                   <StatusDot status={repo.clone_status} />
+                  {repo.clone_status === "ready" && (
+                    <input
+                      type="number"
+                      min={0}
+                      defaultValue={repo.sync_interval_minutes ?? ""}
+                      onBlur={(e) => {
+                        if (
+                          e.target.value !==
+                          String(repo.sync_interval_minutes ?? "")
+                        ) {
+                          setSyncInterval(repo.id, e.target.value);
+                        }
+                      }}
+                      placeholder="Default"
+                      title="Minutes between background syncs (0 disables, empty uses the default)"
+                      className="w-24 px-2 py-1.5 bg-zinc-900 border border-zinc-700 rounded text-xs placeholder-zinc-600 focus:outline-none focus:ring-1 focus:ring-blue-500"
+                    />
+                  )}
                   {repo.clone_status === "ready" && (
                     <button
                       onClick={() => syncRepo(repo.id)}
@@ -204,7 +314,7 @@ export default function Repositories() {
                     onClick={() => removeRepo(repo.id)}
                     className="text-xs text-zinc-400 hover:text-red-400 px-3 py-1.5 rounded border border-zinc-700 hover:border-red-800 transition-colors"
                   >
-                    Remove
+                    {repo.clone_status === "cloning" ? "Cancel" : "Remove"}
                   </button>
                 </div>
               </div>
@@ -213,6 +323,48 @@ export default function Repositories() {
         )}
       </div>
 
+      {/* Large repo options, applied to repos added below */}
+      <details className="mb-6 sm:mb-8 rounded-lg border border-zinc-800 bg-zinc-900/50 p-3">
+        <summary className="text-sm text-zinc-400 cursor-pointer">
+          Large repo options
+        </summary>
+        <div className="mt-3 grid gap-3 sm:grid-cols-3">
+          <label className="text-xs text-zinc-500">
+            Partial clone
+            <select
+              value={cloneFilter}
+              onChange={(e) => setCloneFilter(e.target.value)}
+              className="mt-1 w-full px-3 py-2 bg-zinc-900 border border-zinc-700 rounded-md text-sm text-zinc-200 focus:outline-none focus:ring-1 focus:ring-blue-500"
+            >
+              <option value="">Full clone</option>
+              <option value="blob:none">Blobless (blob:none)</option>
+              <option value="tree:0">Treeless (tree:0)</option>
+            </select>
+          </label>
+          <label className="text-xs text-zinc-500">
+            Shallow depth
+            <input
+              type="number"
+              min={0}
+              value={cloneDepth}
+              onChange={(e) => setCloneDepth(e.target.value)}
+              placeholder="Full history"
+              className="mt-1 w-full px-3 py-2 bg-zinc-900 border border-zinc-700 rounded-md text-sm placeholder-zinc-600 focus:outline-none focus:ring-1 focus:ring-blue-500"
+            />
+          </label>
+          <label className="text-xs text-zinc-500">
+            Sparse checkout paths
+            <input
+              type="text"
+              value={sparsePaths}
+              onChange={(e) => setSparsePaths(e.target.value)}
+              placeholder="services/api, libs/common"
+              className="mt-1 w-full px-3 py-2 bg-zinc-900 border border-zinc-700 rounded-md text-sm placeholder-zinc-600 focus:outline-none focus:ring-1 focus:ring-blue-500"
+            />
+          </label>
+        </div>
+      </details>
+
       {/* Add local folder */}
       <div className="mb-6 sm:mb-8">
         <h3 className="text-sm font-medium text-zinc-400 uppercase tracking-wider mb-3">
@@ -316,6 +468,24 @@ export default function Repositories() {
   );
 }
 
+function formatSize(bytes: number): string {
+  if (bytes < 1024) return `${bytes} B`;
+  if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+  if (bytes < 1024 * 1024 * 1024) return `${(bytes / (1024 * 1024)).toFixed(1)} MB`;
+  return `${(bytes / (1024 * 1024 * 1024)).toFixed(2)} GB`;
+}
+
+// cloneProgressText describes a clone in progress, e.g.
+// "Receiving objects 45% (450/1000) — 12.3 MB".
+function cloneProgressText(p?: CloneProgress): string {
+  if (!p?.phase) return "Cloning...";
+  let text = p.phase;
+  if (p.total > 0) text += ` ${p.percent}% (${p.current}/${p.total})`;
+  else if (p.current > 0) text += ` ${p.current}`;
+  if (p.bytes > 0) text += ` — ${formatSize(p.bytes)}`;
+  return text;
+}
+
 function StatusDot({ status }: { status: string }) {
   const color =
     status === "ready"
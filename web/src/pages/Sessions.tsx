@@ -1,6 +1,6 @@
 import { useEffect, useState, useCallback, useRef } from "react";
 import { useNavigate, useParams } from "react-router-dom";
-import { api, ForgeOfflineError } from "../lib/api";
+import { api, ForgeOfflineError, type SessionArchive } from "../lib/api";
 import Terminal from "../components/Terminal";
 import TerminalPreview from "../components/TerminalPreview";
 import NewSessionModal from "../components/NewSessionModal";
@@ -24,6 +24,8 @@ interface SessionInfo {
   created_at: string;
   repo_owner: string;
   repo_name: string;
+  source_branch?: string;
+  source_behind?: number;
 }
 
 export default function Sessions() {
@@ -31,6 +33,7 @@ export default function Sessions() {
   const { sessionId } = useParams<{ sessionId?: string }>();
   const activeTab = sessionId ?? null;
   const [sessions, setSessions] = useState<SessionInfo[]>([]);
+  const [archives, setArchives] = useState<SessionArchive[]>([]);
   const [openTabs, setOpenTabs] = useState<string[]>([]);
   const [viewMode, setViewMode] = useState<"tabs" | "grid">("tabs");
   const [showModal, setShowModal] = useState(false);
@@ -39,6 +42,9 @@ export default function Sessions() {
     if (saved === "notes" || saved === "files" || saved === "mcp" || saved === "ui") return saved;
     return null;
   });
+  // Bumped when a session's CLI is restarted so its terminal reconnects to
+  // the new process.
+  const [restarts, setRestarts] = useState<Record<string, number>>({});
   const { idleSessions } = useIdleMonitor();
   const { toast } = useToast();
   const fileInputRef = useRef<HTMLInputElement>(null);
@@ -63,8 +69,12 @@ export default function Sessions() {
 
   const load = useCallback(async () => {
     try {
-      const data = await api.getSessions();
+      const [data, archived] = await Promise.all([
+        api.getSessions(),
+        api.getArchives(),
+      ]);
       setSessions(data);
+      setArchives(archived);
       pollDelayRef.current = 5_000;
     } catch (e) {
       if (e instanceof ForgeOfflineError) {
@@ -131,11 +141,99 @@ export default function Sessions() {
       `Also delete the local branch/worktree for ${target}?\n\nOK = delete locally\nCancel = keep local files and branch`,
     );
 
-    await api.deleteSession(id, deleteLocal);
+    try {
+      await api.deleteSession(id, deleteLocal);
+    } catch (e: any) {
+      if (!e.message.includes("uncommitted changes")) {
+        toast(e.message, "error");
+        return;
+      }
+      const force = window.confirm(
+        `${target} has uncommitted changes.\n\nOK = back them up and delete the worktree\nCancel = keep the session`,
+      );
+      if (!force) return;
+      await api.deleteSession(id, deleteLocal, true);
+    }
     closeTab(id);
     load();
   };
 
+  const handleArchive = async (id: string) => {
+    if (
+      !window.confirm(
+        "Archive this session?\n\nIts branch, uncommitted changes, terminal output, notes and UI are saved to an archive and its worktree is removed. It can be restored later.",
+      )
+    )
+      return;
+    try {
+      await api.archiveSession(id);
+      closeTab(id);
+      load();
+    } catch (e: any) {
+      toast(e.message, "error");
+    }
+  };
+
+  const handleRestore = async (id: string) => {
+    try {
+      await api.restoreSession(id, true);
+      bumpRestart(id);
+      await load();
+      openTab(id);
+    } catch (e: any) {
+      toast(e.message, "error");
+    }
+  };
+
+  const handleDeleteArchive = async (id: string) => {
+    if (!window.confirm("Delete this archive? This can't be undone.")) return;
+    try {
+      await api.deleteArchive(id);
+      load();
+    } catch (e: any) {
+      toast(e.message, "error");
+    }
+  };
+
+  const bumpRestart = useCallback((id: string) => {
+    setRestarts((prev) => ({ ...prev, [id]: (prev[id] ?? 0) + 1 }));
+  }, []);
+
+  const handleRestart = async (id: string) => {
+    const resume = window.confirm(
+      "Restart the CLI in this session's worktree.\n\nOK = continue the previous conversation\nCancel = start a fresh conversation",
+    );
+    try {
+      await api.restartSession(id, { resume });
+      bumpRestart(id);
+      load();
+      openTab(id);
+    } catch (e: any) {
+      toast(e.message, "error");
+    }
+  };
+
+  const handleUpdateBase = async (session: SessionInfo) => {
+    if (
+      !window.confirm(
+        `Rebase ${session.branch} onto ${session.source_branch}?\n\nThe worktree must have no uncommitted changes. The rebase is aborted if it conflicts.`,
+      )
+    )
+      return;
+    try {
+      const u = await api.updateSessionBase(session.id, "rebase");
+      toast(
+        u.up_to_date
+          ? `Already up to date with ${u.source_branch}`
+          : `Rebased onto ${u.source_branch}`,
+        "success",
+      );
+      load();
+    } catch (e: any) {
+      toast(e.message, "error");
+    }
+  };
+
   const runningSessions = sessions.filter((s) => s.status === "running");
   const stoppedSessions = sessions.filter((s) => s.status !== "running");
 
@@ -381,6 +479,15 @@ export default function Sessions() {
             </button>
           )}
 
+          {viewMode === "tabs" && activeTab && (
+            <button
+              onClick={() => handleRestart(activeTab)}
+              className="shrink-0 text-xs text-zinc-400 hover:text-zinc-200 px-3 py-1.5 mr-1 rounded border border-zinc-700 hover:border-zinc-500 transition-colors"
+            >
+              Restart
+            </button>
+          )}
+
           {viewMode === "tabs" && activeTab && (
             <button
               onClick={() => handleDelete(activeTab)}
@@ -437,6 +544,7 @@ export default function Sessions() {
                           }}
                         >
                           <Terminal
+                            key={restarts[id] ?? 0}
                             sessionId={id}
                             visible={activeTab === id}
                           />
@@ -452,7 +560,10 @@ export default function Sessions() {
                     ) : rightPanel === "ui" ? (
                       <A2UIPanel sessionId={activeTab} />
                     ) : (
-                      <MCPConfig sessionId={activeTab} />
+                      <MCPConfig
+                        sessionId={activeTab}
+                        onRestarted={() => bumpRestart(activeTab)}
+                      />
                     )
                   }
                 />
@@ -466,7 +577,11 @@ export default function Sessions() {
                         display: activeTab === id ? "block" : "none",
                       }}
                     >
-                      <Terminal sessionId={id} visible={activeTab === id} />
+                      <Terminal
+                        key={restarts[id] ?? 0}
+                        sessionId={id}
+                        visible={activeTab === id}
+                      />
                     </div>
                   ))}
                 </div>
@@ -524,7 +639,7 @@ export default function Sessions() {
                     </div>
                   </div>
                   <div className="flex-1 min-h-0">
-                    <Terminal sessionId={id} visible />
+                    <Terminal key={restarts[id] ?? 0} sessionId={id} visible />
                   </div>
                 </div>
               );
@@ -565,6 +680,7 @@ export default function Sessions() {
                 session={s}
                 idle={idleSessions.has(s.id)}
                 onOpen={() => openTab(s.id)}
+                onUpdateBase={() => handleUpdateBase(s)}
                 onDelete={() => handleDelete(s.id)}
               />
             ))}
@@ -582,6 +698,8 @@ export default function Sessions() {
               <SessionCard
                 key={s.id}
                 session={s}
+                onRestart={() => handleRestart(s.id)}
+                onArchive={() => handleArchive(s.id)}
                 onDelete={() => handleDelete(s.id)}
               />
             ))}
@@ -589,7 +707,48 @@ export default function Sessions() {
         </div>
       )}
 
-      {sessions.length === 0 && (
+      {archives.length > 0 && (
+        <div className="mt-6 sm:mt-8">
+          <h3 className="text-sm font-medium text-zinc-400 uppercase tracking-wider mb-3">
+            Archived
+          </h3>
+          <div className="space-y-2">
+            {archives.map((a) => (
+              <div
+                key={a.id}
+                className="px-4 py-3 rounded-lg border border-zinc-800 bg-zinc-900 flex items-center justify-between gap-3"
+              >
+                <div className="min-w-0">
+                  <p className="text-sm break-all">
+                    {a.repo_owner}/{a.repo_name}{" "}
+                    <span className="text-xs text-zinc-500">{a.branch}</span>
+                  </p>
+                  <p className="text-[11px] text-zinc-500">
+                    {a.cli_type} · archived {timeAgo(a.archived_at)}
+                    {a.size ? ` · ${formatSize(a.size)}` : ""}
+                  </p>
+                </div>
+                <div className="flex gap-2 shrink-0">
+                  <button
+                    onClick={() => handleRestore(a.id)}
+                    className="text-xs bg-zinc-800 hover:bg-zinc-700 px-3 py-1.5 rounded transition-colors"
+                  >
+                    Restore
+                  </button>
+                  <button
+                    onClick={() => handleDeleteArchive(a.id)}
+                    className="text-xs text-zinc-400 hover:text-red-400 px-3 py-1.5 rounded border border-zinc-700 hover:border-red-800 transition-colors"
+                  >
+                    Delete
+                  </button>
+                </div>
+              </div>
+            ))}
+          </div>
+        </div>
+      )}
+
+      {sessions.length === 0 && archives.length === 0 && (
         <p className="text-zinc-500 text-sm">
           No sessions yet. Add a repo and create a session to start coding.
         </p>
@@ -631,11 +790,17 @@ function SessionCard({
   session,
   idle,
   onOpen,
+  onRestart,
+  onArchive,
+  onUpdateBase,
   onDelete,
 }: {
   session: SessionInfo;
   idle?: boolean;
   onOpen?: () => void;
+  onRestart?: () => void;
+  onArchive?: () => void;
+  onUpdateBase?: () => void;
   onDelete: () => void;
 }) {
   const running = session.status === "running";
@@ -651,6 +816,16 @@ function SessionCard({
           </p>
           <p className="text-xs text-zinc-500 break-all">
             {session.branch}
+            {(session.source_behind ?? 0) > 0 && (
+              <button
+                onClick={onUpdateBase}
+                disabled={!onUpdateBase}
+                className="ml-2 text-amber-500 hover:text-amber-400 disabled:hover:text-amber-500"
+                title={`${session.source_branch} has ${session.source_behind} commits this branch doesn't${onUpdateBase ? "; click to rebase onto it" : ""}`}
+              >
+                {session.source_branch} +{session.source_behind}
+              </button>
+            )}
           </p>
         </div>
         <div className="flex items-center gap-2 shrink-0">
@@ -690,6 +865,22 @@ function SessionCard({
             Open Terminal
           </button>
         )}
+        {!running && onRestart && (
+          <button
+            onClick={onRestart}
+            className="text-xs bg-zinc-800 hover:bg-zinc-700 px-3 py-1.5 rounded transition-colors"
+          >
+            Restart
+          </button>
+        )}
+        {!running && onArchive && (
+          <button
+            onClick={onArchive}
+            className="text-xs bg-zinc-800 hover:bg-zinc-700 px-3 py-1.5 rounded transition-colors"
+          >
+            Archive
+          </button>
+        )}
         <button
           onClick={onDelete}
           className="text-xs text-zinc-400 hover:text-red-400 px-3 py-1.5 rounded border border-zinc-700 hover:border-red-800 transition-colors"
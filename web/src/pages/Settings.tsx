@@ -2,16 +2,20 @@ import { useEffect, useState } from "react";
 import { api } from "../lib/api";
 import { useToast } from "../components/Toast";
 import WebhookManager from "../components/WebhookManager";
+import EnvProfileManager from "../components/EnvProfileManager";
+import DiskUsagePanel from "../components/DiskUsagePanel";
 
 export default function Settings() {
   const [pat, setPat] = useState("");
+  // The PAT is stored as a secret and never sent back, only whether it's set.
+  const [patSaved, setPatSaved] = useState(false);
   const [loading, setLoading] = useState(true);
   const { toast } = useToast();
 
   useEffect(() => {
     api
       .getSetting("github_pat")
-      .then((s) => setPat(s.value))
+      .then(() => setPatSaved(true))
       .catch(() => {})
       .finally(() => setLoading(false));
   }, []);
@@ -20,8 +24,8 @@ export default function Settings() {
     try {
       if (pat.trim()) {
         await api.putSetting("github_pat", pat.trim());
-      } else {
-        await api.deleteSetting("github_pat").catch(() => {});
+        setPat("");
+        setPatSaved(true);
       }
       toast("Settings saved", "success");
     } catch (e: any) {
@@ -29,6 +33,16 @@ export default function Settings() {
     }
   };
 
+  const handleRemovePat = async () => {
+    try {
+      await api.deleteSetting("github_pat");
+      setPatSaved(false);
+      toast("Token removed", "success");
+    } catch (e: any) {
+      toast(e.message, "error");
+    }
+  };
+
   return (
     <div className="w-full max-w-2xl p-4 sm:p-6 lg:p-8">
       <h2 className="text-xl sm:text-2xl font-bold mb-1">Settings</h2>
@@ -59,16 +73,90 @@ export default function Settings() {
             type="password"
             value={pat}
             onChange={(e) => setPat(e.target.value)}
-            placeholder={loading ? "Loading..." : "ghp_xxxxxxxxxxxxxxxxxxxx"}
+            placeholder={
+              loading
+                ? "Loading..."
+                : patSaved
+                  ? "Saved — enter a new token to replace it"
+                  : "ghp_xxxxxxxxxxxxxxxxxxxx"
+            }
             className="w-full px-3 py-2.5 bg-zinc-900 border border-zinc-700 rounded-md text-sm placeholder-zinc-600 focus:outline-none focus:ring-1 focus:ring-blue-500 focus:border-blue-500"
           />
         </div>
-        <button
-          onClick={handleSave}
-          className="w-full sm:w-auto px-4 py-2.5 bg-blue-600 hover:bg-blue-500 text-white text-sm font-medium rounded-md transition-colors"
-        >
-          Save
-        </button>
+        <div className="flex flex-col sm:flex-row gap-2">
+          <button
+            onClick={handleSave}
+            className="w-full sm:w-auto px-4 py-2.5 bg-blue-600 hover:bg-blue-500 text-white text-sm font-medium rounded-md transition-colors"
+          >
+            Save
+          </button>
+          {patSaved && (
+            <button
+              onClick={handleRemovePat}
+              className="w-full sm:w-auto px-4 py-2.5 bg-zinc-800 hover:bg-zinc-700 text-zinc-300 text-sm font-medium rounded-md transition-colors"
+            >
+              Remove token
+            </button>
+          )}
+        </div>
+      </div>
+
+      <div className="h-px bg-zinc-800 my-8" />
+
+      <div className="space-y-6">
+        <div>
+          <h3 className="text-lg font-medium mb-2">Env Profiles</h3>
+          <p className="text-sm text-zinc-400 mb-4">
+            Environment variables added to every session, or every session of a
+            repository, when its CLI starts. Repository profiles override global
+            ones and the repository config; a session's own env vars override
+            both. Use <code className="text-zinc-300">{"${secret:NAME}"}</code>{" "}
+            to reference a stored secret.
+          </p>
+          <EnvProfileManager />
+        </div>
+      </div>
+
+      <div className="h-px bg-zinc-800 my-8" />
+
+      <div className="space-y-6">
+        <div>
+          <h3 className="text-lg font-medium mb-2">Worktrees</h3>
+          <p className="text-sm text-zinc-400 mb-4">
+            Stopped sessions keep their worktrees so they can be restarted.
+            Uncommitted changes are saved as chosen below before a worktree is
+            removed.
+          </p>
+          <WorktreeSettings />
+        </div>
+      </div>
+
+      <div className="h-px bg-zinc-800 my-8" />
+
+      <div className="space-y-6">
+        <div>
+          <h3 className="text-lg font-medium mb-2">Repository Sync</h3>
+          <p className="text-sm text-zinc-400 mb-4">
+            Repositories are fetched in the background so sessions can see how
+            far their source branch has moved. A repository can set its own
+            interval on the Repositories page.
+          </p>
+          <RepoSyncSettings />
+        </div>
+      </div>
+
+      <div className="h-px bg-zinc-800 my-8" />
+
+      <div className="space-y-6">
+        <div>
+          <h3 className="text-lg font-medium mb-2">Disk Usage</h3>
+          <p className="text-sm text-zinc-400 mb-4">
+            Space used by repositories, session worktrees and archives. When the
+            quota is reached, new sessions and repositories are refused. Git gc
+            and worktree prune also run daily.
+          </p>
+          <DiskUsagePanel />
+        </div>
       </div>
 
       <div className="h-px bg-zinc-800 my-8" />
@@ -98,6 +186,126 @@ export default function Settings() {
   );
 }
 
+function WorktreeSettings() {
+  const [retention, setRetention] = useState("");
+  const [backup, setBackup] = useState("commit");
+  const { toast } = useToast();
+
+  useEffect(() => {
+    api
+      .getSetting("worktree_retention_days")
+      .then((s) => setRetention(s.value))
+      .catch(() => {});
+    api
+      .getSetting("worktree_backup")
+      .then((s) => setBackup(s.value))
+      .catch(() => {});
+  }, []);
+
+  const handleSave = async () => {
+    try {
+      if (retention.trim()) {
+        await api.putSetting("worktree_retention_days", retention.trim());
+      } else {
+        await api.deleteSetting("worktree_retention_days").catch(() => {});
+      }
+      await api.putSetting("worktree_backup", backup);
+      toast("Worktree settings saved", "success");
+    } catch (e: any) {
+      toast(e.message, "error");
+    }
+  };
+
+  return (
+    <div className="space-y-3">
+      <div className="flex gap-3">
+        <div className="flex-1">
+          <label className="block text-xs text-zinc-500 mb-1">
+            Remove worktrees of sessions stopped for (days)
+          </label>
+          <input
+            type="number"
+            min={0}
+            value={retention}
+            onChange={(e) => setRetention(e.target.value)}
+            placeholder="Keep forever"
+            className="w-full bg-zinc-900 border border-zinc-700 rounded-lg px-3 py-2 text-sm focus:outline-none focus:border-zinc-500"
+          />
+        </div>
+        <div className="flex-1">
+          <label className="block text-xs text-zinc-500 mb-1">
+            Before removing a dirty worktree
+          </label>
+          <select
+            value={backup}
+            onChange={(e) => setBackup(e.target.value)}
+            className="w-full bg-zinc-900 border border-zinc-700 rounded-lg px-3 py-2 text-sm focus:outline-none focus:border-zinc-500"
+          >
+            <option value="commit">Commit to a backup ref</option>
+            <option value="stash">Stash changes</option>
+            <option value="none">Nothing (expiry skips dirty worktrees)</option>
+          </select>
+        </div>
+      </div>
+      <button
+        onClick={handleSave}
+        className="px-4 py-2 text-sm bg-zinc-800 hover:bg-zinc-700 rounded-lg transition-colors"
+      >
+        Save
+      </button>
+    </div>
+  );
+}
+
+function RepoSyncSettings() {
+  const [minutes, setMinutes] = useState("");
+  const { toast } = useToast();
+
+  useEffect(() => {
+    api
+      .getSetting("repo_sync_interval_minutes")
+      .then((s) => setMinutes(s.value))
+      .catch(() => {});
+  }, []);
+
+  const handleSave = async () => {
+    try {
+      if (minutes.trim()) {
+        await api.putSetting("repo_sync_interval_minutes", minutes.trim());
+      } else {
+        await api.deleteSetting("repo_sync_interval_minutes").catch(() => {});
+      }
+      toast("Sync settings saved", "success");
+    } catch (e: any) {
+      toast(e.message, "error");
+    }
+  };
+
+  return (
+    <div className="space-y-3">
+      <div>
+        <label className="block text-xs text-zinc-500 mb-1">
+          Sync every (minutes, 0 disables)
+        </label>
+        <input
+          type="number"
+          min={0}
+          value={minutes}
+          onChange={(e) => setMinutes(e.target.value)}
+          placeholder="15"
+          className="w-full bg-zinc-900 border border-zinc-700 rounded-lg px-3 py-2 text-sm focus:outline-none focus:border-zinc-500"
+        />
+      </div>
+      <button
+        onClick={handleSave}
+        className="px-4 py-2 text-sm bg-zinc-800 hover:bg-zinc-700 rounded-lg transition-colors"
+      >
+        Save
+      </button>
+    </div>
+  );
+}
+
 function NotificationRequest() {
   const [permission, setPermission] = useState(
     typeof Notification !== "undefined" ? Notification.permission : "denied",